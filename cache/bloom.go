@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Filter 加载前的存在性判断, MayContain 返回 false 时数据一定不存在
+type Filter interface {
+	MayContain(key string) bool
+}
+
+// BloomFilter 并发安全的布隆过滤器
+type BloomFilter struct {
+	mu   sync.RWMutex
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// NewBloomFilter n 为预计元素个数, fp 为期望误判率
+func NewBloomFilter(n uint64, fp float64) *BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		fp = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Ceil(math.Ln2 * float64(m) / float64(n)))
+	if k == 0 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (b *BloomFilter) Add(key string) {
+	h1, h2 := hashes(key)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *BloomFilter) MayContain(key string) bool {
+	h1, h2 := hashes(key)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes 双重哈希, 由两个哈希值组合出 k 个位置
+func hashes(key string) (uint64, uint64) {
+	a, b := fnv.New64a(), fnv.New64()
+	_, _ = a.Write([]byte(key))
+	_, _ = b.Write([]byte(key))
+	return a.Sum64(), b.Sum64() | 1
+}
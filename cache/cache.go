@@ -2,13 +2,51 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
+// ErrNotFound 数据不存在, Func 可以返回该错误(或返回 nil 值)表示数据源中没有记录
+var ErrNotFound = errors.New("cache: not found")
+
 type Func func(ctx context.Context) (value interface{}, err error)
 
+// Adapter 缓存适配器
+// duration == 0 表示永不过期, duration < 0 表示立即删除该key;
+// value 为 nil 时不会写入缓存, Get 对不存在的 key 返回 nil.
 type Adapter interface {
 	Set(ctx context.Context, key interface{}, value interface{}, duration time.Duration) error
 	SetIfNotExist(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (ok bool, err error)
 	SetIfNotExistFunc(ctx context.Context, key interface{}, f Func, duration time.Duration) (ok bool, err error)
-}
\ No newline at end of file
+	// Get 获取缓存, key 不存在或已过期时返回 nil
+	Get(ctx context.Context, key interface{}) (value interface{}, err error)
+	// GetOrSet key 存在时返回已有值, 否则写入 value 并返回 value
+	GetOrSet(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (result interface{}, err error)
+	Delete(ctx context.Context, keys ...interface{}) error
+	Contains(ctx context.Context, key interface{}) (bool, error)
+	Keys(ctx context.Context) (keys []interface{}, err error)
+	Size(ctx context.Context) (size int, err error)
+	Clear(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// TTLer 支持查询剩余有效期的适配器
+type TTLer interface {
+	// TTL 返回 key 的剩余有效期, 永不过期时为 0; key 不存在或已过期时 ok 为 false
+	TTL(ctx context.Context, key interface{}) (ttl time.Duration, ok bool, err error)
+}
+
+// KeyString 统一 key 的字符串形式, 各适配器保持一致的 key 语义
+func KeyString(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case []byte:
+		return string(k)
+	case fmt.Stringer:
+		return k.String()
+	default:
+		return fmt.Sprint(key)
+	}
+}
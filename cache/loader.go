@@ -0,0 +1,349 @@
+package cache
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLockTTL        = 5 * time.Second
+	defaultLockWait       = 3 * time.Second
+	defaultLockPoll       = 50 * time.Millisecond
+	defaultRefreshTimeout = 10 * time.Second
+	lockKeyPrefix         = "lock:"
+)
+
+// Locker 跨进程互斥, 用于避免多个进程同时执行同一个 Func
+type Locker interface {
+	// TryLock 非阻塞加锁, ok 为 false 表示锁已被其他进程持有
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(ctx context.Context) error, ok bool, err error)
+}
+
+type (
+	LoaderOptions struct {
+		locker   Locker
+		lockTTL  time.Duration
+		lockWait time.Duration
+		// XFetch 提前刷新系数, 0 表示不提前刷新, 越大越早刷新, 通常取 1
+		beta float64
+		// 逻辑过期后仍可返回旧值的时长, 期间在后台刷新
+		stale          time.Duration
+		refreshTimeout time.Duration
+		// 数据不存在时缓存空标记的时长, 0 表示不缓存
+		negativeTTL time.Duration
+		filter      Filter
+		// 过期时间随机增加的比例, 避免同一批写入的 key 同时过期
+		jitter float64
+		// 上报加载事件时使用的名称
+		namespace string
+		observer  Observer
+	}
+	LoaderOption func(o *LoaderOptions)
+)
+
+// DistributedLock 跨进程合并加载, 未抢到锁的进程在 wait 时间内等待其他进程写入结果
+func DistributedLock(locker Locker, ttl, wait time.Duration) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.locker = locker
+		o.lockTTL = ttl
+		o.lockWait = wait
+	}
+}
+
+// EarlyRefresh 按 XFetch 算法在过期前概率性地提前刷新
+func EarlyRefresh(beta float64) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.beta = beta
+	}
+}
+
+// StaleWhileRevalidate 过期后 stale 时间内返回旧值并在后台刷新
+func StaleWhileRevalidate(stale time.Duration) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.stale = stale
+	}
+}
+
+func RefreshTimeout(timeout time.Duration) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.refreshTimeout = timeout
+	}
+}
+
+// NegativeTTL Func 返回 nil 或 ErrNotFound 时缓存空标记, 防止缓存穿透
+func NegativeTTL(ttl time.Duration) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.negativeTTL = ttl
+	}
+}
+
+// Guard filter 判断 key 一定不存在时直接返回 ErrNotFound, 不访问缓存和 Func
+func Guard(filter Filter) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.filter = filter
+	}
+}
+
+// Observe 上报每次调用 Func 的耗时和结果
+func Observe(namespace string, observer Observer) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.namespace = namespace
+		o.observer = observer
+	}
+}
+
+// Jitter 过期时间在 [duration, duration*(1+ratio)) 内随机
+func Jitter(ratio float64) LoaderOption {
+	return func(o *LoaderOptions) {
+		o.jitter = ratio
+	}
+}
+
+// Loader 在 Adapter 之上提供防击穿的 GetOrLoad
+// 通过 Loader 写入的值带有加载耗时和逻辑过期时间, 这些 key 应只通过 GetOrLoad 读取
+type Loader struct {
+	adapter Adapter
+	opts    *LoaderOptions
+	group   group
+}
+
+// item 缓存中实际存储的值
+type item struct {
+	Value interface{} `json:"v" msgpack:"v"`
+	// 加载耗时, 纳秒
+	Delta int64 `json:"d" msgpack:"d"`
+	// 逻辑过期时间, unix 毫秒, 0 表示永不过期
+	ExpireAt int64 `json:"e" msgpack:"e"`
+	// 空标记, 表示数据源中不存在
+	Missing bool `json:"m,omitempty" msgpack:"m,omitempty"`
+}
+
+func init() {
+	gob.Register(item{})
+}
+
+var (
+	randMu sync.Mutex
+	rnd    = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func NewLoader(adapter Adapter, opts ...LoaderOption) *Loader {
+	o := &LoaderOptions{
+		lockTTL:        defaultLockTTL,
+		lockWait:       defaultLockWait,
+		refreshTimeout: defaultRefreshTimeout,
+		observer:       NopObserver{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Loader{adapter: adapter, opts: o}
+}
+
+// GetOrLoad 读取缓存, 未命中时调用 f 加载并写入, 同一 key 的并发加载只执行一次
+// 数据不存在时返回 ErrNotFound
+func (l *Loader) GetOrLoad(ctx context.Context, key interface{}, f Func, duration time.Duration) (value interface{}, err error) {
+	if l.opts.filter != nil && !l.opts.filter.MayContain(KeyString(key)) {
+		return nil, ErrNotFound
+	}
+	raw, err := l.adapter.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if it, ok := toItem(raw); ok {
+		now := time.Now()
+		switch {
+		case it.Missing:
+			if !it.expired(now) {
+				return nil, ErrNotFound
+			}
+		case !it.expired(now):
+			if l.opts.beta > 0 && it.refreshEarly(now, l.opts.beta) {
+				v, err := l.load(ctx, key, f, duration)
+				if err == nil || errors.Is(err, ErrNotFound) {
+					return v, err
+				}
+			}
+			return it.Value, nil
+		case l.opts.stale > 0:
+			go l.refresh(key, f, duration)
+			return it.Value, nil
+		}
+	}
+	return l.load(ctx, key, f, duration)
+}
+
+func (l *Loader) refresh(key interface{}, f Func, duration time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.refreshTimeout)
+	defer cancel()
+	_, _ = l.load(ctx, key, f, duration)
+}
+
+func (l *Loader) load(ctx context.Context, key interface{}, f Func, duration time.Duration) (interface{}, error) {
+	k := KeyString(key)
+	return l.group.Do(k, func() (interface{}, error) {
+		if l.opts.locker == nil {
+			return l.doLoad(ctx, key, f, duration)
+		}
+		unlock, ok, err := l.opts.locker.TryLock(ctx, lockKeyPrefix+k, l.opts.lockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			defer func() { _ = unlock(ctx) }()
+			return l.doLoad(ctx, key, f, duration)
+		}
+		// 其他进程正在加载, 等待其写入结果, 超时后自行加载
+		if it, ok := l.wait(ctx, key); ok {
+			if it.Missing {
+				return nil, ErrNotFound
+			}
+			return it.Value, nil
+		}
+		return l.doLoad(ctx, key, f, duration)
+	})
+}
+
+func (l *Loader) doLoad(ctx context.Context, key interface{}, f Func, duration time.Duration) (interface{}, error) {
+	start := time.Now()
+	value, err := f(ctx)
+	if value == nil && err == nil {
+		err = ErrNotFound
+	}
+	l.opts.observer.OnLoad(l.opts.namespace, time.Since(start), err)
+	if errors.Is(err, ErrNotFound) {
+		if l.opts.negativeTTL > 0 {
+			ttl := l.withJitter(l.opts.negativeTTL)
+			it := item{Missing: true, ExpireAt: time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)}
+			if err := l.adapter.Set(ctx, key, it, ttl); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	it := item{Value: value, Delta: int64(time.Since(start))}
+	ttl := duration
+	if duration > 0 {
+		duration = l.withJitter(duration)
+		it.ExpireAt = time.Now().Add(duration).UnixNano() / int64(time.Millisecond)
+		ttl = duration + l.opts.stale
+	}
+	if err = l.adapter.Set(ctx, key, it, ttl); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (l *Loader) withJitter(d time.Duration) time.Duration {
+	if l.opts.jitter <= 0 {
+		return d
+	}
+	return JitterTTL(d, l.opts.jitter)
+}
+
+func (l *Loader) wait(ctx context.Context, key interface{}) (*item, bool) {
+	ticker := time.NewTicker(defaultLockPoll)
+	defer ticker.Stop()
+	timer := time.NewTimer(l.opts.lockWait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-timer.C:
+			return nil, false
+		case <-ticker.C:
+			raw, err := l.adapter.Get(ctx, key)
+			if err != nil {
+				return nil, false
+			}
+			if it, ok := toItem(raw); ok && !it.expired(time.Now()) {
+				return it, true
+			}
+		}
+	}
+}
+
+func (it *item) expired(now time.Time) bool {
+	return it.ExpireAt > 0 && now.UnixNano()/int64(time.Millisecond) >= it.ExpireAt
+}
+
+// refreshEarly XFetch: now - delta * beta * ln(rand) >= expiry
+func (it *item) refreshEarly(now time.Time, beta float64) bool {
+	if it.ExpireAt == 0 {
+		return false
+	}
+	randMu.Lock()
+	r := rnd.Float64()
+	randMu.Unlock()
+	if r == 0 {
+		r = math.SmallestNonzeroFloat64
+	}
+	gap := time.Duration(-float64(it.Delta) * beta * math.Log(r))
+	return now.Add(gap).UnixNano()/int64(time.Millisecond) >= it.ExpireAt
+}
+
+// JitterTTL 在 [d, d*(1+ratio)) 内随机取过期时间
+func JitterTTL(d time.Duration, ratio float64) time.Duration {
+	if d <= 0 || ratio <= 0 {
+		return d
+	}
+	randMu.Lock()
+	r := rnd.Float64()
+	randMu.Unlock()
+	return d + time.Duration(float64(d)*ratio*r)
+}
+
+// toItem 还原 item, 远端缓存经 JSON/msgpack 解码后为 map
+func toItem(raw interface{}) (*item, bool) {
+	switch v := raw.(type) {
+	case item:
+		return &v, true
+	case *item:
+		return v, true
+	case map[string]interface{}:
+		value, ok := v["v"]
+		if !ok {
+			return nil, false
+		}
+		missing, _ := v["m"].(bool)
+		return &item{Value: value, Delta: toInt64(v["d"]), ExpireAt: toInt64(v["e"]), Missing: missing}, true
+	}
+	return nil, false
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	case float32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
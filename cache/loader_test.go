@@ -0,0 +1,211 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/local"
+)
+
+func TestLoaderSingleflight(t *testing.T) {
+	ctx := context.Background()
+	adapter := local.NewAdapterLocal()
+	defer adapter.Close(ctx)
+	loader := cache.NewLoader(adapter)
+
+	var calls int32
+	f := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return "v", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := loader.GetOrLoad(ctx, "k", f, time.Minute); err != nil || v != "v" {
+				t.Errorf("GetOrLoad = %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+}
+
+func TestLoaderPanic(t *testing.T) {
+	ctx := context.Background()
+	adapter := local.NewAdapterLocal()
+	defer adapter.Close(ctx)
+	loader := cache.NewLoader(adapter)
+
+	f := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		panic("boom")
+	}
+	// 执行者和等待者都应收到 panic, 而不是 nil, nil
+	var (
+		wg     sync.WaitGroup
+		panics int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					atomic.AddInt32(&panics, 1)
+				}
+			}()
+			v, err := loader.GetOrLoad(ctx, "k", f, time.Minute)
+			t.Errorf("GetOrLoad = %v, %v", v, err)
+		}()
+	}
+	wg.Wait()
+	if panics != 10 {
+		t.Fatalf("panics = %d", panics)
+	}
+
+	v, err := loader.GetOrLoad(ctx, "k", func(ctx context.Context) (interface{}, error) {
+		return "v", nil
+	}, time.Minute)
+	if err != nil || v != "v" {
+		t.Fatalf("GetOrLoad after panic = %v, %v", v, err)
+	}
+}
+
+func TestLoaderStaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	adapter := local.NewAdapterLocal()
+	defer adapter.Close(ctx)
+	loader := cache.NewLoader(adapter, cache.StaleWhileRevalidate(time.Minute))
+
+	var calls int32
+	f := func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	if v, _ := loader.GetOrLoad(ctx, "k", f, 10*time.Millisecond); v != int32(1) {
+		t.Fatalf("first load = %v", v)
+	}
+	time.Sleep(20 * time.Millisecond)
+	// 过期后立即返回旧值, 后台刷新
+	if v, _ := loader.GetOrLoad(ctx, "k", f, 10*time.Millisecond); v != int32(1) {
+		t.Fatalf("stale value = %v", v)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoaderEarlyRefresh(t *testing.T) {
+	ctx := context.Background()
+	adapter := local.NewAdapterLocal()
+	defer adapter.Close(ctx)
+	// beta 极大时总是提前刷新
+	loader := cache.NewLoader(adapter, cache.EarlyRefresh(1e12))
+
+	var calls int32
+	f := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	_, _ = loader.GetOrLoad(ctx, "k", f, time.Hour)
+	if v, _ := loader.GetOrLoad(ctx, "k", f, time.Hour); v != int32(2) {
+		t.Fatalf("early refresh value = %v", v)
+	}
+
+	loader = cache.NewLoader(adapter)
+	if v, _ := loader.GetOrLoad(ctx, "k", f, time.Hour); v != int32(2) {
+		t.Fatalf("cached value = %v", v)
+	}
+}
+
+func TestLoaderNegativeCache(t *testing.T) {
+	ctx := context.Background()
+	adapter := local.NewAdapterLocal()
+	defer adapter.Close(ctx)
+	loader := cache.NewLoader(adapter, cache.NegativeTTL(20*time.Millisecond))
+
+	var calls int32
+	f := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, cache.ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := loader.GetOrLoad(ctx, "missing", f, time.Minute); !errors.Is(err, cache.ErrNotFound) {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+	time.Sleep(30 * time.Millisecond)
+	_, _ = loader.GetOrLoad(ctx, "missing", f, time.Minute)
+	if calls != 2 {
+		t.Fatalf("negative entry did not expire, calls = %d", calls)
+	}
+}
+
+func TestLoaderGuard(t *testing.T) {
+	ctx := context.Background()
+	adapter := local.NewAdapterLocal()
+	defer adapter.Close(ctx)
+	filter := cache.NewBloomFilter(1000, 0.01)
+	filter.Add("user:1")
+	loader := cache.NewLoader(adapter, cache.Guard(filter))
+
+	f := func(ctx context.Context) (interface{}, error) {
+		return "v", nil
+	}
+	if v, err := loader.GetOrLoad(ctx, "user:1", f, time.Minute); err != nil || v != "v" {
+		t.Fatalf("GetOrLoad = %v, %v", v, err)
+	}
+	_, err := loader.GetOrLoad(ctx, "user:2", func(ctx context.Context) (interface{}, error) {
+		t.Fatal("loader called for key rejected by filter")
+		return nil, nil
+	}, time.Minute)
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := cache.NewBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.Add(strconv.Itoa(i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !filter.MayContain(strconv.Itoa(i)) {
+			t.Fatalf("false negative for %d", i)
+		}
+	}
+	fp := 0
+	for i := 10000; i < 20000; i++ {
+		if filter.MayContain(strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Fatalf("false positive rate too high: %d/10000", fp)
+	}
+}
+
+func TestJitterTTL(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := cache.JitterTTL(time.Minute, 0.1); d < time.Minute || d >= 66*time.Second {
+			t.Fatalf("jitter out of range: %v", d)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package local
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// evictor 维护分片内 key 的淘汰顺序, 调用方需持有分片锁
+type evictor interface {
+	add(e *entry)
+	touch(e *entry)
+	remove(e *entry)
+	victim() *entry
+}
+
+func newEvictor(policy EvictionPolicy) evictor {
+	if policy == LFU {
+		return &lfu{}
+	}
+	return &lru{ll: list.New()}
+}
+
+type lru struct {
+	ll *list.List
+}
+
+func (l *lru) add(e *entry) {
+	e.elem = l.ll.PushFront(e)
+}
+
+func (l *lru) touch(e *entry) {
+	l.ll.MoveToFront(e.elem)
+}
+
+func (l *lru) remove(e *entry) {
+	l.ll.Remove(e.elem)
+	e.elem = nil
+}
+
+func (l *lru) victim() *entry {
+	if back := l.ll.Back(); back != nil {
+		return back.Value.(*entry)
+	}
+	return nil
+}
+
+// lfu 按访问次数排序的小顶堆, 次数相同时淘汰更早访问的 key
+type lfu struct {
+	entries []*entry
+	tick    uint64
+}
+
+func (l *lfu) Len() int { return len(l.entries) }
+
+func (l *lfu) Less(i, j int) bool {
+	a, b := l.entries[i], l.entries[j]
+	if a.freq == b.freq {
+		return a.tick < b.tick
+	}
+	return a.freq < b.freq
+}
+
+func (l *lfu) Swap(i, j int) {
+	l.entries[i], l.entries[j] = l.entries[j], l.entries[i]
+	l.entries[i].index = i
+	l.entries[j].index = j
+}
+
+func (l *lfu) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(l.entries)
+	l.entries = append(l.entries, e)
+}
+
+func (l *lfu) Pop() interface{} {
+	n := len(l.entries)
+	e := l.entries[n-1]
+	l.entries[n-1] = nil
+	l.entries = l.entries[:n-1]
+	e.index = -1
+	return e
+}
+
+func (l *lfu) add(e *entry) {
+	l.tick++
+	e.freq, e.tick = 1, l.tick
+	heap.Push(l, e)
+}
+
+func (l *lfu) touch(e *entry) {
+	l.tick++
+	e.freq++
+	e.tick = l.tick
+	heap.Fix(l, e.index)
+}
+
+func (l *lfu) remove(e *entry) {
+	heap.Remove(l, e.index)
+}
+
+func (l *lfu) victim() *entry {
+	if len(l.entries) == 0 {
+		return nil
+	}
+	return l.entries[0]
+}
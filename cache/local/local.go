@@ -1,29 +1,340 @@
 package local
 
 import (
+	"container/list"
 	"context"
-	"github.com/davveo/go-toolkit/cache"
+	"hash/fnv"
+	"sync"
 	"time"
+
+	"github.com/davveo/go-toolkit/cache"
 )
 
 type AdapterLocal struct {
+	shards    []*shard
+	mask      uint32
+	namespace string
+	observer  cache.Observer
+	tags      *tagIndex
+	stop      chan struct{}
+	once      sync.Once
+}
+
+type shard struct {
+	mu       sync.Mutex
+	items    map[string]*entry
+	capacity int
+	policy   EvictionPolicy
+	evictor  evictor
+	tags     *tagIndex
+}
+
+type entry struct {
+	key      string
+	value    interface{}
+	expireAt int64 // unix nano, 0 表示永不过期
+	tags     []string
+
+	elem  *list.Element // lru
+	freq  uint64        // lfu
+	tick  uint64        // lfu
+	index int           // lfu
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expireAt > 0 && now >= e.expireAt
+}
+
+func NewAdapterLocal(opts ...Option) cache.Adapter {
+	o := &Options{
+		shards:          defaultShards,
+		cleanupInterval: defaultCleanupInterval,
+		policy:          LRU,
+		observer:        cache.NopObserver{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	n := 1
+	for n < o.shards {
+		n <<= 1
+	}
+	// 容量平均分配到各分片
+	perShard := 0
+	if o.capacity > 0 {
+		perShard = (o.capacity + n - 1) / n
+	}
+
+	a := &AdapterLocal{
+		shards:    make([]*shard, n),
+		mask:      uint32(n - 1),
+		namespace: o.namespace,
+		observer:  o.observer,
+		tags:      newTagIndex(),
+		stop:      make(chan struct{}),
+	}
+	for i := range a.shards {
+		a.shards[i] = &shard{
+			items:    make(map[string]*entry),
+			capacity: perShard,
+			policy:   o.policy,
+			evictor:  newEvictor(o.policy),
+			tags:     a.tags,
+		}
+	}
+	if o.cleanupInterval > 0 {
+		go a.janitor(o.cleanupInterval)
+	}
+	return a
+}
+
+func (a *AdapterLocal) Set(ctx context.Context, key interface{}, value interface{}, duration time.Duration) error {
+	k := cache.KeyString(key)
+	s := a.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == nil || duration < 0 {
+		s.delete(k)
+		return nil
+	}
+	a.evicted(s.set(k, value, duration))
+	return nil
+}
+
+func (a *AdapterLocal) SetIfNotExist(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (ok bool, err error) {
+	if value == nil || duration < 0 {
+		return false, nil
+	}
+	k := cache.KeyString(key)
+	s := a.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.get(k, time.Now().UnixNano()) != nil {
+		return false, nil
+	}
+	a.evicted(s.set(k, value, duration))
+	return true, nil
+}
+
+// SetIfNotExistFunc f 在锁外执行, 执行期间 key 被其他调用写入时放弃本次结果
+func (a *AdapterLocal) SetIfNotExistFunc(ctx context.Context, key interface{}, f cache.Func, duration time.Duration) (ok bool, err error) {
+	exist, err := a.Contains(ctx, key)
+	if err != nil || exist {
+		return false, err
+	}
+	value, err := f(ctx)
+	if err != nil {
+		return false, err
+	}
+	return a.SetIfNotExist(ctx, key, value, duration)
+}
+
+func (a *AdapterLocal) Get(ctx context.Context, key interface{}) (value interface{}, err error) {
+	k := cache.KeyString(key)
+	s := a.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.get(k, time.Now().UnixNano()); e != nil {
+		s.evictor.touch(e)
+		a.observer.OnHit(a.namespace)
+		return e.value, nil
+	}
+	a.observer.OnMiss(a.namespace)
+	return nil, nil
+}
+
+func (a *AdapterLocal) GetOrSet(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (result interface{}, err error) {
+	k := cache.KeyString(key)
+	s := a.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.get(k, time.Now().UnixNano()); e != nil {
+		s.evictor.touch(e)
+		a.observer.OnHit(a.namespace)
+		return e.value, nil
+	}
+	a.observer.OnMiss(a.namespace)
+	if value != nil && duration >= 0 {
+		a.evicted(s.set(k, value, duration))
+	}
+	return value, nil
+}
+
+func (a *AdapterLocal) Delete(ctx context.Context, keys ...interface{}) error {
+	for _, key := range keys {
+		k := cache.KeyString(key)
+		s := a.shard(k)
+		s.mu.Lock()
+		s.delete(k)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func (a *AdapterLocal) Contains(ctx context.Context, key interface{}) (bool, error) {
+	k := cache.KeyString(key)
+	s := a.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(k, time.Now().UnixNano()) != nil, nil
+}
+
+var _ cache.TTLer = (*AdapterLocal)(nil)
+
+func (a *AdapterLocal) TTL(ctx context.Context, key interface{}) (ttl time.Duration, ok bool, err error) {
+	k := cache.KeyString(key)
+	s := a.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UnixNano()
+	e := s.get(k, now)
+	if e == nil {
+		return 0, false, nil
+	}
+	if e.expireAt == 0 {
+		return 0, true, nil
+	}
+	return time.Duration(e.expireAt - now), true, nil
+}
+
+func (a *AdapterLocal) Keys(ctx context.Context) (keys []interface{}, err error) {
+	now := time.Now().UnixNano()
+	for _, s := range a.shards {
+		s.mu.Lock()
+		for k, e := range s.items {
+			if !e.expired(now) {
+				keys = append(keys, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return keys, nil
+}
+
+func (a *AdapterLocal) Size(ctx context.Context) (size int, err error) {
+	now := time.Now().UnixNano()
+	for _, s := range a.shards {
+		s.mu.Lock()
+		for _, e := range s.items {
+			if !e.expired(now) {
+				size++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return size, nil
+}
+
+func (a *AdapterLocal) Clear(ctx context.Context) error {
+	for _, s := range a.shards {
+		s.mu.Lock()
+		s.items = make(map[string]*entry)
+		s.evictor = newEvictor(s.policy)
+		s.mu.Unlock()
+	}
+	a.tags.reset()
+	return nil
+}
+
+// Close 停止后台清理并清空缓存
+func (a *AdapterLocal) Close(ctx context.Context) error {
+	a.once.Do(func() {
+		close(a.stop)
+	})
+	return a.Clear(ctx)
+}
+
+func (a *AdapterLocal) shard(key string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return a.shards[h.Sum32()&a.mask]
+}
+
+func (a *AdapterLocal) evicted(n int) {
+	if n > 0 {
+		a.observer.OnEvict(a.namespace, n)
+	}
+}
+
+func (a *AdapterLocal) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			for _, s := range a.shards {
+				s.mu.Lock()
+				s.deleteExpired(time.Now().UnixNano())
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// get 返回未过期的 entry, 顺带删除已过期的 entry
+func (s *shard) get(key string, now int64) *entry {
+	e, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(now) {
+		s.remove(e)
+		return nil
+	}
+	return e
 }
 
-func NewAdapterRedis() cache.Adapter {
-	return &AdapterLocal{}
+// set 写入 entry 并替换其标签, 返回因容量不足淘汰的数量
+func (s *shard) set(key string, value interface{}, duration time.Duration, tags ...string) (evicted int) {
+	var expireAt int64
+	if duration > 0 {
+		expireAt = time.Now().Add(duration).UnixNano()
+	}
+	if e, ok := s.items[key]; ok {
+		if len(e.tags) > 0 {
+			s.tags.remove(key, e.tags)
+		}
+		e.value, e.expireAt, e.tags = value, expireAt, tags
+		if len(tags) > 0 {
+			s.tags.add(key, tags)
+		}
+		s.evictor.touch(e)
+		return 0
+	}
+	for s.capacity > 0 && len(s.items) >= s.capacity {
+		s.remove(s.evictor.victim())
+		evicted++
+	}
+	e := &entry{key: key, value: value, expireAt: expireAt, tags: tags}
+	s.items[key] = e
+	s.evictor.add(e)
+	if len(tags) > 0 {
+		s.tags.add(key, tags)
+	}
+	return evicted
 }
 
-func (a AdapterLocal) Set(ctx context.Context, key interface{}, value interface{}, duration time.Duration) error {
-	//TODO implement me
-	panic("implement me")
+func (s *shard) delete(key string) {
+	if e, ok := s.items[key]; ok {
+		s.remove(e)
+	}
 }
 
-func (a AdapterLocal) SetIfNotExist(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (ok bool, err error) {
-	//TODO implement me
-	panic("implement me")
+func (s *shard) remove(e *entry) {
+	delete(s.items, e.key)
+	s.evictor.remove(e)
+	if len(e.tags) > 0 {
+		s.tags.remove(e.key, e.tags)
+	}
 }
 
-func (a AdapterLocal) SetIfNotExistFunc(ctx context.Context, key interface{}, f cache.Func, duration time.Duration) (ok bool, err error) {
-	//TODO implement me
-	panic("implement me")
+func (s *shard) deleteExpired(now int64) {
+	for _, e := range s.items {
+		if e.expired(now) {
+			s.remove(e)
+		}
+	}
 }
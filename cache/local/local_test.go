@@ -0,0 +1,152 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+)
+
+func TestAdapterLocal(t *testing.T) {
+	ctx := context.Background()
+	c := NewAdapterLocal()
+	defer c.Close(ctx)
+
+	if err := c.Set(ctx, "k1", "v1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Get(ctx, "k1"); v != "v1" {
+		t.Fatalf("get k1 = %v", v)
+	}
+	if ok, _ := c.SetIfNotExist(ctx, "k1", "v2", 0); ok {
+		t.Fatal("SetIfNotExist overwrote existing key")
+	}
+	if v, _ := c.GetOrSet(ctx, "k2", "v2", 0); v != "v2" {
+		t.Fatalf("GetOrSet k2 = %v", v)
+	}
+	if v, _ := c.GetOrSet(ctx, "k2", "v3", 0); v != "v2" {
+		t.Fatalf("GetOrSet k2 = %v", v)
+	}
+	if size, _ := c.Size(ctx); size != 2 {
+		t.Fatalf("size = %d", size)
+	}
+	if keys, _ := c.Keys(ctx); len(keys) != 2 {
+		t.Fatalf("keys = %v", keys)
+	}
+	_ = c.Delete(ctx, "k1")
+	if ok, _ := c.Contains(ctx, "k1"); ok {
+		t.Fatal("k1 still exists after delete")
+	}
+	_ = c.Clear(ctx)
+	if size, _ := c.Size(ctx); size != 0 {
+		t.Fatalf("size after clear = %d", size)
+	}
+}
+
+func TestAdapterLocalTTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewAdapterLocal(CleanupInterval(10 * time.Millisecond))
+	defer c.Close(ctx)
+
+	_ = c.Set(ctx, "k", "v", 20*time.Millisecond)
+	if ok, _ := c.Contains(ctx, "k"); !ok {
+		t.Fatal("k missing before expiry")
+	}
+	if ttl, ok, _ := c.(cache.TTLer).TTL(ctx, "k"); !ok || ttl <= 0 || ttl > 20*time.Millisecond {
+		t.Fatalf("TTL(k) = %v, %v", ttl, ok)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if v, _ := c.Get(ctx, "k"); v != nil {
+		t.Fatalf("k = %v after expiry", v)
+	}
+	a := c.(*AdapterLocal)
+	s := a.shard("k")
+	s.mu.Lock()
+	n := len(s.items)
+	s.mu.Unlock()
+	if n != 0 {
+		t.Fatal("janitor did not remove expired entry")
+	}
+}
+
+func TestAdapterLocalSetIfNotExistFunc(t *testing.T) {
+	ctx := context.Background()
+	c := NewAdapterLocal()
+	defer c.Close(ctx)
+
+	calls := 0
+	f := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return "loaded", nil
+	}
+	if ok, err := c.SetIfNotExistFunc(ctx, "k", f, 0); !ok || err != nil {
+		t.Fatalf("first SetIfNotExistFunc = %v, %v", ok, err)
+	}
+	if ok, _ := c.SetIfNotExistFunc(ctx, "k", f, 0); ok {
+		t.Fatal("second SetIfNotExistFunc should not set")
+	}
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+
+	loadErr := errors.New("load failed")
+	_, err := c.SetIfNotExistFunc(ctx, "other", func(ctx context.Context) (interface{}, error) {
+		return nil, loadErr
+	}, 0)
+	if !errors.Is(err, loadErr) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestAdapterLocalEviction(t *testing.T) {
+	ctx := context.Background()
+
+	lruCache := NewAdapterLocal(Shards(1), Capacity(3), Policy(LRU))
+	defer lruCache.Close(ctx)
+	for i := 0; i < 3; i++ {
+		_ = lruCache.Set(ctx, i, i, 0)
+	}
+	_, _ = lruCache.Get(ctx, 0)
+	_ = lruCache.Set(ctx, 3, 3, 0)
+	if ok, _ := lruCache.Contains(ctx, 1); ok {
+		t.Fatal("lru should evict least recently used key 1")
+	}
+	if ok, _ := lruCache.Contains(ctx, 0); !ok {
+		t.Fatal("lru evicted recently used key 0")
+	}
+
+	lfuCache := NewAdapterLocal(Shards(1), Capacity(3), Policy(LFU))
+	defer lfuCache.Close(ctx)
+	for i := 0; i < 3; i++ {
+		_ = lfuCache.Set(ctx, i, i, 0)
+	}
+	for i := 0; i < 3; i++ {
+		_, _ = lfuCache.Get(ctx, 0)
+		_, _ = lfuCache.Get(ctx, 2)
+	}
+	_ = lfuCache.Set(ctx, 3, 3, 0)
+	if ok, _ := lfuCache.Contains(ctx, 1); ok {
+		t.Fatal("lfu should evict least frequently used key 1")
+	}
+	if size, _ := lfuCache.Size(ctx); size != 3 {
+		t.Fatalf("size = %d", size)
+	}
+}
+
+func BenchmarkAdapterLocalSetGet(b *testing.B) {
+	ctx := context.Background()
+	c := NewAdapterLocal(Capacity(10000))
+	defer c.Close(ctx)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := fmt.Sprintf("key-%d", i%20000)
+			_ = c.Set(ctx, key, i, time.Minute)
+			_, _ = c.Get(ctx, key)
+			i++
+		}
+	})
+}
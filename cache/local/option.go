@@ -0,0 +1,74 @@
+package local
+
+import (
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+)
+
+type EvictionPolicy int8
+
+const (
+	// LRU 淘汰最久未访问的 key
+	LRU EvictionPolicy = iota + 1
+	// LFU 淘汰访问次数最少的 key
+	LFU
+)
+
+const (
+	defaultShards          = 32
+	defaultCleanupInterval = time.Minute
+)
+
+type (
+	Options struct {
+		// 分片数量, 会向上取整为2的幂
+		shards int
+		// 最大容量, 0 表示不限制
+		capacity int
+		// 过期清理间隔, <= 0 时不启动后台清理, 仅在访问时惰性删除
+		cleanupInterval time.Duration
+		// 超出容量时的淘汰策略
+		policy EvictionPolicy
+		// 上报命中/未命中/淘汰事件时使用的名称
+		namespace string
+		observer  cache.Observer
+	}
+	Option func(o *Options)
+)
+
+func Shards(shards int) Option {
+	return func(o *Options) {
+		o.shards = shards
+	}
+}
+
+func Capacity(capacity int) Option {
+	return func(o *Options) {
+		o.capacity = capacity
+	}
+}
+
+func CleanupInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.cleanupInterval = interval
+	}
+}
+
+func Policy(policy EvictionPolicy) Option {
+	return func(o *Options) {
+		o.policy = policy
+	}
+}
+
+func Namespace(namespace string) Option {
+	return func(o *Options) {
+		o.namespace = namespace
+	}
+}
+
+func Observer(observer cache.Observer) Option {
+	return func(o *Options) {
+		o.observer = observer
+	}
+}
@@ -0,0 +1,115 @@
+package local
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+)
+
+var _ cache.Tagger = (*AdapterLocal)(nil)
+
+// tagIndex 标签到 key 的索引, 加锁顺序为先分片锁后索引锁
+type tagIndex struct {
+	mu sync.Mutex
+	m  map[string]map[string]struct{}
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{m: make(map[string]map[string]struct{})}
+}
+
+func (t *tagIndex) add(key string, tags []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tag := range tags {
+		keys, ok := t.m[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.m[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (t *tagIndex) remove(key string, tags []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tag := range tags {
+		if keys, ok := t.m[tag]; ok {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(t.m, tag)
+			}
+		}
+	}
+}
+
+func (t *tagIndex) keys(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.m[tag]))
+	for key := range t.m[tag] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (t *tagIndex) reset() {
+	t.mu.Lock()
+	t.m = make(map[string]map[string]struct{})
+	t.mu.Unlock()
+}
+
+func (a *AdapterLocal) SetWithTags(ctx context.Context, key interface{}, value interface{}, duration time.Duration, tags ...string) error {
+	k := cache.KeyString(key)
+	s := a.shard(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == nil || duration < 0 {
+		s.delete(k)
+		return nil
+	}
+	a.evicted(s.set(k, value, duration, tags...))
+	return nil
+}
+
+func (a *AdapterLocal) InvalidateTag(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		for _, key := range a.tags.keys(tag) {
+			s := a.shard(key)
+			s.mu.Lock()
+			s.delete(key)
+			s.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func (a *AdapterLocal) KeysByTag(ctx context.Context, tag string) (keys []interface{}, err error) {
+	now := time.Now().UnixNano()
+	for _, key := range a.tags.keys(tag) {
+		s := a.shard(key)
+		s.mu.Lock()
+		if s.get(key, now) != nil {
+			keys = append(keys, key)
+		}
+		s.mu.Unlock()
+	}
+	return keys, nil
+}
+
+func (a *AdapterLocal) DeleteByPrefix(ctx context.Context, prefix string) error {
+	for _, s := range a.shards {
+		s.mu.Lock()
+		for k, e := range s.items {
+			if strings.HasPrefix(k, prefix) {
+				s.remove(e)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdapterLocalTags(t *testing.T) {
+	ctx := context.Background()
+	c := NewAdapterLocal().(*AdapterLocal)
+	defer c.Close(ctx)
+
+	_ = c.SetWithTags(ctx, "user:1:profile", "p1", time.Minute, "user:1")
+	_ = c.SetWithTags(ctx, "user:1:orders", "o1", time.Minute, "user:1", "orders")
+	_ = c.SetWithTags(ctx, "user:2:orders", "o2", time.Minute, "user:2", "orders")
+	_ = c.Set(ctx, "other", "x", 0)
+
+	if keys, _ := c.KeysByTag(ctx, "orders"); len(keys) != 2 {
+		t.Fatalf("orders keys = %v", keys)
+	}
+	_ = c.InvalidateTag(ctx, "user:1")
+	for _, key := range []string{"user:1:profile", "user:1:orders"} {
+		if ok, _ := c.Contains(ctx, key); ok {
+			t.Fatalf("%s survived tag invalidation", key)
+		}
+	}
+	if keys, _ := c.KeysByTag(ctx, "orders"); len(keys) != 1 {
+		t.Fatalf("orders keys after invalidation = %v", keys)
+	}
+
+	// 覆盖写入时替换标签
+	_ = c.Set(ctx, "user:2:orders", "o2", time.Minute)
+	if keys, _ := c.KeysByTag(ctx, "user:2"); len(keys) != 0 {
+		t.Fatalf("stale tag index = %v", keys)
+	}
+
+	_ = c.Set(ctx, "user:3:a", "a", 0)
+	_ = c.Set(ctx, "user:3:b", "b", 0)
+	_ = c.DeleteByPrefix(ctx, "user:")
+	if size, _ := c.Size(ctx); size != 1 {
+		t.Fatalf("size after DeleteByPrefix = %d", size)
+	}
+	if len(c.tags.m) != 0 {
+		t.Fatalf("tag index not cleaned: %v", c.tags.m)
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	resultOK       = "ok"
+	resultNotFound = "not_found"
+	resultError    = "error"
+)
+
+// Prometheus 同时实现 cache.Observer 和 prometheus.Collector
+//
+//	collector := metrics.NewPrometheus("app")
+//	prometheus.MustRegister(collector)
+//	adapter := local.NewAdapterLocal(local.Namespace("user"), local.Observer(collector))
+type Prometheus struct {
+	hits      *prometheus.CounterVec
+	misses    *prometheus.CounterVec
+	loads     *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	evictions *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	backfills *prometheus.CounterVec
+}
+
+var (
+	_ cache.Observer         = (*Prometheus)(nil)
+	_ cache.BackfillObserver = (*Prometheus)(nil)
+)
+
+// NewPrometheus namespace 为指标名前缀, 缓存自身的 namespace 作为 label
+func NewPrometheus(namespace string) *Prometheus {
+	labels := []string{"cache"}
+	return &Prometheus{
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "hits_total",
+			Help: "Number of cache hits.",
+		}, labels),
+		misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "misses_total",
+			Help: "Number of cache misses.",
+		}, labels),
+		loads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "loads_total",
+			Help: "Number of loader invocations by result.",
+		}, append(labels, "result")),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "load_duration_seconds",
+			Help:    "Loader latency in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		evictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "evictions_total",
+			Help: "Number of entries evicted due to capacity.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "errors_total",
+			Help: "Number of cache backend errors.",
+		}, labels),
+		backfills: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "backfills_total",
+			Help: "Number of entries read from a lower level and written back to an upper level.",
+		}, labels),
+	}
+}
+
+func (p *Prometheus) OnHit(namespace string) {
+	p.hits.WithLabelValues(namespace).Inc()
+}
+
+func (p *Prometheus) OnMiss(namespace string) {
+	p.misses.WithLabelValues(namespace).Inc()
+}
+
+func (p *Prometheus) OnLoad(namespace string, latency time.Duration, err error) {
+	result := resultOK
+	switch {
+	case errors.Is(err, cache.ErrNotFound):
+		result = resultNotFound
+	case err != nil:
+		result = resultError
+	}
+	p.loads.WithLabelValues(namespace, result).Inc()
+	p.latency.WithLabelValues(namespace).Observe(latency.Seconds())
+}
+
+func (p *Prometheus) OnEvict(namespace string, n int) {
+	p.evictions.WithLabelValues(namespace).Add(float64(n))
+}
+
+func (p *Prometheus) OnError(namespace string, err error) {
+	p.errors.WithLabelValues(namespace).Inc()
+}
+
+func (p *Prometheus) OnBackfill(namespace string) {
+	p.backfills.WithLabelValues(namespace).Inc()
+}
+
+func (p *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	p.hits.Describe(ch)
+	p.misses.Describe(ch)
+	p.loads.Describe(ch)
+	p.latency.Describe(ch)
+	p.evictions.Describe(ch)
+	p.errors.Describe(ch)
+	p.backfills.Describe(ch)
+}
+
+func (p *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	p.hits.Collect(ch)
+	p.misses.Collect(ch)
+	p.loads.Collect(ch)
+	p.latency.Collect(ch)
+	p.evictions.Collect(ch)
+	p.errors.Collect(ch)
+	p.backfills.Collect(ch)
+}
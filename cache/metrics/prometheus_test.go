@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/local"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheus(t *testing.T) {
+	ctx := context.Background()
+	collector := NewPrometheus("test")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	adapter := local.NewAdapterLocal(local.Shards(1), local.Capacity(1),
+		local.Namespace("user"), local.Observer(collector))
+	defer adapter.Close(ctx)
+	loader := cache.NewLoader(adapter, cache.Observe("user", collector))
+
+	_, _ = loader.GetOrLoad(ctx, "a", func(ctx context.Context) (interface{}, error) {
+		return "a", nil
+	}, time.Minute)
+	_, _ = loader.GetOrLoad(ctx, "a", func(ctx context.Context) (interface{}, error) {
+		return "a", nil
+	}, time.Minute)
+	_, _ = loader.GetOrLoad(ctx, "b", func(ctx context.Context) (interface{}, error) {
+		return nil, nil
+	}, time.Minute)
+	_ = adapter.Set(ctx, "c", "c", 0)
+
+	if v := testutil.ToFloat64(collector.hits.WithLabelValues("user")); v != 1 {
+		t.Fatalf("hits = %v", v)
+	}
+	if v := testutil.ToFloat64(collector.misses.WithLabelValues("user")); v != 2 {
+		t.Fatalf("misses = %v", v)
+	}
+	if v := testutil.ToFloat64(collector.loads.WithLabelValues("user", resultOK)); v != 1 {
+		t.Fatalf("ok loads = %v", v)
+	}
+	if v := testutil.ToFloat64(collector.loads.WithLabelValues("user", resultNotFound)); v != 1 {
+		t.Fatalf("not found loads = %v", v)
+	}
+	if v := testutil.ToFloat64(collector.evictions.WithLabelValues("user")); v != 1 {
+		t.Fatalf("evictions = %v", v)
+	}
+	if n, err := testutil.GatherAndCount(registry); err != nil || n == 0 {
+		t.Fatalf("gather = %d, %v", n, err)
+	}
+}
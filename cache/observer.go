@@ -0,0 +1,75 @@
+package cache
+
+import "time"
+
+// Observer 缓存事件回调, namespace 用于区分不同的缓存实例
+// 实现需要并发安全, 且不应阻塞调用方
+type Observer interface {
+	OnHit(namespace string)
+	OnMiss(namespace string)
+	// OnLoad Loader 调用 Func 的耗时和结果
+	OnLoad(namespace string, latency time.Duration, err error)
+	// OnEvict 因容量不足被淘汰的 key 数量
+	OnEvict(namespace string, n int)
+	OnError(namespace string, err error)
+}
+
+// BackfillObserver Observer 的可选扩展, 多级缓存从下一级读取后回填上一级时回调
+type BackfillObserver interface {
+	OnBackfill(namespace string)
+}
+
+// NopObserver 不做任何处理的 Observer
+type NopObserver struct{}
+
+func (NopObserver) OnHit(string)                        {}
+func (NopObserver) OnMiss(string)                       {}
+func (NopObserver) OnLoad(string, time.Duration, error) {}
+func (NopObserver) OnEvict(string, int)                 {}
+func (NopObserver) OnError(string, error)               {}
+func (NopObserver) OnBackfill(string)                   {}
+
+type observers []Observer
+
+// Observers 组合多个 Observer
+func Observers(obs ...Observer) Observer {
+	return observers(obs)
+}
+
+func (o observers) OnHit(namespace string) {
+	for _, ob := range o {
+		ob.OnHit(namespace)
+	}
+}
+
+func (o observers) OnMiss(namespace string) {
+	for _, ob := range o {
+		ob.OnMiss(namespace)
+	}
+}
+
+func (o observers) OnLoad(namespace string, latency time.Duration, err error) {
+	for _, ob := range o {
+		ob.OnLoad(namespace, latency, err)
+	}
+}
+
+func (o observers) OnEvict(namespace string, n int) {
+	for _, ob := range o {
+		ob.OnEvict(namespace, n)
+	}
+}
+
+func (o observers) OnError(namespace string, err error) {
+	for _, ob := range o {
+		ob.OnError(namespace, err)
+	}
+}
+
+func (o observers) OnBackfill(namespace string) {
+	for _, ob := range o {
+		if b, ok := ob.(BackfillObserver); ok {
+			b.OnBackfill(namespace)
+		}
+	}
+}
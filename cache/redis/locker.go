@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	goredis "github.com/go-redis/redis/v7"
+	"github.com/google/uuid"
+)
+
+// unlockScript 仅删除自己持有的锁
+const unlockScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`
+
+type locker struct {
+	client goredis.UniversalClient
+}
+
+// NewLocker 基于 SET NX PX 的简单互斥, 供 cache.Loader 跨进程合并加载使用
+func NewLocker(client goredis.UniversalClient) cache.Locker {
+	return &locker{client: client}
+}
+
+func (l *locker) TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(ctx context.Context) error, ok bool, err error) {
+	token := uuid.New().String()
+	err = l.client.ProcessContext(ctx, goredis.NewStatusCmd("set", key, token, "px", milliseconds(ttl), "nx"))
+	if errors.Is(err, goredis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	unlock = func(ctx context.Context) error {
+		return l.client.ProcessContext(ctx, goredis.NewCmd("eval", unlockScript, 1, key, token))
+	}
+	return unlock, true, nil
+}
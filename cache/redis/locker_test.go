@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/cache"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	l := NewLocker(goredis.NewClient(&goredis.Options{Addr: s.Addr()}))
+
+	unlock, ok, err := l.TryLock(ctx, "lock", time.Second)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if _, ok, _ = l.TryLock(ctx, "lock", time.Second); ok {
+		t.Fatal("lock acquired twice")
+	}
+	if err = unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ = l.TryLock(ctx, "lock", time.Second); !ok {
+		t.Fatal("lock not released")
+	}
+}
+
+func TestLoaderAcrossProcesses(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var calls int32
+	f := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return "v", nil
+	}
+	// 每个 Loader 模拟一个进程
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		adapter := NewAdapterRedis(Addr(s.Addr()))
+		defer adapter.Close(ctx)
+		locker := NewLocker(goredis.NewClient(&goredis.Options{Addr: s.Addr()}))
+		loader := cache.NewLoader(adapter, cache.DistributedLock(locker, time.Second, time.Second))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := loader.GetOrLoad(ctx, "k", f, time.Minute); err != nil || v != "v" {
+				t.Errorf("GetOrLoad = %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+}
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/codec"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+const (
+	defaultAddr = "127.0.0.1:6379"
+	scanCount   = 256
+)
+
+type mode int8
+
+const (
+	modeStandalone mode = iota + 1
+	modeSentinel
+	modeCluster
+)
+
+type (
+	Options struct {
+		mode       mode
+		addrs      []string
+		masterName string
+		db         int
+		password   string
+		poolSize   int
+		// 所有 key 的公共前缀, Keys/Size/Clear 只作用于该前缀下的 key
+		prefix string
+		codec  codec.Codec
+		// 外部传入的客户端, 设置后忽略连接相关配置
+		client goredis.UniversalClient
+		// 上报命中/未命中/错误事件时使用的名称
+		namespace string
+		observer  cache.Observer
+	}
+	Option func(o *Options)
+)
+
+func Addr(addr string) Option {
+	return func(o *Options) {
+		o.mode = modeStandalone
+		o.addrs = []string{addr}
+	}
+}
+
+// Sentinel 哨兵模式, addrs 为哨兵节点地址
+func Sentinel(masterName string, addrs ...string) Option {
+	return func(o *Options) {
+		o.mode = modeSentinel
+		o.masterName = masterName
+		o.addrs = addrs
+	}
+}
+
+// Cluster 集群模式, addrs 为种子节点地址
+func Cluster(addrs ...string) Option {
+	return func(o *Options) {
+		o.mode = modeCluster
+		o.addrs = addrs
+	}
+}
+
+func DB(db int) Option {
+	return func(o *Options) {
+		o.db = db
+	}
+}
+
+func Password(password string) Option {
+	return func(o *Options) {
+		o.password = password
+	}
+}
+
+func PoolSize(poolSize int) Option {
+	return func(o *Options) {
+		o.poolSize = poolSize
+	}
+}
+
+func Prefix(prefix string) Option {
+	return func(o *Options) {
+		o.prefix = prefix
+	}
+}
+
+func Codec(c codec.Codec) Option {
+	return func(o *Options) {
+		o.codec = c
+	}
+}
+
+func Client(client goredis.UniversalClient) Option {
+	return func(o *Options) {
+		o.client = client
+	}
+}
+
+func Namespace(namespace string) Option {
+	return func(o *Options) {
+		o.namespace = namespace
+	}
+}
+
+func Observer(observer cache.Observer) Option {
+	return func(o *Options) {
+		o.observer = observer
+	}
+}
+
+func newClient(o *Options) goredis.UniversalClient {
+	if o.client != nil {
+		return o.client
+	}
+	switch o.mode {
+	case modeCluster:
+		return goredis.NewClusterClient(&goredis.ClusterOptions{
+			Addrs:    o.addrs,
+			Password: o.password,
+			PoolSize: o.poolSize,
+		})
+	case modeSentinel:
+		return goredis.NewFailoverClient(&goredis.FailoverOptions{
+			MasterName:    o.masterName,
+			SentinelAddrs: o.addrs,
+			DB:            o.db,
+			Password:      o.password,
+			PoolSize:      o.poolSize,
+		})
+	default:
+		return goredis.NewClient(&goredis.Options{
+			Addr:     o.addrs[0],
+			DB:       o.db,
+			Password: o.password,
+			PoolSize: o.poolSize,
+		})
+	}
+}
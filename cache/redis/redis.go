@@ -2,25 +2,277 @@ package redis
 
 import (
 	"context"
-	"github.com/davveo/go-toolkit/cache"
+	"errors"
+	"sync"
 	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/codec"
+	goredis "github.com/go-redis/redis/v7"
 )
 
 type AdapterRedis struct {
+	client    goredis.UniversalClient
+	prefix    string
+	codec     codec.Codec
+	namespace string
+	observer  cache.Observer
 }
 
-func NewAdapterRedis() cache.Adapter {
-	return &AdapterRedis{}
+func NewAdapterRedis(opts ...Option) cache.Adapter {
+	o := &Options{
+		mode:     modeStandalone,
+		addrs:    []string{defaultAddr},
+		codec:    codec.JSON,
+		observer: cache.NopObserver{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &AdapterRedis{
+		client:    newClient(o),
+		prefix:    o.prefix,
+		codec:     o.codec,
+		namespace: o.namespace,
+		observer:  o.observer,
+	}
 }
 
+// Set 覆盖写入时清除 key 原来关联的标签
 func (c *AdapterRedis) Set(ctx context.Context, key interface{}, value interface{}, duration time.Duration) error {
-	return nil
+	return c.set(ctx, key, value, duration, nil)
 }
 
 func (c *AdapterRedis) SetIfNotExist(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (ok bool, err error) {
-	return false, nil
+	if value == nil || duration < 0 {
+		return false, nil
+	}
+	data, err := c.encode(value)
+	if err != nil {
+		return false, c.observe(err)
+	}
+	args := []interface{}{"set", c.key(key), data}
+	if duration > 0 {
+		args = append(args, "px", milliseconds(duration))
+	}
+	args = append(args, "nx")
+	err = c.process(ctx, goredis.NewStatusCmd(args...))
+	if errors.Is(err, goredis.Nil) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
+// SetIfNotExistFunc 仅在 key 不存在时调用 f
 func (c *AdapterRedis) SetIfNotExistFunc(ctx context.Context, key interface{}, f cache.Func, duration time.Duration) (ok bool, err error) {
-	return false, nil
+	exist, err := c.Contains(ctx, key)
+	if err != nil || exist {
+		return false, err
+	}
+	value, err := f(ctx)
+	if err != nil {
+		return false, err
+	}
+	return c.SetIfNotExist(ctx, key, value, duration)
+}
+
+func (c *AdapterRedis) Get(ctx context.Context, key interface{}) (value interface{}, err error) {
+	cmd := goredis.NewStringCmd("get", c.key(key))
+	if err = c.process(ctx, cmd); err != nil {
+		if errors.Is(err, goredis.Nil) {
+			c.observer.OnMiss(c.namespace)
+			return nil, nil
+		}
+		return nil, err
+	}
+	c.observer.OnHit(c.namespace)
+	data, err := cmd.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if value, err = c.decode(data); err != nil {
+		c.observer.OnError(c.namespace, err)
+	}
+	return value, err
+}
+
+func (c *AdapterRedis) GetOrSet(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (result interface{}, err error) {
+	if result, err = c.Get(ctx, key); err != nil || result != nil {
+		return result, err
+	}
+	ok, err := c.SetIfNotExist(ctx, key, value, duration)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && value != nil {
+		// 并发写入, 以已写入的值为准
+		return c.Get(ctx, key)
+	}
+	return value, nil
+}
+
+func (c *AdapterRedis) Delete(ctx context.Context, keys ...interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	fullKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fullKeys = append(fullKeys, c.key(key))
+	}
+	return c.delete(ctx, fullKeys)
+}
+
+func (c *AdapterRedis) Contains(ctx context.Context, key interface{}) (bool, error) {
+	cmd := goredis.NewIntCmd("exists", c.key(key))
+	if err := c.process(ctx, cmd); err != nil {
+		return false, err
+	}
+	return cmd.Val() > 0, nil
+}
+
+var _ cache.TTLer = (*AdapterRedis)(nil)
+
+func (c *AdapterRedis) TTL(ctx context.Context, key interface{}) (ttl time.Duration, ok bool, err error) {
+	cmd := goredis.NewIntCmd("pttl", c.key(key))
+	if err = c.process(ctx, cmd); err != nil {
+		return 0, false, err
+	}
+	// -2 表示不存在, -1 表示永不过期, 0 表示即将过期
+	switch ms := cmd.Val(); {
+	case ms == -2 || ms == 0:
+		return 0, false, nil
+	case ms < 0:
+		return 0, true, nil
+	default:
+		return time.Duration(ms) * time.Millisecond, true, nil
+	}
+}
+
+// Keys 通过 SCAN 遍历前缀下的 key, 返回去掉前缀后的 key
+func (c *AdapterRedis) Keys(ctx context.Context) (keys []interface{}, err error) {
+	var mu sync.Mutex
+	err = c.scan(ctx, escapePattern(c.prefix)+"*", func(batch []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, k := range batch {
+			if !c.isTagKey(k) {
+				keys = append(keys, k[len(c.prefix):])
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (c *AdapterRedis) Size(ctx context.Context) (size int, err error) {
+	var mu sync.Mutex
+	err = c.scan(ctx, escapePattern(c.prefix)+"*", func(batch []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, k := range batch {
+			if !c.isTagKey(k) {
+				size++
+			}
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Clear 删除前缀下的所有 key(包括标签集合), 未设置前缀时会清空整个库
+func (c *AdapterRedis) Clear(ctx context.Context) error {
+	return c.scan(ctx, escapePattern(c.prefix)+"*", func(batch []string) error {
+		return c.del(ctx, batch)
+	})
+}
+
+func (c *AdapterRedis) Close(ctx context.Context) error {
+	return c.client.Close()
+}
+
+func (c *AdapterRedis) process(ctx context.Context, cmd goredis.Cmder) error {
+	return c.observe(c.client.ProcessContext(ctx, cmd))
+}
+
+// observe 上报 redis.Nil 以外的错误
+func (c *AdapterRedis) observe(err error) error {
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		c.observer.OnError(c.namespace, err)
+	}
+	return err
+}
+
+func (c *AdapterRedis) key(key interface{}) string {
+	return c.prefix + cache.KeyString(key)
+}
+
+// encode 以 interface 形式编码, 保证 decode 时能还原出具体类型
+func (c *AdapterRedis) encode(value interface{}) ([]byte, error) {
+	return c.codec.Marshal(&value)
+}
+
+func (c *AdapterRedis) decode(data []byte) (interface{}, error) {
+	var value interface{}
+	if err := c.codec.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (c *AdapterRedis) del(ctx context.Context, keys []string) error {
+	if cluster, ok := c.client.(*goredis.ClusterClient); ok {
+		// 集群模式下多 key 可能跨 slot, 逐个删除
+		_, err := cluster.WithContext(ctx).Pipelined(func(pipe goredis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(key)
+			}
+			return nil
+		})
+		return c.observe(err)
+	}
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "del")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	return c.process(ctx, goredis.NewIntCmd(args...))
+}
+
+// scan 遍历匹配 match 的 key, 集群模式下在各 master 并发执行
+func (c *AdapterRedis) scan(ctx context.Context, match string, fn func(keys []string) error) error {
+	scanNode := func(client goredis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(cursor, match, scanCount).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err = fn(keys); err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	switch client := c.client.(type) {
+	case *goredis.ClusterClient:
+		return client.WithContext(ctx).ForEachMaster(func(node *goredis.Client) error {
+			return scanNode(node.WithContext(ctx))
+		})
+	case *goredis.Client:
+		return scanNode(client.WithContext(ctx))
+	default:
+		return scanNode(c.client)
+	}
+}
+
+func milliseconds(d time.Duration) int64 {
+	if d < time.Millisecond {
+		return 1
+	}
+	return int64(d / time.Millisecond)
 }
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"context"
+	"encoding/gob"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/codec"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+func newTestAdapter(t *testing.T, opts ...Option) (cache.Adapter, *miniredis.Miniredis) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	c := NewAdapterRedis(append([]Option{Addr(s.Addr())}, opts...)...)
+	t.Cleanup(func() { _ = c.Close(context.Background()) })
+	return c, s
+}
+
+func TestAdapterRedis(t *testing.T) {
+	ctx := context.Background()
+	c, s := newTestAdapter(t, Prefix("test:"))
+
+	if err := c.Set(ctx, "k1", "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get("test:k1"); got != `"v1"` {
+		t.Fatalf("raw value = %s", got)
+	}
+	if ttl := s.TTL("test:k1"); ttl != time.Minute {
+		t.Fatalf("ttl = %v", ttl)
+	}
+	if ttl, ok, err := c.(cache.TTLer).TTL(ctx, "k1"); err != nil || !ok || ttl != time.Minute {
+		t.Fatalf("TTL(k1) = %v, %v, %v", ttl, ok, err)
+	}
+	if _, ok, _ := c.(cache.TTLer).TTL(ctx, "missing"); ok {
+		t.Fatal("TTL(missing) reported existing key")
+	}
+	if v, err := c.Get(ctx, "k1"); err != nil || v != "v1" {
+		t.Fatalf("get k1 = %v, %v", v, err)
+	}
+	if v, err := c.Get(ctx, "missing"); err != nil || v != nil {
+		t.Fatalf("get missing = %v, %v", v, err)
+	}
+	if ok, _ := c.SetIfNotExist(ctx, "k1", "v2", 0); ok {
+		t.Fatal("SetIfNotExist overwrote existing key")
+	}
+	if v, _ := c.GetOrSet(ctx, "k2", "v2", 0); v != "v2" {
+		t.Fatalf("GetOrSet k2 = %v", v)
+	}
+	if v, _ := c.GetOrSet(ctx, "k2", "v3", 0); v != "v2" {
+		t.Fatalf("GetOrSet k2 = %v", v)
+	}
+
+	_ = s.Set("other", "x")
+	keys, _ := c.Keys(ctx)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].(string) < keys[j].(string) })
+	if !reflect.DeepEqual(keys, []interface{}{"k1", "k2"}) {
+		t.Fatalf("keys = %v", keys)
+	}
+	if size, _ := c.Size(ctx); size != 2 {
+		t.Fatalf("size = %d", size)
+	}
+
+	_ = c.Delete(ctx, "k1")
+	if ok, _ := c.Contains(ctx, "k1"); ok {
+		t.Fatal("k1 still exists after delete")
+	}
+	_ = c.Clear(ctx)
+	if size, _ := c.Size(ctx); size != 0 {
+		t.Fatalf("size after clear = %d", size)
+	}
+	if !s.Exists("other") {
+		t.Fatal("clear removed key outside prefix")
+	}
+
+	_ = c.Set(ctx, "ttl", "v", 10*time.Millisecond)
+	s.FastForward(20 * time.Millisecond)
+	if v, _ := c.Get(ctx, "ttl"); v != nil {
+		t.Fatalf("ttl = %v after expiry", v)
+	}
+}
+
+func TestAdapterRedisSetIfNotExistFunc(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestAdapter(t)
+
+	calls := 0
+	f := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return "loaded", nil
+	}
+	if ok, err := c.SetIfNotExistFunc(ctx, "k", f, 0); !ok || err != nil {
+		t.Fatalf("first SetIfNotExistFunc = %v, %v", ok, err)
+	}
+	if ok, _ := c.SetIfNotExistFunc(ctx, "k", f, 0); ok {
+		t.Fatal("second SetIfNotExistFunc should not set")
+	}
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+}
+
+func TestAdapterRedisCodec(t *testing.T) {
+	gob.Register(user{})
+	ctx := context.Background()
+	want := user{Name: "lemon", Age: 18}
+
+	for name, cc := range map[string]codec.Codec{"gob": codec.Gob, "msgpack": codec.Msgpack} {
+		c, _ := newTestAdapter(t, Codec(cc))
+		_ = c.Set(ctx, "u", want, 0)
+		v, err := c.Get(ctx, "u")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		switch got := v.(type) {
+		case user:
+			if got != want {
+				t.Fatalf("%s: got %+v", name, got)
+			}
+		case map[string]interface{}:
+			if got["Name"] != want.Name {
+				t.Fatalf("%s: got %+v", name, got)
+			}
+		default:
+			t.Fatalf("%s: unexpected type %T", name, v)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+var _ cache.Tagger = (*AdapterRedis)(nil)
+
+// tagKeyPrefix 标签集合 key 的前缀, 集合成员为完整的缓存 key
+const tagKeyPrefix = "__tag__:"
+
+// tagsKeyPrefix 反向索引 key 的前缀, 集合成员为缓存 key 关联的标签, 过期时间与缓存 key 相同
+const tagsKeyPrefix = "__tags__:"
+
+// tagScript 将 key 加入标签集合, 集合的过期时间不早于其中任一 key
+const tagScript = `
+local before = redis.call("pttl", KEYS[1])
+redis.call("sadd", KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call("persist", KEYS[1])
+elseif before == -2 or (before >= 0 and before < ttl) then
+	redis.call("pexpire", KEYS[1], ttl)
+end
+return 1`
+
+// retagScript 将反向索引替换为 ARGV[2:], 返回原来的标签
+const retagScript = `
+local old = redis.call("smembers", KEYS[1])
+redis.call("del", KEYS[1])
+if #ARGV > 1 then
+	redis.call("sadd", KEYS[1], unpack(ARGV, 2))
+	if tonumber(ARGV[1]) > 0 then
+		redis.call("pexpire", KEYS[1], ARGV[1])
+	end
+end
+return old`
+
+// SetWithTags 标签集合逐个维护, 集群模式下不要求 key 与标签位于同一 slot.
+// 通过反向索引找到 key 原来的标签, 从不再关联的标签集合中移除 key
+func (c *AdapterRedis) SetWithTags(ctx context.Context, key interface{}, value interface{}, duration time.Duration, tags ...string) error {
+	return c.set(ctx, key, value, duration, tags)
+}
+
+// set 在同一个 pipeline 中写入值和反向索引, 然后更新标签集合;
+// 不带标签时只读取反向索引, key 原来没有标签则一次往返即可完成
+func (c *AdapterRedis) set(ctx context.Context, key interface{}, value interface{}, duration time.Duration, tags []string) error {
+	if value == nil || duration < 0 {
+		return c.Delete(ctx, key)
+	}
+	data, err := c.encode(value)
+	if err != nil {
+		return c.observe(err)
+	}
+	fullKey := c.key(key)
+	args := []interface{}{"set", fullKey, data}
+	var ttl int64
+	if duration > 0 {
+		ttl = milliseconds(duration)
+		args = append(args, "px", ttl)
+	}
+	pipe := c.client.Pipeline()
+	_ = pipe.Process(goredis.NewStatusCmd(args...))
+	var old *goredis.StringSliceCmd
+	if len(tags) == 0 {
+		old = pipe.SMembers(c.tagsKey(fullKey))
+	} else {
+		old = c.retag(pipe, fullKey, ttl, tags)
+	}
+	if _, err = pipe.ExecContext(ctx); err != nil {
+		return c.observe(err)
+	}
+	if len(tags) == 0 {
+		return c.untagAll(ctx, []string{fullKey}, []*goredis.StringSliceCmd{old})
+	}
+
+	pipe = c.client.Pipeline()
+	n := c.untag(pipe, fullKey, old.Val(), tags)
+	for _, tag := range tags {
+		_ = pipe.Process(goredis.NewCmd("eval", tagScript, 1, c.tagKey(tag), fullKey, ttl))
+		n++
+	}
+	return c.exec(ctx, pipe, n)
+}
+
+// delete 删除 key 和反向索引, 并从关联的标签集合中移除 key
+func (c *AdapterRedis) delete(ctx context.Context, fullKeys []string) error {
+	pipe := c.client.Pipeline()
+	olds := make([]*goredis.StringSliceCmd, 0, len(fullKeys))
+	for _, key := range fullKeys {
+		_ = pipe.Process(goredis.NewIntCmd("del", key))
+		olds = append(olds, pipe.SMembers(c.tagsKey(key)))
+	}
+	if _, err := pipe.ExecContext(ctx); err != nil {
+		return c.observe(err)
+	}
+	return c.untagAll(ctx, fullKeys, olds)
+}
+
+// untagAll 删除有标签的 key 的反向索引, 并从原来的标签集合中移除 key; 都没有标签时不访问 redis
+func (c *AdapterRedis) untagAll(ctx context.Context, fullKeys []string, olds []*goredis.StringSliceCmd) error {
+	pipe := c.client.Pipeline()
+	n := 0
+	for i, key := range fullKeys {
+		if old := olds[i].Val(); len(old) > 0 {
+			_ = pipe.Process(goredis.NewIntCmd("del", c.tagsKey(key)))
+			n += 1 + c.untag(pipe, key, old, nil)
+		}
+	}
+	return c.exec(ctx, pipe, n)
+}
+
+// retag 将 key 的反向索引替换为 tags, 命令执行后返回原来的标签
+func (c *AdapterRedis) retag(pipe goredis.Pipeliner, fullKey string, ttl int64, tags []string) *goredis.StringSliceCmd {
+	args := make([]interface{}, 0, len(tags)+5)
+	args = append(args, "eval", retagScript, 1, c.tagsKey(fullKey), ttl)
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	cmd := goredis.NewStringSliceCmd(args...)
+	_ = pipe.Process(cmd)
+	return cmd
+}
+
+// untag 从 old 中不在 keep 里的标签集合移除 key, 返回加入 pipe 的命令数
+func (c *AdapterRedis) untag(pipe goredis.Pipeliner, fullKey string, old, keep []string) int {
+	n := 0
+	for _, tag := range old {
+		if !contains(keep, tag) {
+			_ = pipe.Process(goredis.NewIntCmd("srem", c.tagKey(tag), fullKey))
+			n++
+		}
+	}
+	return n
+}
+
+// exec 执行 pipe 中的 n 条命令
+func (c *AdapterRedis) exec(ctx context.Context, pipe goredis.Pipeliner, n int) error {
+	if n == 0 {
+		return nil
+	}
+	_, err := pipe.ExecContext(ctx)
+	return c.observe(err)
+}
+
+// InvalidateTag 通过 SSCAN 分批删除标签集合中的 key, 不使用 KEYS
+func (c *AdapterRedis) InvalidateTag(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		tagKey := c.tagKey(tag)
+		if err := c.members(ctx, tagKey, func(keys []string) error {
+			return c.delete(ctx, keys)
+		}); err != nil {
+			return err
+		}
+		if err := c.del(ctx, []string{tagKey}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *AdapterRedis) KeysByTag(ctx context.Context, tag string) (keys []interface{}, err error) {
+	err = c.members(ctx, c.tagKey(tag), func(batch []string) error {
+		for _, k := range batch {
+			keys = append(keys, k[len(c.prefix):])
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// DeleteByPrefix 通过 SCAN 分批删除, 不阻塞 redis
+func (c *AdapterRedis) DeleteByPrefix(ctx context.Context, prefix string) error {
+	return c.scan(ctx, escapePattern(c.prefix+prefix)+"*", func(batch []string) error {
+		return c.delete(ctx, batch)
+	})
+}
+
+func (c *AdapterRedis) tagKey(tag string) string {
+	return c.prefix + tagKeyPrefix + tag
+}
+
+func (c *AdapterRedis) tagsKey(fullKey string) string {
+	return c.prefix + tagsKeyPrefix + fullKey[len(c.prefix):]
+}
+
+// isTagKey 标签集合和反向索引不是缓存 key
+func (c *AdapterRedis) isTagKey(key string) bool {
+	return strings.HasPrefix(key, c.prefix+tagKeyPrefix) || strings.HasPrefix(key, c.prefix+tagsKeyPrefix)
+}
+
+func contains(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *AdapterRedis) members(ctx context.Context, tagKey string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		cmd := goredis.NewScanCmd(nil, "sscan", tagKey, cursor, "count", scanCount)
+		if err := c.process(ctx, cmd); err != nil {
+			return err
+		}
+		keys, next := cmd.Val()
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// escapePattern 转义 SCAN MATCH 中的通配符
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
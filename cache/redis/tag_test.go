@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/cache"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func TestAdapterRedisTags(t *testing.T) {
+	ctx := context.Background()
+	c, s := newTestAdapter(t, Prefix("app:"))
+
+	_ = cache.SetWithTags(ctx, c, "user:1:profile", "p1", time.Minute, "user:1")
+	_ = cache.SetWithTags(ctx, c, "user:1:orders", "o1", 2*time.Minute, "user:1", "orders")
+	_ = cache.SetWithTags(ctx, c, "user:2:orders", "o2", time.Minute, "user:2", "orders")
+
+	if ttl := s.TTL("app:__tag__:user:1"); ttl != 2*time.Minute {
+		t.Fatalf("tag ttl = %v", ttl)
+	}
+	// 反向索引与缓存 key 同时过期
+	if ttl := s.TTL("app:__tags__:user:1:orders"); ttl != 2*time.Minute {
+		t.Fatalf("reverse index ttl = %v", ttl)
+	}
+	if size, _ := c.Size(ctx); size != 3 {
+		t.Fatalf("size counts tag sets or reverse indexes: %d", size)
+	}
+	keys, _ := c.(cache.Tagger).KeysByTag(ctx, "orders")
+	if len(keys) != 2 {
+		t.Fatalf("orders keys = %v", keys)
+	}
+
+	_ = cache.InvalidateTag(ctx, c, "user:1")
+	for _, key := range []string{"user:1:profile", "user:1:orders"} {
+		if ok, _ := c.Contains(ctx, key); ok {
+			t.Fatalf("%s survived tag invalidation", key)
+		}
+	}
+	if s.Exists("app:__tag__:user:1") {
+		t.Fatal("tag set not deleted")
+	}
+	if ok, _ := c.Contains(ctx, "user:2:orders"); !ok {
+		t.Fatal("unrelated key deleted")
+	}
+
+	_ = c.Set(ctx, "user:[3]", "x", 0)
+	_ = c.Set(ctx, "user:3", "y", 0)
+	_ = cache.DeleteByPrefix(ctx, c, "user:[")
+	if ok, _ := c.Contains(ctx, "user:[3]"); ok {
+		t.Fatal("DeleteByPrefix did not delete matching key")
+	}
+	if ok, _ := c.Contains(ctx, "user:3"); !ok {
+		t.Fatal("DeleteByPrefix treated prefix as pattern")
+	}
+}
+
+// roundTrips 统计发往 redis 的往返次数和 eval 命令数
+type roundTrips struct {
+	trips, evals int
+}
+
+func (r *roundTrips) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	r.trips++
+	r.count([]goredis.Cmder{cmd})
+	return ctx, nil
+}
+
+func (r *roundTrips) AfterProcess(ctx context.Context, cmd goredis.Cmder) error {
+	return nil
+}
+
+func (r *roundTrips) BeforeProcessPipeline(ctx context.Context, cmds []goredis.Cmder) (context.Context, error) {
+	r.trips++
+	r.count(cmds)
+	return ctx, nil
+}
+
+func (r *roundTrips) AfterProcessPipeline(ctx context.Context, cmds []goredis.Cmder) error {
+	return nil
+}
+
+func (r *roundTrips) count(cmds []goredis.Cmder) {
+	for _, cmd := range cmds {
+		if cmd.Name() == "eval" {
+			r.evals++
+		}
+	}
+}
+
+func TestAdapterRedisPlainSet(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	rt := &roundTrips{}
+	client.AddHook(rt)
+	c := NewAdapterRedis(Client(client))
+	defer c.Close(ctx)
+
+	// 没有标签的 key 写入和删除都只需一次往返, 不执行脚本
+	_ = c.Set(ctx, "k", "v1", time.Minute)
+	_ = c.Set(ctx, "k", "v2", time.Minute)
+	_ = c.Delete(ctx, "k")
+	if rt.trips != 3 || rt.evals != 0 {
+		t.Fatalf("trips = %d, evals = %d", rt.trips, rt.evals)
+	}
+
+	// 原来有标签时清理反向索引和标签集合
+	_ = cache.SetWithTags(ctx, c, "k", "v", time.Minute, "t")
+	_ = c.Set(ctx, "k", "v", time.Minute)
+	if s.Exists("__tags__:k") {
+		t.Fatal("reverse index not deleted")
+	}
+	if keys, _ := c.(cache.Tagger).KeysByTag(ctx, "t"); len(keys) != 0 {
+		t.Fatalf("keys by tag = %v", keys)
+	}
+}
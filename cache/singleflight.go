@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// errGoexit fn 调用了 runtime.Goexit 时等待者收到的错误
+var errGoexit = errors.New("cache: loader called runtime.Goexit")
+
+// panicError fn 的 panic 值及其堆栈, 由执行者和等待者重新 panic
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+func (p *panicError) Unwrap() error {
+	err, _ := p.value.(error)
+	return err
+}
+
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// group 合并同一 key 的并发调用, 同一时刻只有一个 fn 在执行;
+// fn panic 时执行者和所有等待者都会以 *panicError panic
+type group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+func (g *group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		if e, ok := c.err.(*panicError); ok {
+			panic(e)
+		}
+		return c.val, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	return c.val, c.err
+}
+
+func (g *group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	normalReturn, recovered := false, false
+	defer func() {
+		// 既没有正常返回也没有 recover, 说明 fn 调用了 runtime.Goexit
+		if !normalReturn && !recovered {
+			c.err = errGoexit
+		}
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		c.wg.Done()
+		if e, ok := c.err.(*panicError); ok {
+			panic(e)
+		}
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					c.err = &panicError{value: r, stack: debug.Stack()}
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+	if !normalReturn {
+		recovered = true
+	}
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davveo/go-toolkit/logger"
+)
+
+// Stats 按 namespace 统计缓存事件的 Observer
+type Stats struct {
+	m sync.Map // namespace -> *counters
+}
+
+type counters struct {
+	hits, misses, loads, loadErrors, loadNanos, evictions, errors, backfills uint64
+}
+
+type StatsSnapshot struct {
+	Namespace  string
+	Hits       uint64
+	Misses     uint64
+	Loads      uint64
+	LoadErrors uint64
+	LoadTime   time.Duration
+	Evictions  uint64
+	Errors     uint64
+	Backfills  uint64
+}
+
+// HitRate 命中率, 没有访问时为 0
+func (s StatsSnapshot) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// AvgLoadTime 平均加载耗时
+func (s StatsSnapshot) AvgLoadTime() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+	return s.LoadTime / time.Duration(s.Loads)
+}
+
+func NewStats() *Stats {
+	return &Stats{}
+}
+
+func (s *Stats) OnHit(namespace string) {
+	atomic.AddUint64(&s.get(namespace).hits, 1)
+}
+
+func (s *Stats) OnMiss(namespace string) {
+	atomic.AddUint64(&s.get(namespace).misses, 1)
+}
+
+func (s *Stats) OnLoad(namespace string, latency time.Duration, err error) {
+	c := s.get(namespace)
+	atomic.AddUint64(&c.loads, 1)
+	atomic.AddUint64(&c.loadNanos, uint64(latency))
+	if err != nil {
+		atomic.AddUint64(&c.loadErrors, 1)
+	}
+}
+
+func (s *Stats) OnEvict(namespace string, n int) {
+	atomic.AddUint64(&s.get(namespace).evictions, uint64(n))
+}
+
+func (s *Stats) OnError(namespace string, err error) {
+	atomic.AddUint64(&s.get(namespace).errors, 1)
+}
+
+func (s *Stats) OnBackfill(namespace string) {
+	atomic.AddUint64(&s.get(namespace).backfills, 1)
+}
+
+// Snapshot 按 namespace 排序的累计统计
+func (s *Stats) Snapshot() []StatsSnapshot {
+	var snapshots []StatsSnapshot
+	s.m.Range(func(key, value interface{}) bool {
+		c := value.(*counters)
+		snapshots = append(snapshots, StatsSnapshot{
+			Namespace:  key.(string),
+			Hits:       atomic.LoadUint64(&c.hits),
+			Misses:     atomic.LoadUint64(&c.misses),
+			Loads:      atomic.LoadUint64(&c.loads),
+			LoadErrors: atomic.LoadUint64(&c.loadErrors),
+			LoadTime:   time.Duration(atomic.LoadUint64(&c.loadNanos)),
+			Evictions:  atomic.LoadUint64(&c.evictions),
+			Errors:     atomic.LoadUint64(&c.errors),
+			Backfills:  atomic.LoadUint64(&c.backfills),
+		})
+		return true
+	})
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Namespace < snapshots[j].Namespace
+	})
+	return snapshots
+}
+
+// Dump 每隔 interval 通过 logger.InfoKV 输出一次统计, 阻塞直到 ctx 结束
+func (s *Stats) Dump(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !logger.IsInitialized() {
+				continue
+			}
+			for _, snapshot := range s.Snapshot() {
+				logger.InfoKV("cache stats",
+					logger.KV("namespace", snapshot.Namespace),
+					logger.KV("hits", snapshot.Hits),
+					logger.KV("misses", snapshot.Misses),
+					logger.KV("hit_rate", snapshot.HitRate()),
+					logger.KV("loads", snapshot.Loads),
+					logger.KV("load_errors", snapshot.LoadErrors),
+					logger.KV("avg_load_ms", snapshot.AvgLoadTime().Milliseconds()),
+					logger.KV("evictions", snapshot.Evictions),
+					logger.KV("errors", snapshot.Errors),
+					logger.KV("backfills", snapshot.Backfills),
+				)
+			}
+		}
+	}
+}
+
+func (s *Stats) get(namespace string) *counters {
+	if c, ok := s.m.Load(namespace); ok {
+		return c.(*counters)
+	}
+	c, _ := s.m.LoadOrStore(namespace, &counters{})
+	return c.(*counters)
+}
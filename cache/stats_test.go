@@ -0,0 +1,41 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/local"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	stats := cache.NewStats()
+	adapter := local.NewAdapterLocal(local.Namespace("user"), local.Observer(stats))
+	defer adapter.Close(ctx)
+	loader := cache.NewLoader(adapter, cache.Observe("user", stats))
+
+	f := func(ctx context.Context) (interface{}, error) {
+		return "v", nil
+	}
+	for i := 0; i < 4; i++ {
+		_, _ = loader.GetOrLoad(ctx, "k", f, time.Minute)
+	}
+	_, _ = loader.GetOrLoad(ctx, "err", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("db down")
+	}, time.Minute)
+
+	snapshots := stats.Snapshot()
+	if len(snapshots) != 1 {
+		t.Fatalf("snapshots = %+v", snapshots)
+	}
+	s := snapshots[0]
+	if s.Namespace != "user" || s.Hits != 3 || s.Misses != 2 || s.Loads != 2 || s.LoadErrors != 1 {
+		t.Fatalf("snapshot = %+v", s)
+	}
+	if rate := s.HitRate(); rate != 0.6 {
+		t.Fatalf("hit rate = %v", rate)
+	}
+}
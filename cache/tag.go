@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotSupported 适配器不支持该操作
+var ErrNotSupported = errors.New("cache: operation not supported by adapter")
+
+// Tagger 支持按标签、前缀批量失效的适配器
+type Tagger interface {
+	// SetWithTags 写入缓存并关联标签, 再次写入同一 key 时以最新的标签为准
+	SetWithTags(ctx context.Context, key interface{}, value interface{}, duration time.Duration, tags ...string) error
+	// InvalidateTag 删除关联了任一标签的所有 key
+	InvalidateTag(ctx context.Context, tags ...string) error
+	// KeysByTag 返回关联了该标签的 key
+	KeysByTag(ctx context.Context, tag string) (keys []interface{}, err error)
+	// DeleteByPrefix 删除以 prefix 开头的所有 key
+	DeleteByPrefix(ctx context.Context, prefix string) error
+}
+
+func SetWithTags(ctx context.Context, adapter Adapter, key interface{}, value interface{}, duration time.Duration, tags ...string) error {
+	tagger, ok := adapter.(Tagger)
+	if !ok {
+		return ErrNotSupported
+	}
+	return tagger.SetWithTags(ctx, key, value, duration, tags...)
+}
+
+func InvalidateTag(ctx context.Context, adapter Adapter, tags ...string) error {
+	tagger, ok := adapter.(Tagger)
+	if !ok {
+		return ErrNotSupported
+	}
+	return tagger.InvalidateTag(ctx, tags...)
+}
+
+func DeleteByPrefix(ctx context.Context, adapter Adapter, prefix string) error {
+	tagger, ok := adapter.(Tagger)
+	if !ok {
+		return ErrNotSupported
+	}
+	return tagger.DeleteByPrefix(ctx, prefix)
+}
@@ -0,0 +1,74 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/local"
+	"github.com/davveo/go-toolkit/cache/redis"
+)
+
+func TestRetag(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	adapters := map[string]cache.Adapter{
+		"local": local.NewAdapterLocal(),
+		"redis": redis.NewAdapterRedis(redis.Addr(s.Addr()), redis.Prefix("app:")),
+	}
+	for name, adapter := range adapters {
+		defer adapter.Close(ctx)
+		tagger := adapter.(cache.Tagger)
+		keys := func(tag string) string {
+			keys, err := tagger.KeysByTag(ctx, tag)
+			if err != nil {
+				t.Fatalf("%s: KeysByTag(%s) = %v", name, tag, err)
+			}
+			var result []string
+			for _, key := range keys {
+				result = append(result, cache.KeyString(key))
+			}
+			sort.Strings(result)
+			return fmt.Sprint(result)
+		}
+
+		_ = cache.SetWithTags(ctx, adapter, "k1", "v1", time.Minute, "a", "b")
+		_ = cache.SetWithTags(ctx, adapter, "k2", "v2", time.Minute, "a")
+		// 再次写入时以最新的标签为准
+		_ = cache.SetWithTags(ctx, adapter, "k1", "v1", time.Minute, "b", "c")
+		if got := keys("a"); got != "[k2]" {
+			t.Fatalf("%s: a = %s", name, got)
+		}
+		if got := keys("c"); got != "[k1]" {
+			t.Fatalf("%s: c = %s", name, got)
+		}
+		_ = cache.InvalidateTag(ctx, adapter, "a")
+		if ok, _ := adapter.Contains(ctx, "k1"); !ok {
+			t.Fatalf("%s: k1 invalidated by its old tag", name)
+		}
+
+		// 不带标签写入时清除标签
+		_ = adapter.Set(ctx, "k1", "v1", time.Minute)
+		if got := keys("b") + keys("c"); got != "[][]" {
+			t.Fatalf("%s: b, c = %s", name, got)
+		}
+
+		_ = cache.SetWithTags(ctx, adapter, "k3", "v3", time.Minute, "d")
+		_ = adapter.Delete(ctx, "k3")
+		if got := keys("d"); got != "[]" {
+			t.Fatalf("%s: d after Delete = %s", name, got)
+		}
+		if size, _ := adapter.Size(ctx); size != 1 {
+			t.Fatalf("%s: size = %d", name, size)
+		}
+	}
+}
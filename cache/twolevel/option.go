@@ -0,0 +1,60 @@
+package twolevel
+
+import (
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+const (
+	defaultChannel = "cache:invalidate"
+	defaultL1TTL   = time.Minute
+	// L2 不支持查询剩余有效期时, 回填 L1 的有效期
+	defaultBackfillTTL = time.Minute
+)
+
+type (
+	Options struct {
+		// 本地缓存的最长有效期, 限制跨实例失效消息丢失时读到旧值的时间
+		l1TTL time.Duration
+		// 用于广播失效消息的 redis 客户端, 为空时不广播
+		client  goredis.UniversalClient
+		channel string
+		// L1、L2 的事件分别以 namespace:l1、namespace:l2 上报, 回填计入 L1
+		namespace string
+		observer  cache.Observer
+	}
+	Option func(o *Options)
+)
+
+func L1TTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.l1TTL = ttl
+	}
+}
+
+func Broadcast(client goredis.UniversalClient) Option {
+	return func(o *Options) {
+		o.client = client
+	}
+}
+
+func Channel(channel string) Option {
+	return func(o *Options) {
+		o.channel = channel
+	}
+}
+
+func Namespace(namespace string) Option {
+	return func(o *Options) {
+		o.namespace = namespace
+	}
+}
+
+// Observer observer 实现 cache.BackfillObserver 时同时上报回填
+func Observer(observer cache.Observer) Option {
+	return func(o *Options) {
+		o.observer = observer
+	}
+}
@@ -0,0 +1,79 @@
+package twolevel
+
+import (
+	"context"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+)
+
+var _ cache.Tagger = (*AdapterTwoLevel)(nil)
+
+// SetWithTags 两级缓存都需要实现 cache.Tagger
+func (a *AdapterTwoLevel) SetWithTags(ctx context.Context, key interface{}, value interface{}, duration time.Duration, tags ...string) error {
+	if err := cache.SetWithTags(ctx, a.l2, key, value, duration, tags...); err != nil {
+		return a.observe(a.l2Namespace, err)
+	}
+	if err := cache.SetWithTags(ctx, a.l1, key, value, a.localTTL(duration), tags...); err != nil {
+		return a.observe(a.l1Namespace, err)
+	}
+	return a.publish(ctx, message{Keys: []string{cache.KeyString(key)}})
+}
+
+// InvalidateTag 以 L2 中的标签为准, 其他实例通过回源读取写入 L1 的 key 没有标签, 因此广播具体的 key
+func (a *AdapterTwoLevel) InvalidateTag(ctx context.Context, tags ...string) error {
+	l2, ok := a.l2.(cache.Tagger)
+	if !ok {
+		return cache.ErrNotSupported
+	}
+	msg := message{}
+	for _, tag := range tags {
+		keys, err := l2.KeysByTag(ctx, tag)
+		if err != nil {
+			return a.observe(a.l2Namespace, err)
+		}
+		for _, key := range keys {
+			msg.Keys = append(msg.Keys, cache.KeyString(key))
+		}
+	}
+	if err := l2.InvalidateTag(ctx, tags...); err != nil {
+		return a.observe(a.l2Namespace, err)
+	}
+	if err := cache.InvalidateTag(ctx, a.l1, tags...); err != nil {
+		return a.observe(a.l1Namespace, err)
+	}
+	if len(msg.Keys) == 0 {
+		return nil
+	}
+	if err := a.l1.Delete(ctx, toInterfaces(msg.Keys)...); err != nil {
+		return a.observe(a.l1Namespace, err)
+	}
+	return a.publish(ctx, msg)
+}
+
+func (a *AdapterTwoLevel) KeysByTag(ctx context.Context, tag string) (keys []interface{}, err error) {
+	l2, ok := a.l2.(cache.Tagger)
+	if !ok {
+		return nil, cache.ErrNotSupported
+	}
+	keys, err = l2.KeysByTag(ctx, tag)
+	return keys, a.observe(a.l2Namespace, err)
+}
+
+func (a *AdapterTwoLevel) DeleteByPrefix(ctx context.Context, prefix string) error {
+	if err := cache.DeleteByPrefix(ctx, a.l2, prefix); err != nil {
+		return a.observe(a.l2Namespace, err)
+	}
+	if err := cache.DeleteByPrefix(ctx, a.l1, prefix); err != nil {
+		return a.observe(a.l1Namespace, err)
+	}
+	return a.publish(ctx, message{Prefix: prefix})
+}
+
+func toInterfaces(keys []string) []interface{} {
+	result := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key)
+	}
+	return result
+}
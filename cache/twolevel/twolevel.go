@@ -0,0 +1,297 @@
+package twolevel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/logger"
+	goredis "github.com/go-redis/redis/v7"
+	"github.com/google/uuid"
+)
+
+// AdapterTwoLevel 本地缓存(L1) + 远端缓存(L2)
+// 读: L1 未命中时从 L2 读取并回填 L1
+// 写: 先写 L2 再写 L1, 并通过 redis pub/sub 通知其他实例删除各自的 L1
+type AdapterTwoLevel struct {
+	l1      cache.Adapter
+	l2      cache.Adapter
+	l1TTL   time.Duration
+	id      string
+	client  goredis.UniversalClient
+	channel string
+	pubsub  *goredis.PubSub
+	wg      sync.WaitGroup
+	once    sync.Once
+
+	l1Namespace string
+	l2Namespace string
+	observer    cache.Observer
+}
+
+// message 失效广播消息
+type message struct {
+	ID     string   `json:"id"`
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	Clear  bool     `json:"clear,omitempty"`
+}
+
+func NewAdapterTwoLevel(l1, l2 cache.Adapter, opts ...Option) (cache.Adapter, error) {
+	o := &Options{
+		l1TTL:    defaultL1TTL,
+		channel:  defaultChannel,
+		observer: cache.NopObserver{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	a := &AdapterTwoLevel{
+		l1:      l1,
+		l2:      l2,
+		l1TTL:   o.l1TTL,
+		id:      uuid.New().String(),
+		client:  o.client,
+		channel: o.channel,
+
+		l1Namespace: levelNamespace(o.namespace, "l1"),
+		l2Namespace: levelNamespace(o.namespace, "l2"),
+		observer:    o.observer,
+	}
+	if a.client != nil {
+		a.pubsub = a.client.Subscribe(a.channel)
+		// 等待订阅生效, 避免漏掉构造完成后立即发生的失效消息
+		if _, err := a.pubsub.Receive(); err != nil {
+			_ = a.pubsub.Close()
+			return nil, err
+		}
+		a.wg.Add(1)
+		go a.subscribe()
+	}
+	return a, nil
+}
+
+func (a *AdapterTwoLevel) Set(ctx context.Context, key interface{}, value interface{}, duration time.Duration) error {
+	if err := a.l2.Set(ctx, key, value, duration); err != nil {
+		return a.observe(a.l2Namespace, err)
+	}
+	if err := a.l1.Set(ctx, key, value, a.localTTL(duration)); err != nil {
+		return a.observe(a.l1Namespace, err)
+	}
+	return a.publish(ctx, message{Keys: []string{cache.KeyString(key)}})
+}
+
+func (a *AdapterTwoLevel) SetIfNotExist(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (ok bool, err error) {
+	if ok, err = a.l2.SetIfNotExist(ctx, key, value, duration); err != nil || !ok {
+		return ok, a.observe(a.l2Namespace, err)
+	}
+	if err = a.l1.Set(ctx, key, value, a.localTTL(duration)); err != nil {
+		return ok, a.observe(a.l1Namespace, err)
+	}
+	return ok, a.publish(ctx, message{Keys: []string{cache.KeyString(key)}})
+}
+
+func (a *AdapterTwoLevel) SetIfNotExistFunc(ctx context.Context, key interface{}, f cache.Func, duration time.Duration) (ok bool, err error) {
+	var value interface{}
+	ok, err = a.l2.SetIfNotExistFunc(ctx, key, func(ctx context.Context) (interface{}, error) {
+		v, err := f(ctx)
+		value = v
+		return v, err
+	}, duration)
+	if err != nil || !ok {
+		return ok, a.observe(a.l2Namespace, err)
+	}
+	if err = a.l1.Set(ctx, key, value, a.localTTL(duration)); err != nil {
+		return ok, a.observe(a.l1Namespace, err)
+	}
+	return ok, a.publish(ctx, message{Keys: []string{cache.KeyString(key)}})
+}
+
+func (a *AdapterTwoLevel) Get(ctx context.Context, key interface{}) (value interface{}, err error) {
+	if value, err = a.l1.Get(ctx, key); err != nil || value != nil {
+		return value, a.observeGet(a.l1Namespace, value, err)
+	}
+	a.observer.OnMiss(a.l1Namespace)
+	if value, err = a.l2.Get(ctx, key); err != nil || value == nil {
+		return value, a.observeGet(a.l2Namespace, value, err)
+	}
+	a.observer.OnHit(a.l2Namespace)
+	// L2 中的 key 过期时不会广播, 回填的有效期不能超过 L2 的剩余有效期; 查询失败时不回填
+	ttl, ok, err := a.remainingTTL(ctx, key)
+	if err != nil || !ok {
+		return value, nil
+	}
+	if err = a.l1.Set(ctx, key, value, a.localTTL(ttl)); err != nil {
+		return nil, a.observe(a.l1Namespace, err)
+	}
+	if b, ok := a.observer.(cache.BackfillObserver); ok {
+		b.OnBackfill(a.l1Namespace)
+	}
+	return value, nil
+}
+
+// remainingTTL 返回 key 在 L2 中的剩余有效期, L2 不支持查询时返回 defaultBackfillTTL;
+// key 已不存在时 ok 为 false
+func (a *AdapterTwoLevel) remainingTTL(ctx context.Context, key interface{}) (ttl time.Duration, ok bool, err error) {
+	l2, supported := a.l2.(cache.TTLer)
+	if !supported {
+		return defaultBackfillTTL, true, nil
+	}
+	ttl, ok, err = l2.TTL(ctx, key)
+	return ttl, ok, a.observe(a.l2Namespace, err)
+}
+
+func (a *AdapterTwoLevel) GetOrSet(ctx context.Context, key interface{}, value interface{}, duration time.Duration) (result interface{}, err error) {
+	if result, err = a.Get(ctx, key); err != nil || result != nil {
+		return result, err
+	}
+	ok, err := a.SetIfNotExist(ctx, key, value, duration)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && value != nil {
+		return a.Get(ctx, key)
+	}
+	return value, nil
+}
+
+func (a *AdapterTwoLevel) Delete(ctx context.Context, keys ...interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := a.l2.Delete(ctx, keys...); err != nil {
+		return a.observe(a.l2Namespace, err)
+	}
+	if err := a.l1.Delete(ctx, keys...); err != nil {
+		return a.observe(a.l1Namespace, err)
+	}
+	msg := message{Keys: make([]string, 0, len(keys))}
+	for _, key := range keys {
+		msg.Keys = append(msg.Keys, cache.KeyString(key))
+	}
+	return a.publish(ctx, msg)
+}
+
+func (a *AdapterTwoLevel) Contains(ctx context.Context, key interface{}) (bool, error) {
+	if ok, err := a.l1.Contains(ctx, key); err != nil || ok {
+		return ok, a.observe(a.l1Namespace, err)
+	}
+	ok, err := a.l2.Contains(ctx, key)
+	return ok, a.observe(a.l2Namespace, err)
+}
+
+// Keys 以 L2 为准
+func (a *AdapterTwoLevel) Keys(ctx context.Context) (keys []interface{}, err error) {
+	keys, err = a.l2.Keys(ctx)
+	return keys, a.observe(a.l2Namespace, err)
+}
+
+// Size 以 L2 为准
+func (a *AdapterTwoLevel) Size(ctx context.Context) (size int, err error) {
+	size, err = a.l2.Size(ctx)
+	return size, a.observe(a.l2Namespace, err)
+}
+
+func (a *AdapterTwoLevel) Clear(ctx context.Context) error {
+	if err := a.l2.Clear(ctx); err != nil {
+		return a.observe(a.l2Namespace, err)
+	}
+	if err := a.l1.Clear(ctx); err != nil {
+		return a.observe(a.l1Namespace, err)
+	}
+	return a.publish(ctx, message{Clear: true})
+}
+
+// Close 停止订阅并关闭两级缓存
+func (a *AdapterTwoLevel) Close(ctx context.Context) (err error) {
+	a.once.Do(func() {
+		if a.pubsub != nil {
+			err = a.pubsub.Close()
+			a.wg.Wait()
+		}
+		if e := a.l1.Close(ctx); e != nil && err == nil {
+			err = e
+		}
+		if e := a.l2.Close(ctx); e != nil && err == nil {
+			err = e
+		}
+	})
+	return err
+}
+
+// localTTL 本地缓存有效期不超过 l1TTL
+func (a *AdapterTwoLevel) localTTL(duration time.Duration) time.Duration {
+	if a.l1TTL > 0 && (duration == 0 || duration > a.l1TTL) {
+		return a.l1TTL
+	}
+	return duration
+}
+
+// observeGet 上报一级缓存的读取结果
+func (a *AdapterTwoLevel) observeGet(namespace string, value interface{}, err error) error {
+	switch {
+	case err != nil:
+		return a.observe(namespace, err)
+	case value != nil:
+		a.observer.OnHit(namespace)
+	default:
+		a.observer.OnMiss(namespace)
+	}
+	return nil
+}
+
+// observe 上报 namespace 所在层级的错误, 不支持的操作不计入
+func (a *AdapterTwoLevel) observe(namespace string, err error) error {
+	if err != nil && !errors.Is(err, cache.ErrNotSupported) {
+		a.observer.OnError(namespace, err)
+	}
+	return err
+}
+
+func levelNamespace(namespace, level string) string {
+	if namespace == "" {
+		return level
+	}
+	return namespace + ":" + level
+}
+
+func (a *AdapterTwoLevel) publish(ctx context.Context, msg message) error {
+	if a.client == nil {
+		return nil
+	}
+	msg.ID = a.id
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return a.client.ProcessContext(ctx, goredis.NewIntCmd("publish", a.channel, data))
+}
+
+func (a *AdapterTwoLevel) subscribe() {
+	defer a.wg.Done()
+	ctx := context.Background()
+	for m := range a.pubsub.Channel() {
+		var msg message
+		if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+			if logger.IsInitialized() {
+				logger.WarnErr("invalid cache invalidation message", err, logger.KV("payload", m.Payload))
+			}
+			continue
+		}
+		// 自身的写操作已经更新过 L1
+		if msg.ID == a.id {
+			continue
+		}
+		switch {
+		case msg.Clear:
+			_ = a.l1.Clear(ctx)
+		case msg.Prefix != "":
+			_ = cache.DeleteByPrefix(ctx, a.l1, msg.Prefix)
+		default:
+			_ = a.l1.Delete(ctx, toInterfaces(msg.Keys)...)
+		}
+	}
+}
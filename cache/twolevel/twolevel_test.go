@@ -0,0 +1,191 @@
+package twolevel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/local"
+	"github.com/davveo/go-toolkit/cache/redis"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func newReplica(t *testing.T, addr string) (cache.Adapter, cache.Adapter) {
+	l1 := local.NewAdapterLocal()
+	l2 := redis.NewAdapterRedis(redis.Addr(addr))
+	c, err := NewAdapterTwoLevel(l1, l2, Broadcast(goredis.NewClient(&goredis.Options{Addr: addr})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close(context.Background()) })
+	return c, l1
+}
+
+func eventually(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAdapterTwoLevel(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	a, aL1 := newReplica(t, s.Addr())
+	b, bL1 := newReplica(t, s.Addr())
+
+	if err = a.Set(ctx, "k", "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// b 从 L2 读取并回填 L1
+	if v, _ := b.Get(ctx, "k"); v != "v1" {
+		t.Fatalf("b get = %v", v)
+	}
+	if v, _ := bL1.Get(ctx, "k"); v != "v1" {
+		t.Fatalf("b l1 = %v", v)
+	}
+
+	_ = a.Set(ctx, "k", "v2", time.Minute)
+	eventually(t, func() bool {
+		ok, _ := bL1.Contains(ctx, "k")
+		return !ok
+	})
+	if v, _ := b.Get(ctx, "k"); v != "v2" {
+		t.Fatalf("b get after update = %v", v)
+	}
+	if v, _ := aL1.Get(ctx, "k"); v != "v2" {
+		t.Fatalf("a l1 = %v", v)
+	}
+
+	_ = b.Delete(ctx, "k")
+	eventually(t, func() bool {
+		ok, _ := aL1.Contains(ctx, "k")
+		return !ok
+	})
+	if v, _ := a.Get(ctx, "k"); v != nil {
+		t.Fatalf("a get after delete = %v", v)
+	}
+
+	_, _ = a.GetOrSet(ctx, "x", "y", 0)
+	_, _ = b.Get(ctx, "x")
+	_ = a.Clear(ctx)
+	eventually(t, func() bool {
+		size, _ := bL1.Size(ctx)
+		return size == 0
+	})
+}
+
+func TestAdapterTwoLevelTags(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	a, _ := newReplica(t, s.Addr())
+	b, bL1 := newReplica(t, s.Addr())
+
+	_ = cache.SetWithTags(ctx, a, "user:1:profile", "p1", time.Minute, "user:1")
+	_ = a.Set(ctx, "user:2:profile", "p2", time.Minute)
+	// b 回源写入 L1, L1 中没有标签
+	_, _ = b.Get(ctx, "user:1:profile")
+	_, _ = b.Get(ctx, "user:2:profile")
+
+	if err = cache.InvalidateTag(ctx, a, "user:1"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		ok, _ := bL1.Contains(ctx, "user:1:profile")
+		return !ok
+	})
+
+	if err = cache.DeleteByPrefix(ctx, a, "user:"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		ok, _ := bL1.Contains(ctx, "user:2:profile")
+		return !ok
+	})
+}
+
+func TestAdapterTwoLevelObserver(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	stats := cache.NewStats()
+	l2 := redis.NewAdapterRedis(redis.Addr(s.Addr()))
+	c, err := NewAdapterTwoLevel(local.NewAdapterLocal(), l2, Namespace("user"), Observer(stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	_ = l2.Set(ctx, "k", "v", time.Minute)
+	// L1 未命中, L2 命中并回填; 再次读取 L1 命中
+	_, _ = c.Get(ctx, "k")
+	_, _ = c.Get(ctx, "k")
+	// 两级都未命中
+	_, _ = c.Get(ctx, "missing")
+	s.Close()
+	if _, err = c.Get(ctx, "down"); err == nil {
+		t.Fatal("expected L2 error")
+	}
+
+	got := make(map[string]cache.StatsSnapshot)
+	for _, snapshot := range stats.Snapshot() {
+		got[snapshot.Namespace] = snapshot
+	}
+	if l1 := got["user:l1"]; l1.Hits != 1 || l1.Misses != 3 || l1.Backfills != 1 || l1.Errors != 0 {
+		t.Fatalf("l1 = %+v", l1)
+	}
+	if l2 := got["user:l2"]; l2.Hits != 1 || l2.Misses != 1 || l2.Errors != 1 {
+		t.Fatalf("l2 = %+v", l2)
+	}
+}
+
+func TestAdapterTwoLevelBackfillTTL(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	l1 := local.NewAdapterLocal()
+	l2 := redis.NewAdapterRedis(redis.Addr(s.Addr()))
+	// L1TTL(0) 时 L1 的有效期不受限制, 回填时仍以 L2 的剩余有效期为准
+	c, err := NewAdapterTwoLevel(l1, l2, L1TTL(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(ctx)
+
+	_ = l2.Set(ctx, "k", "v", 100*time.Millisecond)
+	if v, _ := c.Get(ctx, "k"); v != "v" {
+		t.Fatalf("get = %v", v)
+	}
+	if ttl, ok, _ := l1.(cache.TTLer).TTL(ctx, "k"); !ok || ttl <= 0 || ttl > 100*time.Millisecond {
+		t.Fatalf("l1 ttl = %v, %v", ttl, ok)
+	}
+	// L2 过期不广播失效消息
+	s.FastForward(100 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if v, _ := c.Get(ctx, "k"); v != nil {
+		t.Fatalf("get after L2 expired = %v", v)
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache/codec"
+)
+
+type (
+	TypedOptions struct {
+		// key 前缀, 用于区分不同业务的缓存
+		namespace string
+		// 远端缓存解码出的值不是 V 时, 用 codec 重新编解码为 V
+		codec      codec.Codec
+		loaderOpts []LoaderOption
+	}
+	TypedOption func(o *TypedOptions)
+)
+
+func Namespace(namespace string) TypedOption {
+	return func(o *TypedOptions) {
+		o.namespace = namespace
+	}
+}
+
+func ValueCodec(c codec.Codec) TypedOption {
+	return func(o *TypedOptions) {
+		o.codec = c
+	}
+}
+
+// LoadOptions GetOrLoad 使用的 Loader 配置
+func LoadOptions(opts ...LoaderOption) TypedOption {
+	return func(o *TypedOptions) {
+		o.loaderOpts = opts
+	}
+}
+
+// Typed 类型安全的缓存, 读取结果总是 V
+type Typed[K comparable, V any] struct {
+	adapter   Adapter
+	namespace string
+	codec     codec.Codec
+	loader    *Loader
+}
+
+func NewTyped[K comparable, V any](adapter Adapter, opts ...TypedOption) *Typed[K, V] {
+	o := &TypedOptions{
+		codec: codec.JSON,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Typed[K, V]{
+		adapter:   adapter,
+		namespace: o.namespace,
+		codec:     o.codec,
+		loader:    NewLoader(adapter, o.loaderOpts...),
+	}
+}
+
+// Get ok 为 false 表示 key 不存在
+func (t *Typed[K, V]) Get(ctx context.Context, key K) (value V, ok bool, err error) {
+	raw, err := t.adapter.Get(ctx, t.key(key))
+	if err != nil || raw == nil {
+		return value, false, err
+	}
+	value, err = t.convert(raw)
+	return value, err == nil, err
+}
+
+func (t *Typed[K, V]) Set(ctx context.Context, key K, value V, duration time.Duration) error {
+	return t.adapter.Set(ctx, t.key(key), value, duration)
+}
+
+func (t *Typed[K, V]) SetIfNotExist(ctx context.Context, key K, value V, duration time.Duration) (bool, error) {
+	return t.adapter.SetIfNotExist(ctx, t.key(key), value, duration)
+}
+
+func (t *Typed[K, V]) Delete(ctx context.Context, keys ...K) error {
+	fullKeys := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		fullKeys = append(fullKeys, t.key(key))
+	}
+	return t.adapter.Delete(ctx, fullKeys...)
+}
+
+func (t *Typed[K, V]) Contains(ctx context.Context, key K) (bool, error) {
+	return t.adapter.Contains(ctx, t.key(key))
+}
+
+// GetOrLoad 见 Loader.GetOrLoad, 写入的 key 应只通过 GetOrLoad 读取, 数据不存在时返回 ErrNotFound
+func (t *Typed[K, V]) GetOrLoad(ctx context.Context, key K, f func(ctx context.Context) (V, error), duration time.Duration) (value V, err error) {
+	raw, err := t.loader.GetOrLoad(ctx, t.key(key), func(ctx context.Context) (interface{}, error) {
+		return f(ctx)
+	}, duration)
+	if err != nil || raw == nil {
+		return value, err
+	}
+	return t.convert(raw)
+}
+
+func (t *Typed[K, V]) key(key K) string {
+	return t.namespace + KeyString(key)
+}
+
+// convert 本地缓存直接返回 V, 远端缓存解码出的 map/float64 等经 codec 转换为 V
+func (t *Typed[K, V]) convert(raw interface{}) (value V, err error) {
+	if v, ok := raw.(V); ok {
+		return v, nil
+	}
+	data, err := t.codec.Marshal(raw)
+	if err != nil {
+		return value, err
+	}
+	err = t.codec.Unmarshal(data, &value)
+	return value, err
+}
@@ -0,0 +1,65 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/cache"
+	"github.com/davveo/go-toolkit/cache/local"
+	"github.com/davveo/go-toolkit/cache/redis"
+)
+
+type profile struct {
+	ID   int64
+	Name string
+	Tags []string
+}
+
+func TestTyped(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	adapters := map[string]cache.Adapter{
+		"local": local.NewAdapterLocal(),
+		"redis": redis.NewAdapterRedis(redis.Addr(s.Addr())),
+	}
+	want := profile{ID: 1, Name: "lemon", Tags: []string{"a", "b"}}
+	for name, adapter := range adapters {
+		defer adapter.Close(ctx)
+		profiles := cache.NewTyped[int64, profile](adapter, cache.Namespace("profile:"))
+
+		if _, ok, _ := profiles.Get(ctx, 1); ok {
+			t.Fatalf("%s: unexpected hit", name)
+		}
+		if err = profiles.Set(ctx, 1, want, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := profiles.Get(ctx, 1)
+		if err != nil || !ok || got.Name != want.Name || len(got.Tags) != 2 {
+			t.Fatalf("%s: get = %+v, %v, %v", name, got, ok, err)
+		}
+		if ok, _ = adapter.Contains(ctx, "profile:1"); !ok {
+			t.Fatalf("%s: key not namespaced", name)
+		}
+
+		loaded, err := profiles.GetOrLoad(ctx, 2, func(ctx context.Context) (profile, error) {
+			return profile{ID: 2, Name: "loaded"}, nil
+		}, time.Minute)
+		if err != nil || loaded.ID != 2 {
+			t.Fatalf("%s: GetOrLoad = %+v, %v", name, loaded, err)
+		}
+		loaded, err = profiles.GetOrLoad(ctx, 2, func(ctx context.Context) (profile, error) {
+			t.Fatalf("%s: loader called on hit", name)
+			return profile{}, nil
+		}, time.Minute)
+		if err != nil || loaded.Name != "loaded" {
+			t.Fatalf("%s: cached GetOrLoad = %+v, %v", name, loaded, err)
+		}
+	}
+}
@@ -2,13 +2,61 @@ package dislock
 
 import (
 	"context"
+	"errors"
+	"time"
 )
 
-/*
-https://github.com/ggicci/distlock/blob/main/redis.go
-*/
+var (
+	// ErrNotObtained 锁被其他持有者占用, 或在超时时间内未能获得锁
+	ErrNotObtained = errors.New("dislock: lock not obtained")
+	// ErrNotHeld 锁已过期或已被其他持有者获得
+	ErrNotHeld = errors.New("dislock: lock not held")
+)
 
 type Lock interface {
-	Lock(ctx context.Context, key string)
-	UnLock(ctx context.Context, key string)
+	// Lock 阻塞直到获得锁或 ctx 结束
+	Lock(ctx context.Context, key string) (Handle, error)
+	// TryLock 在 timeout 内尝试获得锁, timeout <= 0 时只尝试一次, 未获得时返回 ErrNotObtained
+	TryLock(ctx context.Context, key string, timeout time.Duration) (Handle, error)
+}
+
+// Handle 已获得的锁
+type Handle interface {
+	Key() string
+	// Token 栅栏令牌, 同一个 key 每次加锁单调递增, 下游存储据此拒绝过期持有者的写入
+	Token() int64
+	// Lost 锁丢失(续期失败或已被释放)时关闭
+	Lost() <-chan struct{}
+	UnLock(ctx context.Context) error
+}
+
+// Backend 锁的存储实现, owner 为每次加锁生成的随机标识
+type Backend interface {
+	// Acquire 获取锁并返回栅栏令牌, 锁被占用时返回 ErrNotObtained
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (token int64, err error)
+	// Renew 延长租约, 锁不再属于 owner 时返回 ErrNotHeld
+	Renew(ctx context.Context, key, owner string, ttl time.Duration) error
+	// Release 释放锁, 锁不再属于 owner 时返回 ErrNotHeld;
+	// 加锁失败放弃等待时也会调用, 用于清除 owner 的排队状态
+	Release(ctx context.Context, key, owner string) error
+}
+
+// RWLock 读写锁, 同一时刻允许多个读者或一个写者
+type RWLock interface {
+	Lock
+	RLock(ctx context.Context, key string) (Handle, error)
+	TryRLock(ctx context.Context, key string, timeout time.Duration) (Handle, error)
+}
+
+// RWBackend 支持读写锁的存储实现, 写锁通过 Renew/Release 续期和释放;
+// 同一个 key 不应同时用作互斥锁和读写锁
+type RWBackend interface {
+	Backend
+	// AcquireWrite 没有写者和读者时获得写锁, 否则登记写意向并返回 ErrNotObtained,
+	// 写意向存在期间新的读者无法加锁, 避免写者饥饿; 放弃等待的写者通过 Release 清除写意向
+	AcquireWrite(ctx context.Context, key, owner string, ttl time.Duration) (token int64, err error)
+	// AcquireRead 没有写者和写意向时获得读锁, 返回当前的栅栏令牌
+	AcquireRead(ctx context.Context, key, owner string, ttl time.Duration) (token int64, err error)
+	RenewRead(ctx context.Context, key, owner string, ttl time.Duration) error
+	ReleaseRead(ctx context.Context, key, owner string) error
 }
@@ -0,0 +1,146 @@
+package dislock
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davveo/go-toolkit/logger"
+)
+
+type (
+	ElectionOptions struct {
+		// 成为 leader 后在新的 goroutine 中调用, ctx 在失去 leader 身份时取消
+		onElected func(ctx context.Context)
+		// 失去 leader 身份且 onElected 返回后调用
+		onRevoked func()
+		// 加锁出错(如存储不可用)后重新竞选的间隔
+		retryInterval time.Duration
+	}
+	ElectionOption func(o *ElectionOptions)
+)
+
+func OnElected(f func(ctx context.Context)) ElectionOption {
+	return func(o *ElectionOptions) {
+		o.onElected = f
+	}
+}
+
+func OnRevoked(f func()) ElectionOption {
+	return func(o *ElectionOptions) {
+		o.onRevoked = f
+	}
+}
+
+func CampaignInterval(interval time.Duration) ElectionOption {
+	return func(o *ElectionOptions) {
+		o.retryInterval = interval
+	}
+}
+
+// Election 基于 Lock 的 leader 选举, 持有锁的实例即 leader, 租约由锁的 watchdog 续期
+type Election struct {
+	lock Lock
+	key  string
+	opts *ElectionOptions
+
+	leader  int32
+	token   int64
+	changes chan bool
+}
+
+// NewElection lock 可以是任意后端的 Lock, 但必须开启 watchdog, 否则 leader 身份在 ttl 后丢失
+func NewElection(lock Lock, key string, opts ...ElectionOption) *Election {
+	o := &ElectionOptions{
+		onElected:     func(ctx context.Context) {},
+		onRevoked:     func() {},
+		retryInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Election{
+		lock:    lock,
+		key:     key,
+		opts:    o,
+		changes: make(chan bool, 1),
+	}
+}
+
+// Run 持续竞选, 失去 leader 身份后重新竞选, 阻塞直到 ctx 结束;
+// ctx 结束时如果是 leader 则主动让出并释放锁
+func (e *Election) Run(ctx context.Context) error {
+	for {
+		h, err := e.lock.Lock(ctx, e.key)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if logger.IsInitialized() {
+				logger.WarnErr("dislock: campaign failed", err, logger.KV("key", e.key))
+			}
+			if err = Sleep(ctx, e.opts.retryInterval); err != nil {
+				return err
+			}
+			continue
+		}
+		e.lead(ctx, h)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// lead 担任 leader 直到锁丢失或 ctx 结束
+func (e *Election) lead(ctx context.Context, h Handle) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	atomic.StoreInt64(&e.token, h.Token())
+	atomic.StoreInt32(&e.leader, 1)
+	e.notify(true)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		e.opts.onElected(leaderCtx)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-h.Lost():
+	}
+	cancel()
+	// 等待 leader 的工作结束后再释放锁, 避免新旧 leader 同时工作
+	wg.Wait()
+
+	atomic.StoreInt32(&e.leader, 0)
+	e.notify(false)
+	e.opts.onRevoked()
+
+	unlockCtx, unlockCancel := context.WithTimeout(context.Background(), time.Second)
+	defer unlockCancel()
+	_ = h.UnLock(unlockCtx)
+}
+
+// notify 只保留最新的状态, 消费不及时不会阻塞选举
+func (e *Election) notify(leader bool) {
+	select {
+	case <-e.changes:
+	default:
+	}
+	e.changes <- leader
+}
+
+func (e *Election) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Token 最近一次当选时锁的栅栏令牌, leader 向下游写入时携带
+func (e *Election) Token() int64 {
+	return atomic.LoadInt64(&e.token)
+}
+
+// Changes leader 身份变化时发送新的身份, 只保留最新一次变化
+func (e *Election) Changes() <-chan bool {
+	return e.changes
+}
@@ -0,0 +1,166 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// 每个 owner 在 prefix+key+"/" 下写入一个绑定租约的排队 key, create revision 最小者持有锁,
+// 与 clientv3/concurrency.Mutex 的做法一致. 排队 key 在放弃等待或租约到期时删除,
+// 持有者的 create revision 即栅栏令牌, 由 etcd 全局递增的 revision 保证单调.
+
+type backend struct {
+	client *clientv3.Client
+	prefix string
+
+	mu sync.Mutex
+	// 每次加锁(key, owner)独占一个租约, 撤销租约即释放锁
+	leases map[leaseKey]clientv3.LeaseID
+}
+
+type leaseKey struct {
+	key, owner string
+}
+
+// NewBackend 基于租约和 revision 排队的锁存储, client 可以来自 embed.Etcd 的 v3client
+func NewBackend(client *clientv3.Client, opts ...Option) dislock.Backend {
+	o := &Options{prefix: defaultPrefix}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &backend{
+		client: client,
+		prefix: o.prefix,
+		leases: make(map[leaseKey]clientv3.LeaseID),
+	}
+}
+
+// NewLock 等价于 dislock.New(NewBackend(client), opts...)
+func NewLock(client *clientv3.Client, opts ...dislock.Option) dislock.Lock {
+	return dislock.New(NewBackend(client), opts...)
+}
+
+func (b *backend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	token, err := b.acquire(ctx, key, owner, ttl)
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		// 等待期间租约过期, 重新申请租约后再排队
+		b.forget(key, owner)
+		token, err = b.acquire(ctx, key, owner, ttl)
+	}
+	return token, err
+}
+
+func (b *backend) acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	lease, err := b.lease(ctx, key, owner, ttl)
+	if err != nil {
+		return 0, err
+	}
+	myKey := b.ownerKey(key, owner)
+	getHolder := clientv3.OpGet(b.keyPrefix(key), clientv3.WithFirstCreate()...)
+	resp, err := b.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(myKey), "=", 0)).
+		Then(clientv3.OpPut(myKey, "", clientv3.WithLease(lease)), getHolder).
+		Else(clientv3.OpGet(myKey), getHolder).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	myRev := resp.Header.Revision
+	if !resp.Succeeded {
+		myRev = resp.Responses[0].GetResponseRange().Kvs[0].CreateRevision
+	}
+	holder := resp.Responses[1].GetResponseRange().Kvs
+	if len(holder) > 0 && holder[0].CreateRevision != myRev {
+		return 0, dislock.ErrNotObtained
+	}
+	return myRev, nil
+}
+
+func (b *backend) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	lease, ok := b.leaseOf(key, owner)
+	if !ok {
+		return dislock.ErrNotHeld
+	}
+	if _, err := b.client.KeepAliveOnce(ctx, lease); err != nil {
+		if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			b.forget(key, owner)
+			return dislock.ErrNotHeld
+		}
+		return err
+	}
+	// 排队 key 被外部删除时锁已不属于 owner
+	resp, err := b.client.Get(ctx, b.ownerKey(key, owner), clientv3.WithCountOnly())
+	if err != nil {
+		return err
+	}
+	if resp.Count == 0 {
+		return dislock.ErrNotHeld
+	}
+	return nil
+}
+
+// Release 撤销租约, 同时删除 owner 的排队 key
+func (b *backend) Release(ctx context.Context, key, owner string) error {
+	lease, ok := b.leaseOf(key, owner)
+	if !ok {
+		return dislock.ErrNotHeld
+	}
+	_, err := b.client.Revoke(ctx, lease)
+	if err == nil || errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		b.forget(key, owner)
+	}
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return dislock.ErrNotHeld
+	}
+	return err
+}
+
+func (b *backend) lease(ctx context.Context, key, owner string, ttl time.Duration) (clientv3.LeaseID, error) {
+	if lease, ok := b.leaseOf(key, owner); ok {
+		return lease, nil
+	}
+	resp, err := b.client.Grant(ctx, seconds(ttl))
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	b.leases[leaseKey{key, owner}] = resp.ID
+	b.mu.Unlock()
+	return resp.ID, nil
+}
+
+func (b *backend) leaseOf(key, owner string) (clientv3.LeaseID, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lease, ok := b.leases[leaseKey{key, owner}]
+	return lease, ok
+}
+
+func (b *backend) forget(key, owner string) {
+	b.mu.Lock()
+	delete(b.leases, leaseKey{key, owner})
+	b.mu.Unlock()
+}
+
+func (b *backend) keyPrefix(key string) string {
+	return b.prefix + key + "/"
+}
+
+func (b *backend) ownerKey(key, owner string) string {
+	return b.keyPrefix(key) + owner
+}
+
+// seconds etcd 租约以秒为单位, 向上取整
+func seconds(d time.Duration) int64 {
+	s := int64((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		return 1
+	}
+	return s
+}
@@ -0,0 +1,155 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+	"github.com/google/uuid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// endpoint TestMain 启动的 embed.Etcd 的客户端地址
+var endpoint string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "dislock-etcd")
+	if err != nil {
+		panic(err)
+	}
+	e, err := startEtcd(dir)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		panic(err)
+	}
+	endpoint = e.Clients[0].Addr().String()
+	code := m.Run()
+	e.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startEtcd 在 dir 中启动单节点 etcd, 监听随机端口
+func startEtcd(dir string) (*embed.Etcd, error) {
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	u, _ := url.Parse("http://127.0.0.1:0")
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*u}, []url.URL{*u}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*u}, []url.URL{*u}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+		return e, nil
+	case err = <-e.Err():
+	case <-time.After(10 * time.Second):
+		err = errors.New("etcd not ready")
+	}
+	e.Close()
+	return nil, err
+}
+
+func newTestClient(t *testing.T) *clientv3.Client {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	key := "/dislock-test/" + uuid.New().String()
+	l := NewLock(client, dislock.TTL(5*time.Second))
+
+	h, err := l.Lock(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.TryLock(ctx, key, 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	// 放弃等待的排队 key 已被删除
+	resp, err := client.Get(ctx, defaultPrefix+key+"/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 1 {
+		t.Fatalf("queued keys = %d, want 1", resp.Count)
+	}
+	if err = h.UnLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h2, err := l.TryLock(ctx, key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2.Token() <= h.Token() {
+		t.Fatalf("token = %d, want > %d", h2.Token(), h.Token())
+	}
+	_ = h2.UnLock(ctx)
+}
+
+func TestLockOrder(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	key := "/dislock-test/" + uuid.New().String()
+	l := NewLock(client, dislock.TTL(5*time.Second), dislock.RetryInterval(10*time.Millisecond))
+
+	h, err := l.Lock(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先排队的等待者先获得锁
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			h, err := l.Lock(ctx, key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			_ = h.UnLock(ctx)
+		}(i)
+		time.Sleep(100 * time.Millisecond)
+	}
+	_ = h.UnLock(ctx)
+	if first, second := <-order, <-order; first != 0 || second != 1 {
+		t.Fatalf("order = %d, %d", first, second)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	key := "/dislock-test/" + uuid.New().String()
+	l := NewLock(client, dislock.TTL(3*time.Second))
+
+	h, err := l.Lock(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Delete(ctx, defaultPrefix+key+"/", clientv3.WithPrefix()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Lost():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Lost not closed after key was deleted")
+	}
+}
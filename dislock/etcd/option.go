@@ -0,0 +1,17 @@
+package etcd
+
+const defaultPrefix = "/dislock/"
+
+type (
+	Options struct {
+		// 锁 key 前缀
+		prefix string
+	}
+	Option func(o *Options)
+)
+
+func Prefix(prefix string) Option {
+	return func(o *Options) {
+		o.prefix = prefix
+	}
+}
@@ -0,0 +1,207 @@
+package dislock
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ops 一种加锁模式(互斥/读/写)在存储上的操作
+type ops struct {
+	acquire func(ctx context.Context, key, owner string, ttl time.Duration) (int64, error)
+	renew   func(ctx context.Context, key, owner string, ttl time.Duration) error
+	release func(ctx context.Context, key, owner string) error
+}
+
+func backendOps(backend Backend) ops {
+	return ops{acquire: backend.Acquire, renew: backend.Renew, release: backend.Release}
+}
+
+type mutex struct {
+	ops  ops
+	opts *Options
+}
+
+// New 基于 Backend 的互斥锁, 负责重试和自动续期
+func New(backend Backend, opts ...Option) Lock {
+	return newMutex(backendOps(backend), newOptions(opts))
+}
+
+func newMutex(ops ops, opts *Options) *mutex {
+	return &mutex{ops: ops, opts: opts}
+}
+
+func (m *mutex) Lock(ctx context.Context, key string) (Handle, error) {
+	return m.lock(ctx, key, uuid.New().String())
+}
+
+func (m *mutex) TryLock(ctx context.Context, key string, timeout time.Duration) (Handle, error) {
+	return m.tryLock(ctx, key, uuid.New().String(), timeout)
+}
+
+func (m *mutex) tryLock(ctx context.Context, key, owner string, timeout time.Duration) (*handle, error) {
+	if timeout <= 0 {
+		token, err := m.ops.acquire(ctx, key, owner, m.opts.ttl)
+		if err != nil {
+			m.abandon(key, owner)
+			return nil, err
+		}
+		return m.newHandle(key, owner, token), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	h, err := m.lock(ctx, key, owner)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrNotObtained
+	}
+	return h, err
+}
+
+func (m *mutex) lock(ctx context.Context, key, owner string) (h *handle, err error) {
+	defer func() {
+		if err != nil {
+			m.abandon(key, owner)
+		}
+	}()
+	for {
+		token, err := m.ops.acquire(ctx, key, owner, m.opts.ttl)
+		if err == nil {
+			return m.newHandle(key, owner, token), nil
+		}
+		if expired(ctx) {
+			return nil, context.DeadlineExceeded
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, ErrNotObtained) {
+			return nil, err
+		}
+		if err = Sleep(ctx, m.opts.retryInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// abandon 放弃等待时清除 owner 在存储上的排队状态(如写意向、排队 key), 失败时等待其租约过期
+func (m *mutex) abandon(key, owner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = m.ops.release(ctx, key, owner)
+}
+
+func (m *mutex) newHandle(key, owner string, token int64) *handle {
+	h := &handle{
+		ops:   m.ops,
+		key:   key,
+		owner: owner,
+		token: token,
+		ttl:   m.opts.ttl,
+		lost:  make(chan struct{}),
+		stop:  make(chan struct{}),
+	}
+	if m.opts.watchdog {
+		h.wg.Add(1)
+		go h.watchdog()
+	}
+	return h
+}
+
+type handle struct {
+	ops   ops
+	key   string
+	owner string
+	token int64
+	ttl   time.Duration
+
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func (h *handle) Key() string {
+	return h.key
+}
+
+func (h *handle) Token() int64 {
+	return h.token
+}
+
+func (h *handle) Lost() <-chan struct{} {
+	return h.lost
+}
+
+func (h *handle) UnLock(ctx context.Context) error {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+	h.wg.Wait()
+	defer h.markLost()
+	return h.ops.release(ctx, h.key, h.owner)
+}
+
+func (h *handle) markLost() {
+	h.lostOnce.Do(func() {
+		close(h.lost)
+	})
+}
+
+// watchdog 每 ttl/3 续期一次, 锁被抢占或续期持续失败超过 ttl 时标记丢失
+func (h *handle) watchdog() {
+	defer h.wg.Done()
+	interval := h.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(h.ttl)
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := h.ops.renew(ctx, h.key, h.owner, h.ttl)
+			cancel()
+			switch {
+			case err == nil:
+				deadline = time.Now().Add(h.ttl)
+			case errors.Is(err, ErrNotHeld), time.Now().After(deadline):
+				h.markLost()
+				return
+			}
+		}
+	}
+}
+
+// expired 客户端按 ctx 的截止时间设置连接超时, 可能先于 ctx.Err() 返回
+func expired(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+var (
+	randMu sync.Mutex
+	rnd    = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Sleep 等待 [d/2, d*3/2) 内的随机时长, ctx 结束时返回 ctx.Err()
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d > 0 {
+		randMu.Lock()
+		d = d/2 + time.Duration(rnd.Int63n(int64(d)))
+		randMu.Unlock()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+package dislock
+
+import "time"
+
+const (
+	defaultTTL           = 30 * time.Second
+	defaultRetryInterval = 50 * time.Millisecond
+	// 存储的过期时间精度为毫秒
+	minTTL = time.Millisecond
+)
+
+type (
+	Options struct {
+		// 租约时长, 持有者崩溃后最多 ttl 时间锁自动释放
+		ttl time.Duration
+		// 加锁失败后的重试间隔, 实际间隔在 [interval/2, interval*3/2) 内随机
+		retryInterval time.Duration
+		// 持有期间是否自动续期, 续期间隔为 ttl/3
+		watchdog bool
+	}
+	Option func(o *Options)
+)
+
+// TTL ttl <= 0 时使用默认值, 小于 1ms 时按 1ms 处理
+func TTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.ttl = ttl
+	}
+}
+
+func RetryInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.retryInterval = interval
+	}
+}
+
+func Watchdog(watchdog bool) Option {
+	return func(o *Options) {
+		o.watchdog = watchdog
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		ttl:           defaultTTL,
+		retryInterval: defaultRetryInterval,
+		watchdog:      true,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.ttl <= 0 {
+		o.ttl = defaultTTL
+	} else if o.ttl < minTTL {
+		o.ttl = minTTL
+	}
+	return o
+}
@@ -0,0 +1,104 @@
+package redis
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func waitChange(t *testing.T, e *dislock.Election, want bool) {
+	t.Helper()
+	select {
+	case leader := <-e.Changes():
+		if leader != want {
+			t.Fatalf("leader = %v, want %v", leader, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no leadership change to %v", want)
+	}
+}
+
+func TestElection(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	l := NewLock(client, dislock.TTL(150*time.Millisecond), dislock.RetryInterval(10*time.Millisecond))
+
+	var working int32
+	elected := func(ctx context.Context) {
+		if atomic.AddInt32(&working, 1) > 1 {
+			t.Error("more than one leader working")
+		}
+		<-ctx.Done()
+		atomic.AddInt32(&working, -1)
+	}
+	var revoked int32
+	e1 := dislock.NewElection(l, "leader", dislock.OnElected(elected), dislock.OnRevoked(func() {
+		atomic.AddInt32(&revoked, 1)
+	}))
+	e2 := dislock.NewElection(l, "leader", dislock.OnElected(elected))
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan error)
+	go func() { done1 <- e1.Run(ctx1) }()
+	waitChange(t, e1, true)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go func() { _ = e2.Run(ctx2) }()
+	// 超过 ttl 后 leader 仍由 e1 担任
+	time.Sleep(300 * time.Millisecond)
+	if !e1.IsLeader() || e2.IsLeader() {
+		t.Fatalf("IsLeader = %v, %v", e1.IsLeader(), e2.IsLeader())
+	}
+
+	// e1 退出时主动让出, e2 接任
+	cancel1()
+	waitChange(t, e1, false)
+	if err = <-done1; err != context.Canceled {
+		t.Fatalf("Run = %v", err)
+	}
+	if atomic.LoadInt32(&revoked) != 1 {
+		t.Fatal("OnRevoked not called")
+	}
+	waitChange(t, e2, true)
+	if e2.Token() <= e1.Token() {
+		t.Fatalf("token = %d, want > %d", e2.Token(), e1.Token())
+	}
+}
+
+func TestElectionLost(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	l := NewLock(client, dislock.TTL(60*time.Millisecond), dislock.RetryInterval(10*time.Millisecond))
+
+	e := dislock.NewElection(l, "leader")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = e.Run(ctx) }()
+	waitChange(t, e, true)
+	token := e.Token()
+
+	// 锁被抢占后失去 leader 身份, 锁释放后重新当选
+	s.Set("dislock:{leader}", "someone")
+	waitChange(t, e, false)
+	s.Del("dislock:{leader}")
+	waitChange(t, e, true)
+	if e.Token() <= token {
+		t.Fatalf("token = %d, want > %d", e.Token(), token)
+	}
+}
@@ -0,0 +1,51 @@
+package redis
+
+import "time"
+
+const (
+	defaultPrefix      = "dislock:"
+	defaultDriftFactor = 0.01
+	defaultNodeTimeout = 50 * time.Millisecond
+)
+
+type (
+	Options struct {
+		// 锁 key 前缀
+		prefix string
+		// Redlock 时钟漂移系数, 锁有效期扣除 ttl*driftFactor+2ms
+		driftFactor float64
+		// Redlock 单个节点的请求超时, 应远小于 ttl, 避免在故障节点上耗尽有效期
+		nodeTimeout time.Duration
+	}
+	Option func(o *Options)
+)
+
+func Prefix(prefix string) Option {
+	return func(o *Options) {
+		o.prefix = prefix
+	}
+}
+
+func DriftFactor(factor float64) Option {
+	return func(o *Options) {
+		o.driftFactor = factor
+	}
+}
+
+func NodeTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.nodeTimeout = timeout
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		prefix:      defaultPrefix,
+		driftFactor: defaultDriftFactor,
+		nodeTimeout: defaultNodeTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+// 参考 https://github.com/ggicci/distlock/blob/main/redis.go
+
+// acquireScript 加锁成功后递增栅栏计数器, 计数器永不过期以保证令牌单调递增
+const acquireScript = `
+if redis.call("set", KEYS[1], ARGV[1], "nx", "px", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0`
+
+// renewScript 仅续期自己持有的锁
+const renewScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`
+
+// releaseScript 仅删除自己持有的锁, 未持有时清除自己登记的写意向
+const releaseScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+if redis.call("get", KEYS[2]) == ARGV[1] then
+	redis.call("del", KEYS[2])
+end
+return 0`
+
+type backend struct {
+	client goredis.UniversalClient
+	prefix string
+}
+
+// NewBackend 基于 SET NX PX 的锁存储, 锁 key 与栅栏计数器使用同一个 hash tag, 兼容集群模式
+func NewBackend(client goredis.UniversalClient, opts ...Option) dislock.RWBackend {
+	o := newOptions(opts)
+	return &backend{client: client, prefix: o.prefix}
+}
+
+// NewLock 等价于 dislock.New(NewBackend(client), opts...)
+func NewLock(client goredis.UniversalClient, opts ...dislock.Option) dislock.Lock {
+	return dislock.New(NewBackend(client), opts...)
+}
+
+func (b *backend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	token, err := b.eval(ctx, acquireScript, []string{b.key(key), b.fenceKey(key)}, owner, milliseconds(ttl))
+	if err != nil {
+		return 0, err
+	}
+	if token == 0 {
+		return 0, dislock.ErrNotObtained
+	}
+	return token, nil
+}
+
+func (b *backend) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	n, err := b.eval(ctx, renewScript, []string{b.key(key)}, owner, milliseconds(ttl))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return dislock.ErrNotHeld
+	}
+	return nil
+}
+
+func (b *backend) Release(ctx context.Context, key, owner string) error {
+	n, err := b.eval(ctx, releaseScript, []string{b.key(key), b.intentKey(key)}, owner)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return dislock.ErrNotHeld
+	}
+	return nil
+}
+
+func (b *backend) eval(ctx context.Context, script string, keys []string, args ...interface{}) (int64, error) {
+	cmdArgs := make([]interface{}, 0, 3+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, "eval", script, len(keys))
+	for _, key := range keys {
+		cmdArgs = append(cmdArgs, key)
+	}
+	cmdArgs = append(cmdArgs, args...)
+	cmd := goredis.NewIntCmd(cmdArgs...)
+	if err := b.client.ProcessContext(ctx, cmd); err != nil && !errors.Is(err, goredis.Nil) {
+		return 0, err
+	}
+	return cmd.Val(), nil
+}
+
+func (b *backend) key(key string) string {
+	return b.prefix + "{" + key + "}"
+}
+
+func (b *backend) fenceKey(key string) string {
+	return b.key(key) + ":fence"
+}
+
+func (b *backend) readersKey(key string) string {
+	return b.key(key) + ":readers"
+}
+
+func (b *backend) intentKey(key string) string {
+	return b.key(key) + ":intent"
+}
+
+func milliseconds(d time.Duration) int64 {
+	if d < time.Millisecond {
+		return 1
+	}
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,187 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func newTestLock(t *testing.T, opts ...dislock.Option) (dislock.Lock, *miniredis.Miniredis) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewLock(client, opts...), s
+}
+
+func TestLockUnLock(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLock(t)
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	if err = h.UnLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Lost():
+	default:
+		t.Fatal("Lost not closed after UnLock")
+	}
+	if err = h.UnLock(ctx); !errors.Is(err, dislock.ErrNotHeld) {
+		t.Fatalf("second UnLock = %v, want ErrNotHeld", err)
+	}
+	h, err = l.TryLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = h.UnLock(ctx)
+}
+
+func TestTryLockTimeout(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLock(t, dislock.RetryInterval(10*time.Millisecond))
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err = l.TryLock(ctx, "k", 100*time.Millisecond); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("TryLock returned after %v", elapsed)
+	}
+
+	// 超时内释放则能获得锁
+	time.AfterFunc(50*time.Millisecond, func() { _ = h.UnLock(ctx) })
+	h, err = l.TryLock(ctx, "k", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = h.UnLock(ctx)
+}
+
+func TestMutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLock(t, dislock.RetryInterval(5*time.Millisecond))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		holders int
+		tokens  []int64
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := l.Lock(ctx, "k")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > 1 {
+				t.Error("lock held by more than one owner")
+			}
+			tokens = append(tokens, h.Token())
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			_ = h.UnLock(ctx)
+		}()
+	}
+	wg.Wait()
+	// 栅栏令牌按加锁顺序单调递增
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] <= tokens[i-1] {
+			t.Fatalf("tokens not increasing: %v", tokens)
+		}
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	ctx := context.Background()
+	l, s := newTestLock(t, dislock.TTL(150*time.Millisecond))
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// miniredis 不会自动流逝时间, 手动缩短 TTL 后由 watchdog 续期
+	s.SetTTL("dislock:{k}", time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if ttl := s.TTL("dislock:{k}"); ttl < 100*time.Millisecond {
+		t.Fatalf("ttl = %v, lock not renewed", ttl)
+	}
+
+	// 锁被外部删除后 watchdog 标记丢失
+	s.Del("dislock:{k}")
+	select {
+	case <-h.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed after lock was deleted")
+	}
+	if err = h.UnLock(ctx); !errors.Is(err, dislock.ErrNotHeld) {
+		t.Fatalf("UnLock = %v, want ErrNotHeld", err)
+	}
+}
+
+func TestInvalidTTL(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		ttl, want time.Duration
+	}{
+		{0, 30 * time.Second},
+		{-time.Second, 30 * time.Second},
+		{time.Nanosecond, time.Millisecond},
+	} {
+		// ttl 过小时 watchdog 不能 panic
+		l, s := newTestLock(t, dislock.TTL(c.ttl))
+		h, err := l.Lock(ctx, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl := s.TTL("dislock:{k}"); ttl != c.want {
+			t.Fatalf("TTL(%v): ttl = %v, want %v", c.ttl, ttl, c.want)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if err = h.UnLock(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLockContextCanceled(t *testing.T) {
+	l, _ := newTestLock(t)
+	h, err := l.Lock(context.Background(), "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.UnLock(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = l.Lock(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+// fenceScript 将栅栏计数器推进到不小于 ARGV[1], 使下一次任意多数派加锁得到的令牌仍然递增
+const fenceScript = `
+local v = tonumber(redis.call("get", KEYS[1]) or "0")
+if v < tonumber(ARGV[1]) then
+	redis.call("set", KEYS[1], ARGV[1])
+end
+return 0`
+
+type redlock struct {
+	nodes       []*backend
+	quorum      int
+	driftFactor float64
+	nodeTimeout time.Duration
+}
+
+// NewRedlockBackend 在 N 个相互独立的 redis 实例上实现 Redlock,
+// 多数派(N/2+1)加锁成功且扣除耗时和时钟漂移后仍有剩余有效期才视为获得锁.
+// 令牌取多数派计数器的最大值, 并回写到成功的节点上, 任意两个多数派至少有一个公共节点, 因此令牌单调递增.
+func NewRedlockBackend(clients []goredis.UniversalClient, opts ...Option) dislock.Backend {
+	o := newOptions(opts)
+	nodes := make([]*backend, 0, len(clients))
+	for _, client := range clients {
+		nodes = append(nodes, &backend{client: client, prefix: o.prefix})
+	}
+	return &redlock{
+		nodes:       nodes,
+		quorum:      len(nodes)/2 + 1,
+		driftFactor: o.driftFactor,
+		nodeTimeout: o.nodeTimeout,
+	}
+}
+
+// NewRedlock 等价于 dislock.New(NewRedlockBackend(clients), opts...), 重试间隔自带随机抖动
+func NewRedlock(clients []goredis.UniversalClient, opts ...dislock.Option) dislock.Lock {
+	return dislock.New(NewRedlockBackend(clients), opts...)
+}
+
+func (r *redlock) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	start := time.Now()
+	tokens, errs := r.each(ctx, func(ctx context.Context, node *backend) (int64, error) {
+		return node.Acquire(ctx, key, owner, ttl)
+	})
+	var (
+		acquired []*backend
+		token    int64
+	)
+	for i, err := range errs {
+		if err == nil {
+			acquired = append(acquired, r.nodes[i])
+			if tokens[i] > token {
+				token = tokens[i]
+			}
+		}
+	}
+	drift := time.Duration(float64(ttl)*r.driftFactor) + 2*time.Millisecond
+	validity := ttl - time.Since(start) - drift
+	// 令牌回写到多数派才能保证单调递增, 回写失败的节点不计入
+	if len(acquired) >= r.quorum && validity > 0 && r.fence(ctx, acquired, key, token) >= r.quorum {
+		return token, nil
+	}
+	// 未达到多数派, 释放所有节点(包括响应超时但可能已加锁的节点)
+	r.each(context.Background(), func(ctx context.Context, node *backend) (int64, error) {
+		return 0, node.Release(ctx, key, owner)
+	})
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if len(acquired) == 0 {
+		if err := firstError(errs); err != nil {
+			return 0, err
+		}
+	}
+	return 0, dislock.ErrNotObtained
+}
+
+// fence 并发地把 nodes 的栅栏计数器推进到 token, 返回成功的节点数
+func (r *redlock) fence(ctx context.Context, nodes []*backend, key string, token int64) int {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		n  int
+	)
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *backend) {
+			defer wg.Done()
+			nodeCtx, cancel := context.WithTimeout(ctx, r.nodeTimeout)
+			defer cancel()
+			if _, err := node.eval(nodeCtx, fenceScript, []string{node.fenceKey(key)}, token); err == nil {
+				mu.Lock()
+				n++
+				mu.Unlock()
+			}
+		}(node)
+	}
+	wg.Wait()
+	return n
+}
+
+// Renew 多数派续期成功即可, 多数派已不属于 owner 时返回 ErrNotHeld
+func (r *redlock) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	_, errs := r.each(ctx, func(ctx context.Context, node *backend) (int64, error) {
+		return 0, node.Renew(ctx, key, owner, ttl)
+	})
+	renewed, notHeld := count(errs)
+	switch {
+	case renewed >= r.quorum:
+		return nil
+	case notHeld > len(r.nodes)-r.quorum:
+		return dislock.ErrNotHeld
+	default:
+		return firstError(errs)
+	}
+}
+
+func (r *redlock) Release(ctx context.Context, key, owner string) error {
+	_, errs := r.each(ctx, func(ctx context.Context, node *backend) (int64, error) {
+		return 0, node.Release(ctx, key, owner)
+	})
+	released, notHeld := count(errs)
+	switch {
+	case released > 0:
+		return nil
+	case notHeld == len(r.nodes):
+		return dislock.ErrNotHeld
+	default:
+		return firstError(errs)
+	}
+}
+
+// each 并发地在所有节点上执行 fn, 每个节点单独限时
+func (r *redlock) each(ctx context.Context, fn func(ctx context.Context, node *backend) (int64, error)) ([]int64, []error) {
+	values := make([]int64, len(r.nodes))
+	errs := make([]error, len(r.nodes))
+	var wg sync.WaitGroup
+	for i, node := range r.nodes {
+		wg.Add(1)
+		go func(i int, node *backend) {
+			defer wg.Done()
+			nodeCtx, cancel := context.WithTimeout(ctx, r.nodeTimeout)
+			defer cancel()
+			values[i], errs[i] = fn(nodeCtx, node)
+		}(i, node)
+	}
+	wg.Wait()
+	return values, errs
+}
+
+func count(errs []error) (ok, notHeld int) {
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, dislock.ErrNotHeld):
+			notHeld++
+		}
+	}
+	return ok, notHeld
+}
+
+// firstError 返回第一个非锁语义的错误(网络错误等)
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, dislock.ErrNotObtained) && !errors.Is(err, dislock.ErrNotHeld) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func newTestNodes(t *testing.T, n int) ([]*miniredis.Miniredis, []goredis.UniversalClient) {
+	servers := make([]*miniredis.Miniredis, 0, n)
+	clients := make([]goredis.UniversalClient, 0, n)
+	for i := 0; i < n; i++ {
+		s, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(s.Close)
+		client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		servers = append(servers, s)
+		clients = append(clients, client)
+	}
+	return servers, clients
+}
+
+func TestRedlock(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newTestNodes(t, 5)
+	l := NewRedlock(clients)
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range servers {
+		if !s.Exists("dislock:{k}") {
+			t.Fatalf("lock missing on node %d", i)
+		}
+	}
+	if _, err = l.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	if err = h.UnLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range servers {
+		if s.Exists("dislock:{k}") {
+			t.Fatalf("lock not released on node %d", i)
+		}
+	}
+}
+
+func TestRedlockMinorityFailure(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newTestNodes(t, 5)
+	l := NewRedlock(clients)
+
+	servers[0].Close()
+	servers[1].Close()
+	h, err := l.TryLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("TryLock with 2/5 nodes down = %v", err)
+	}
+	if err = h.UnLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 少数节点被其他持有者占用时仍能获得锁
+	servers[2].Set("dislock:{other}", "someone")
+	servers[3].Set("dislock:{other}", "someone")
+	if _, err = l.TryLock(ctx, "other", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock with 2/3 live nodes held = %v, want ErrNotObtained", err)
+	}
+	// 失败时已加锁的节点要回滚
+	if servers[4].Exists("dislock:{other}") {
+		t.Fatal("partial lock not rolled back")
+	}
+}
+
+func TestRedlockMinorityHeld(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newTestNodes(t, 5)
+	l := NewRedlock(clients)
+
+	servers[0].Set("dislock:{k}", "someone")
+	servers[1].Set("dislock:{k}", "someone")
+	h, err := l.TryLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("TryLock with 2/5 nodes held = %v", err)
+	}
+	_ = h.UnLock(ctx)
+	if v, _ := servers[0].Get("dislock:{k}"); v != "someone" {
+		t.Fatal("UnLock released a lock owned by someone else")
+	}
+
+	servers[2].Set("dislock:{k}", "someone")
+	if _, err = l.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock with 3/5 nodes held = %v, want ErrNotObtained", err)
+	}
+	for _, s := range servers[3:] {
+		if s.Exists("dislock:{k}") {
+			t.Fatal("partial lock not rolled back")
+		}
+	}
+}
+
+func TestRedlockMajorityFailure(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newTestNodes(t, 5)
+	l := NewRedlock(clients, dislock.RetryInterval(10*time.Millisecond))
+
+	for _, s := range servers[:3] {
+		s.Close()
+	}
+	if _, err := l.TryLock(ctx, "k", 50*time.Millisecond); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock with 3/5 nodes down = %v, want ErrNotObtained", err)
+	}
+	for _, s := range servers[3:] {
+		if s.Exists("dislock:{k}") {
+			t.Fatal("partial lock not rolled back")
+		}
+	}
+}
+
+func TestRedlockFencingToken(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newTestNodes(t, 3)
+	b := NewRedlockBackend(clients)
+
+	// 每次只有不同的多数派可用, 令牌仍然递增
+	var last int64
+	for round := 0; round < 6; round++ {
+		down := servers[round%3]
+		down.SetError("down")
+		token, err := b.Acquire(ctx, "k", "owner", time.Second)
+		down.SetError("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token <= last {
+			t.Fatalf("round %d: token %d not greater than %d", round, token, last)
+		}
+		last = token
+		if err = b.Release(ctx, "k", "owner"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fenceFailure 使栅栏令牌回写失败, 其他命令正常执行
+type fenceFailure struct{}
+
+func (fenceFailure) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	if args := cmd.Args(); len(args) > 1 && args[1] == fenceScript {
+		return ctx, errors.New("fence failed")
+	}
+	return ctx, nil
+}
+
+func (fenceFailure) AfterProcess(ctx context.Context, cmd goredis.Cmder) error {
+	return nil
+}
+
+func (fenceFailure) BeforeProcessPipeline(ctx context.Context, cmds []goredis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (fenceFailure) AfterProcessPipeline(ctx context.Context, cmds []goredis.Cmder) error {
+	return nil
+}
+
+func TestRedlockFenceFailure(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newTestNodes(t, 3)
+	b := NewRedlockBackend(clients)
+
+	// 只有一个节点回写失败, 仍然达到多数派
+	clients[0].AddHook(fenceFailure{})
+	if _, err := b.Acquire(ctx, "k", "owner", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Release(ctx, "k", "owner"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个节点回写失败, 令牌无法保证递增, 加锁失败并释放所有节点
+	clients[1].AddHook(fenceFailure{})
+	if _, err := b.Acquire(ctx, "k", "owner", time.Second); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("err = %v", err)
+	}
+	for i, s := range servers {
+		if s.Exists("dislock:{k}") {
+			t.Fatalf("node %d still locked", i)
+		}
+	}
+}
+
+func TestRedlockRenewLost(t *testing.T) {
+	ctx := context.Background()
+	servers, clients := newTestNodes(t, 3)
+	l := NewRedlock(clients, dislock.TTL(150*time.Millisecond))
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 单个节点丢失锁不影响持有
+	servers[0].Del("dislock:{k}")
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-h.Lost():
+		t.Fatal("lock lost with quorum still held")
+	default:
+	}
+	servers[1].Del("dislock:{k}")
+	select {
+	case <-h.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed after quorum was lost")
+	}
+}
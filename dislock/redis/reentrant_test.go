@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func TestReentrant(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	l := dislock.NewReentrant(NewBackend(client))
+
+	job := dislock.WithOwner(context.Background(), "job")
+	outer, err := l.Lock(job, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := l.TryLock(job, "k", 0)
+	if err != nil {
+		t.Fatalf("reentry = %v", err)
+	}
+	if inner.Token() != outer.Token() {
+		t.Fatal("reentry acquired a new lock")
+	}
+	other := dislock.WithOwner(context.Background(), "other")
+	if _, err = l.TryLock(other, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("other owner = %v, want ErrNotObtained", err)
+	}
+	// 未指定 owner 时不可重入
+	if _, err = l.TryLock(context.Background(), "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("no owner = %v, want ErrNotObtained", err)
+	}
+
+	if err = inner.UnLock(job); err != nil {
+		t.Fatal(err)
+	}
+	if err = inner.UnLock(job); !errors.Is(err, dislock.ErrNotHeld) {
+		t.Fatalf("double UnLock = %v, want ErrNotHeld", err)
+	}
+	if _, err = l.TryLock(other, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatal("lock released before hold count reached zero")
+	}
+	if err = outer.UnLock(job); err != nil {
+		t.Fatal(err)
+	}
+	h, err := l.TryLock(other, "k", 0)
+	if err != nil {
+		t.Fatalf("after release = %v", err)
+	}
+	_ = h.UnLock(other)
+}
+
+func TestReentrantAcrossProcesses(t *testing.T) {
+	ctx := dislock.WithOwner(context.Background(), "job")
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+
+	// 模拟两个进程, 同名 owner 不能跨进程重入
+	crashed := dislock.NewReentrant(NewBackend(client), dislock.TTL(time.Second), dislock.Watchdog(false))
+	l := dislock.NewReentrant(NewBackend(client))
+	if _, err = crashed.Lock(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	// 持有者崩溃, 租约到期后锁被释放
+	s.FastForward(time.Second)
+	h, err := l.TryLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("TryLock after expiry = %v", err)
+	}
+	_ = h.UnLock(ctx)
+}
+
+func TestReentrantAfterLost(t *testing.T) {
+	ctx := dislock.WithOwner(context.Background(), "job")
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	l := dislock.NewReentrant(NewBackend(client), dislock.TTL(60*time.Millisecond))
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Del("dislock:{k}")
+	select {
+	case <-h.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed")
+	}
+	// 丢失后再次加锁重新获取, 而不是增加计数
+	h2, err := l.TryLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2.Token() <= h.Token() {
+		t.Fatalf("token = %d, want > %d", h2.Token(), h.Token())
+	}
+	_ = h2.UnLock(ctx)
+}
@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+// 读者保存在有序集合中, score 为各自租约的到期时间(redis 服务器时间, 毫秒),
+// 脚本执行前先清理已过期的读者, 读者崩溃后最多 ttl 时间写者即可获得锁.
+
+// acquireWriteScript 无写者和有效读者时加写锁, 否则登记写意向
+const acquireWriteScript = `
+redis.replicate_commands()
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("zremrangebyscore", KEYS[2], "-inf", now)
+if redis.call("exists", KEYS[1]) == 0 and redis.call("zcard", KEYS[2]) == 0 then
+	redis.call("set", KEYS[1], ARGV[1], "px", ARGV[2])
+	if redis.call("get", KEYS[3]) == ARGV[1] then
+		redis.call("del", KEYS[3])
+	end
+	return redis.call("incr", KEYS[4])
+end
+local intent = redis.call("get", KEYS[3])
+if not intent or intent == ARGV[1] then
+	redis.call("set", KEYS[3], ARGV[1], "px", ARGV[2])
+end
+return 0`
+
+// acquireReadScript 无写者和写意向时加读锁, 返回当前栅栏令牌, 失败返回 -1
+const acquireReadScript = `
+redis.replicate_commands()
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("zremrangebyscore", KEYS[2], "-inf", now)
+if redis.call("exists", KEYS[1]) == 1 or redis.call("exists", KEYS[3]) == 1 then
+	return -1
+end
+redis.call("zadd", KEYS[2], now + tonumber(ARGV[2]), ARGV[1])
+local last = redis.call("zrange", KEYS[2], -1, -1, "withscores")
+redis.call("pexpireat", KEYS[2], math.ceil(tonumber(last[2])))
+return tonumber(redis.call("get", KEYS[4]) or "0")`
+
+// renewReadScript 仅续期未过期的读锁
+const renewReadScript = `
+redis.replicate_commands()
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local score = redis.call("zscore", KEYS[1], ARGV[1])
+if not score or tonumber(score) <= now then
+	redis.call("zrem", KEYS[1], ARGV[1])
+	return 0
+end
+redis.call("zadd", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+local last = redis.call("zrange", KEYS[1], -1, -1, "withscores")
+redis.call("pexpireat", KEYS[1], math.ceil(tonumber(last[2])))
+return 1`
+
+// NewRWMutex 等价于 dislock.NewRWMutex(NewBackend(client), opts...)
+func NewRWMutex(client goredis.UniversalClient, opts ...dislock.Option) dislock.RWLock {
+	return dislock.NewRWMutex(NewBackend(client), opts...)
+}
+
+func (b *backend) AcquireWrite(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	keys := []string{b.key(key), b.readersKey(key), b.intentKey(key), b.fenceKey(key)}
+	token, err := b.eval(ctx, acquireWriteScript, keys, owner, milliseconds(ttl))
+	if err != nil {
+		return 0, err
+	}
+	if token == 0 {
+		return 0, dislock.ErrNotObtained
+	}
+	return token, nil
+}
+
+func (b *backend) AcquireRead(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	keys := []string{b.key(key), b.readersKey(key), b.intentKey(key), b.fenceKey(key)}
+	token, err := b.eval(ctx, acquireReadScript, keys, owner, milliseconds(ttl))
+	if err != nil {
+		return 0, err
+	}
+	if token < 0 {
+		return 0, dislock.ErrNotObtained
+	}
+	return token, nil
+}
+
+func (b *backend) RenewRead(ctx context.Context, key, owner string, ttl time.Duration) error {
+	n, err := b.eval(ctx, renewReadScript, []string{b.readersKey(key)}, owner, milliseconds(ttl))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return dislock.ErrNotHeld
+	}
+	return nil
+}
+
+func (b *backend) ReleaseRead(ctx context.Context, key, owner string) error {
+	cmd := goredis.NewIntCmd("zrem", b.readersKey(key), owner)
+	if err := b.client.ProcessContext(ctx, cmd); err != nil {
+		return err
+	}
+	if cmd.Val() == 0 {
+		return dislock.ErrNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/dislock"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func newTestRWMutex(t *testing.T, opts ...dislock.Option) (dislock.RWLock, *miniredis.Miniredis) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRWMutex(client, opts...), s
+}
+
+func TestRWMutex(t *testing.T) {
+	ctx := context.Background()
+	rw, _ := newTestRWMutex(t)
+
+	r1, err := rw.RLock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := rw.TryRLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("second reader = %v", err)
+	}
+	if _, err = rw.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock with readers = %v, want ErrNotObtained", err)
+	}
+	_ = r1.UnLock(ctx)
+	_ = r2.UnLock(ctx)
+
+	w, err := rw.TryLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("TryLock without readers = %v", err)
+	}
+	if _, err = rw.TryRLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryRLock with writer = %v, want ErrNotObtained", err)
+	}
+	if _, err = rw.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("second writer = %v, want ErrNotObtained", err)
+	}
+	_ = w.UnLock(ctx)
+
+	r, err := rw.TryRLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 读者拿到的是最近一次写锁的令牌
+	if r.Token() != w.Token() {
+		t.Fatalf("reader token = %d, want %d", r.Token(), w.Token())
+	}
+	_ = r.UnLock(ctx)
+}
+
+func TestRWMutexWriterNotStarved(t *testing.T) {
+	ctx := context.Background()
+	rw, _ := newTestRWMutex(t, dislock.RetryInterval(10*time.Millisecond))
+
+	r1, err := rw.RLock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan dislock.Handle)
+	go func() {
+		w, err := rw.Lock(ctx, "k")
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- w
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 写者等待期间新的读者无法加锁
+	if _, err = rw.TryRLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryRLock with waiting writer = %v, want ErrNotObtained", err)
+	}
+	_ = r1.UnLock(ctx)
+	select {
+	case w := <-acquired:
+		_ = w.UnLock(ctx)
+	case <-time.After(time.Second):
+		t.Fatal("writer not acquired after readers left")
+	}
+	r, err := rw.TryRLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("TryRLock after writer = %v", err)
+	}
+	_ = r.UnLock(ctx)
+}
+
+func TestRWMutexWriterGivesUp(t *testing.T) {
+	ctx := context.Background()
+	rw, _ := newTestRWMutex(t, dislock.RetryInterval(10*time.Millisecond))
+
+	r1, err := rw.RLock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.UnLock(ctx)
+	if _, err = rw.TryLock(ctx, "k", 50*time.Millisecond); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	// 放弃等待的写者清除写意向
+	r2, err := rw.TryRLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("TryRLock after writer gave up = %v", err)
+	}
+	_ = r2.UnLock(ctx)
+}
+
+func TestRWMutexReaderExpiry(t *testing.T) {
+	ctx := context.Background()
+	rw, _ := newTestRWMutex(t, dislock.TTL(100*time.Millisecond), dislock.Watchdog(false))
+
+	// 读者崩溃后不再续期, 租约到期后写者获得锁
+	if _, err := rw.RLock(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rw.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	w, err := rw.TryLock(ctx, "k", time.Second)
+	if err != nil {
+		t.Fatalf("TryLock after reader expired = %v", err)
+	}
+	_ = w.UnLock(ctx)
+}
+
+func TestRWMutexWriterExpiry(t *testing.T) {
+	ctx := context.Background()
+	rw, s := newTestRWMutex(t, dislock.TTL(100*time.Millisecond), dislock.Watchdog(false))
+
+	if _, err := rw.Lock(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rw.TryRLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryRLock = %v, want ErrNotObtained", err)
+	}
+	s.FastForward(100 * time.Millisecond)
+	r, err := rw.TryRLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatalf("TryRLock after writer expired = %v", err)
+	}
+	_ = r.UnLock(ctx)
+}
+
+func TestRWMutexReaderRenew(t *testing.T) {
+	ctx := context.Background()
+	rw, _ := newTestRWMutex(t, dislock.TTL(150*time.Millisecond))
+
+	r, err := rw.RLock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// watchdog 续期, 超过 ttl 后读锁仍有效
+	time.Sleep(300 * time.Millisecond)
+	if _, err = rw.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	select {
+	case <-r.Lost():
+		t.Fatal("reader lost")
+	default:
+	}
+	if err = r.UnLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package dislock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ownerKey struct{}
+
+// WithOwner 为 ctx 指定锁的持有者, 同一持有者对可重入锁重复加锁不会阻塞
+// owner 标识一条执行流(如一个批处理任务), 不应在并发的 goroutine 之间共享
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+func OwnerFromContext(ctx context.Context) (string, bool) {
+	owner, ok := ctx.Value(ownerKey{}).(string)
+	return owner, ok && owner != ""
+}
+
+type reentrant struct {
+	mutex *mutex
+	// 区分不同进程中同名的 owner
+	id    string
+	mu    sync.Mutex
+	holds map[string]*hold
+}
+
+type hold struct {
+	owner  string
+	count  int
+	handle *handle
+}
+
+// NewReentrant 可重入锁, 持有计数保存在本实例中, 计数归零时才释放存储上的锁;
+// ctx 未通过 WithOwner 指定持有者时与 New 相同
+func NewReentrant(backend Backend, opts ...Option) Lock {
+	return &reentrant{
+		mutex: newMutex(backendOps(backend), newOptions(opts)),
+		id:    uuid.New().String(),
+		holds: make(map[string]*hold),
+	}
+}
+
+func (r *reentrant) Lock(ctx context.Context, key string) (Handle, error) {
+	return r.acquire(ctx, key, func(owner string) (*handle, error) {
+		return r.mutex.lock(ctx, key, owner)
+	})
+}
+
+func (r *reentrant) TryLock(ctx context.Context, key string, timeout time.Duration) (Handle, error) {
+	return r.acquire(ctx, key, func(owner string) (*handle, error) {
+		return r.mutex.tryLock(ctx, key, owner, timeout)
+	})
+}
+
+func (r *reentrant) acquire(ctx context.Context, key string, lock func(owner string) (*handle, error)) (Handle, error) {
+	owner, ok := OwnerFromContext(ctx)
+	if !ok {
+		return lock(uuid.New().String())
+	}
+	if h := r.reenter(key, owner); h != nil {
+		return h, nil
+	}
+	inner, err := lock(r.id + ":" + owner)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := &hold{owner: owner, count: 1, handle: inner}
+	r.holds[key] = h
+	return &reentrantHandle{handle: inner, r: r, key: key, hold: h}, nil
+}
+
+// reenter 已持有且未丢失时增加持有计数
+func (r *reentrant) reenter(key, owner string) Handle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.holds[key]
+	if !ok || h.owner != owner {
+		return nil
+	}
+	select {
+	case <-h.handle.Lost():
+		delete(r.holds, key)
+		return nil
+	default:
+	}
+	h.count++
+	return &reentrantHandle{handle: h.handle, r: r, key: key, hold: h}
+}
+
+type reentrantHandle struct {
+	*handle
+	r    *reentrant
+	key  string
+	hold *hold
+	once sync.Once
+}
+
+// UnLock 减少持有计数, 最后一次 UnLock 释放锁; 同一个 Handle 重复 UnLock 返回 ErrNotHeld
+func (h *reentrantHandle) UnLock(ctx context.Context) error {
+	released := false
+	h.once.Do(func() {
+		released = true
+	})
+	if !released {
+		return ErrNotHeld
+	}
+	h.r.mu.Lock()
+	h.hold.count--
+	last := h.hold.count == 0
+	if last && h.r.holds[h.key] == h.hold {
+		delete(h.r.holds, h.key)
+	}
+	h.r.mu.Unlock()
+	if !last {
+		return nil
+	}
+	return h.handle.UnLock(ctx)
+}
@@ -0,0 +1,44 @@
+package dislock
+
+import (
+	"context"
+	"time"
+)
+
+type rwMutex struct {
+	reader *mutex
+	writer *mutex
+}
+
+// NewRWMutex 基于 RWBackend 的读写锁, 有写者等待时不再接受新的读者
+func NewRWMutex(backend RWBackend, opts ...Option) RWLock {
+	o := newOptions(opts)
+	return &rwMutex{
+		reader: newMutex(ops{
+			acquire: backend.AcquireRead,
+			renew:   backend.RenewRead,
+			release: backend.ReleaseRead,
+		}, o),
+		writer: newMutex(ops{
+			acquire: backend.AcquireWrite,
+			renew:   backend.Renew,
+			release: backend.Release,
+		}, o),
+	}
+}
+
+func (rw *rwMutex) Lock(ctx context.Context, key string) (Handle, error) {
+	return rw.writer.Lock(ctx, key)
+}
+
+func (rw *rwMutex) TryLock(ctx context.Context, key string, timeout time.Duration) (Handle, error) {
+	return rw.writer.TryLock(ctx, key, timeout)
+}
+
+func (rw *rwMutex) RLock(ctx context.Context, key string) (Handle, error) {
+	return rw.reader.Lock(ctx, key)
+}
+
+func (rw *rwMutex) TryRLock(ctx context.Context, key string, timeout time.Duration) (Handle, error) {
+	return rw.reader.TryLock(ctx, key, timeout)
+}
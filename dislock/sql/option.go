@@ -0,0 +1,58 @@
+package sql
+
+const defaultTable = "dislock"
+
+// Dialect 不同数据库的 SQL 差异
+type Dialect struct {
+	// 数据库当前时间(unix 毫秒)的表达式, 所有节点以数据库时间判断过期, 不受客户端时钟偏差影响
+	Now string
+	// 忽略主键冲突的插入语句前缀
+	InsertIgnore string
+	// 锁 key 列类型
+	KeyType string
+}
+
+var (
+	MySQL = Dialect{
+		Now:          "CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED)",
+		InsertIgnore: "INSERT IGNORE INTO",
+		KeyType:      "VARCHAR(191)",
+	}
+	SQLite = Dialect{
+		Now:          "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)",
+		InsertIgnore: "INSERT OR IGNORE INTO",
+		KeyType:      "TEXT",
+	}
+)
+
+type (
+	Options struct {
+		// 锁表名
+		table   string
+		dialect Dialect
+	}
+	Option func(o *Options)
+)
+
+func Table(table string) Option {
+	return func(o *Options) {
+		o.table = table
+	}
+}
+
+func WithDialect(dialect Dialect) Option {
+	return func(o *Options) {
+		o.dialect = dialect
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		table:   defaultTable,
+		dialect: MySQL,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
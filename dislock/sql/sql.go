@@ -0,0 +1,105 @@
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+)
+
+// 每个 key 一行, 释放后保留该行(owner 置空), 使 token 列在 key 的整个生命周期内单调递增作为栅栏令牌.
+// expire_at 为数据库时间的 unix 毫秒, 过期的行可被其他持有者直接抢占.
+
+type backend struct {
+	db      *gosql.DB
+	table   string
+	dialect Dialect
+}
+
+// NewBackend 基于锁表的锁存储, 锁表需先通过 CreateTable 创建
+func NewBackend(db *gosql.DB, opts ...Option) dislock.Backend {
+	o := newOptions(opts)
+	return &backend{db: db, table: o.table, dialect: o.dialect}
+}
+
+// NewLock 等价于 dislock.New(NewBackend(db), opts...), 使用默认的表名和 MySQL 方言
+func NewLock(db *gosql.DB, opts ...dislock.Option) dislock.Lock {
+	return dislock.New(NewBackend(db), opts...)
+}
+
+// CreateTable 创建锁表(已存在时忽略)
+func CreateTable(ctx context.Context, db *gosql.DB, opts ...Option) error {
+	o := newOptions(opts)
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	lock_key %s NOT NULL PRIMARY KEY,
+	owner VARCHAR(64) NOT NULL DEFAULT '',
+	token BIGINT NOT NULL DEFAULT 0,
+	expire_at BIGINT NOT NULL DEFAULT 0
+)`, o.table, o.dialect.KeyType))
+	return err
+}
+
+func (b *backend) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (int64, error) {
+	_, err := b.db.ExecContext(ctx, fmt.Sprintf(
+		"%s %s (lock_key, owner, token, expire_at) VALUES (?, '', 0, 0)",
+		b.dialect.InsertIgnore, b.table), key)
+	if err != nil {
+		return 0, err
+	}
+	res, err := b.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET owner = ?, token = token + 1, expire_at = %s + ? WHERE lock_key = ? AND (owner = '' OR expire_at <= %s)",
+		b.table, b.dialect.Now, b.dialect.Now), owner, milliseconds(ttl), key)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = dislock.ErrNotObtained
+		}
+		return 0, err
+	}
+	var token int64
+	err = b.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT token FROM %s WHERE lock_key = ? AND owner = ?", b.table), key, owner).Scan(&token)
+	if err == gosql.ErrNoRows {
+		// 刚加锁即被抢占, 只可能是 ttl 小于两条语句的间隔
+		return 0, dislock.ErrNotObtained
+	}
+	return token, err
+}
+
+func (b *backend) Renew(ctx context.Context, key, owner string, ttl time.Duration) error {
+	return b.exec(ctx, fmt.Sprintf(
+		"UPDATE %s SET expire_at = %s + ? WHERE lock_key = ? AND owner = ? AND expire_at > %s",
+		b.table, b.dialect.Now, b.dialect.Now), milliseconds(ttl), key, owner)
+}
+
+func (b *backend) Release(ctx context.Context, key, owner string) error {
+	return b.exec(ctx, fmt.Sprintf(
+		"UPDATE %s SET owner = '', expire_at = 0 WHERE lock_key = ? AND owner = ?", b.table), key, owner)
+}
+
+// exec 执行仅作用于 owner 自己持有的行的更新, 未命中时返回 ErrNotHeld
+func (b *backend) exec(ctx context.Context, query string, args ...interface{}) error {
+	res, err := b.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return dislock.ErrNotHeld
+	}
+	return nil
+}
+
+func milliseconds(d time.Duration) int64 {
+	if d < time.Millisecond {
+		return 1
+	}
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,136 @@
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestBackend(t *testing.T) (dislock.Backend, *gosql.DB) {
+	db, err := gosql.Open("sqlite3", filepath.Join(t.TempDir(), "lock.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite 不支持并发写
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if err = CreateTable(context.Background(), db, WithDialect(SQLite)); err != nil {
+		t.Fatal(err)
+	}
+	return NewBackend(db, WithDialect(SQLite)), db
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBackend(t)
+	l := dislock.New(b)
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	if err = h.UnLock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.UnLock(ctx); !errors.Is(err, dislock.ErrNotHeld) {
+		t.Fatalf("second UnLock = %v, want ErrNotHeld", err)
+	}
+	h2, err := l.TryLock(ctx, "k", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2.Token() <= h.Token() {
+		t.Fatalf("token = %d, want > %d", h2.Token(), h.Token())
+	}
+	_ = h2.UnLock(ctx)
+}
+
+func TestMutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBackend(t)
+	l := dislock.New(b, dislock.RetryInterval(5*time.Millisecond))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		holders int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := l.Lock(ctx, "k")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > 1 {
+				t.Error("lock held by more than one owner")
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			_ = h.UnLock(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExpiry(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBackend(t)
+
+	// 持有者崩溃后不再续期, 行过期后可被抢占
+	crashed := dislock.New(b, dislock.TTL(100*time.Millisecond), dislock.Watchdog(false))
+	if _, err := crashed.Lock(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	l := dislock.New(b)
+	if _, err := l.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, want ErrNotObtained", err)
+	}
+	h, err := l.TryLock(ctx, "k", time.Second)
+	if err != nil {
+		t.Fatalf("TryLock after expiry = %v", err)
+	}
+	_ = h.UnLock(ctx)
+}
+
+func TestWatchdog(t *testing.T) {
+	ctx := context.Background()
+	b, db := newTestBackend(t)
+	l := dislock.New(b, dislock.TTL(150*time.Millisecond))
+
+	h, err := l.Lock(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if _, err = l.TryLock(ctx, "k", 0); !errors.Is(err, dislock.ErrNotObtained) {
+		t.Fatalf("TryLock = %v, lock not renewed", err)
+	}
+
+	// 行被其他持有者改写后 watchdog 标记丢失
+	if _, err = db.ExecContext(ctx, "UPDATE dislock SET owner = 'other' WHERE lock_key = 'k'"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost not closed")
+	}
+}
@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/hamba/avro"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+var (
+	ErrNotProto = errors.New("codec: value is not a proto.Message")
+	// ErrUnsupported 消息的 content-type 没有对应的 Codec
+	ErrUnsupported = errors.New("codec: unsupported content type")
+)
+
+// Codec 消息体的序列化方式, ContentType 随消息写入 mq.HeaderContentType, 消费时据此选择 Codec
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSON     Codec = jsonCodec{}
+	Protobuf Codec = protoCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// protoCodec 值必须是 proto.Message; 解码的目标也可以是指向 nil message 指针的指针, 此时会创建 message
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNotProto, v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if m, ok := rv.Elem().Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+	return fmt.Errorf("%w: %T", ErrNotProto, v)
+}
+
+type avroCodec struct {
+	schema avro.Schema
+}
+
+// Avro 按 schema 编解码, struct 字段通过 avro tag 对应 schema 的字段;
+// 解码时忽略 schema 中有而 struct 中没有的字段, struct 中多出的字段保持零值(不使用 schema 的默认值)
+func Avro(schema string) (Codec, error) {
+	s, err := avro.ParseWithCache(schema, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, err
+	}
+	return &avroCodec{schema: s}, nil
+}
+
+func (c *avroCodec) ContentType() string {
+	return ContentTypeAvro
+}
+
+func (c *avroCodec) Marshal(v interface{}) ([]byte, error) {
+	return avro.Marshal(c.schema, v)
+}
+
+func (c *avroCodec) Unmarshal(data []byte, v interface{}) error {
+	return avro.Unmarshal(c.schema, data, v)
+}
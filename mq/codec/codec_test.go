@@ -0,0 +1,148 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/davveo/go-toolkit/mq"
+	"github.com/davveo/go-toolkit/mq/local"
+	"github.com/davveo/go-toolkit/mq/schema"
+)
+
+type orderV1 struct {
+	ID string `json:"id" avro:"id"`
+}
+
+type orderV2 struct {
+	ID     string `json:"id" avro:"id"`
+	Amount int64  `json:"amount" avro:"amount"`
+}
+
+const (
+	orderSchemaV1 = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"}]}`
+	orderSchemaV2 = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"},
+		{"name": "amount", "type": "long", "default": 0}]}`
+)
+
+func TestCodecs(t *testing.T) {
+	avroCodec, err := Avro(orderSchemaV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Codec{JSON, avroCodec} {
+		data, err := c.Marshal(orderV2{ID: "1", Amount: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got orderV2
+		if err = c.Unmarshal(data, &got); err != nil || got.ID != "1" || got.Amount != 100 {
+			t.Fatalf("%s: got %+v, %v", c.ContentType(), got, err)
+		}
+	}
+
+	data, err := Protobuf.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *wrapperspb.StringValue
+	if err = Protobuf.Unmarshal(data, &got); err != nil || got.GetValue() != "hello" {
+		t.Fatalf("protobuf: got %v, %v", got, err)
+	}
+	if _, err = Protobuf.Marshal(orderV1{}); !errors.Is(err, ErrNotProto) {
+		t.Fatalf("Marshal non-proto = %v", err)
+	}
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+		var zero T
+		return zero
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	ctx := context.Background()
+	b := local.NewBroker(local.MaxAttempts(1))
+	defer b.Close()
+
+	received := make(chan *wrapperspb.StringValue, 1)
+	if err := Subscribe(b.NewConsumer(), "greetings", "", func(ctx context.Context, msg *mq.Msg, v *wrapperspb.StringValue) error {
+		received <- v
+		return nil
+	}, WithCodec(Protobuf)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Publish(ctx, b, "greetings", "", wrapperspb.String("hi"), WithCodec(Protobuf)); err != nil {
+		t.Fatal(err)
+	}
+	if v := receive(t, received); !proto.Equal(v, wrapperspb.String("hi")) {
+		t.Fatalf("got %v", v)
+	}
+
+	// content-type 未知的消息被拒绝
+	raw := mq.NewMsg("greetings", "", []byte("x"))
+	raw.SetHeader(mq.HeaderContentType, "text/plain")
+	_, _ = b.Send(ctx, raw)
+	var dead []*mq.Msg
+	for deadline := time.Now().Add(2 * time.Second); len(dead) == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("message not rejected")
+		}
+		dead, _ = b.List(ctx, "default", 0)
+	}
+}
+
+func TestSchemaEvolution(t *testing.T) {
+	ctx := context.Background()
+	reg := schema.NewMemoryRegistry()
+	v1, err := reg.Register(ctx, "orders", schema.Avro, orderSchemaV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := reg.Register(ctx, "orders", schema.Avro, orderSchemaV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := local.NewBroker()
+	defer b.Close()
+	// 消费者已升级到 v2, 生产者仍使用 v1
+	received := make(chan orderV2, 2)
+	if err = Subscribe(b.NewConsumer(), "orders", "", func(ctx context.Context, msg *mq.Msg, v orderV2) error {
+		received <- v
+		return nil
+	}, WithSchema(v2), WithRegistry(reg)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Publish(ctx, b, "orders", "", orderV1{ID: "1"}, WithSchema(v1)); err != nil {
+		t.Fatal(err)
+	}
+	if v := receive(t, received); v.ID != "1" || v.Amount != 0 {
+		t.Fatalf("got %+v", v)
+	}
+	msg, err := NewMsg("orders", "", orderV2{ID: "2", Amount: 5}, WithSchema(v2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header(mq.HeaderContentType) != ContentTypeAvro || msg.Header(mq.HeaderSchemaID) != "2" {
+		t.Fatalf("headers = %v", msg.Headers)
+	}
+	_, _ = b.Send(ctx, msg)
+	if v := receive(t, received); v.ID != "2" || v.Amount != 5 {
+		t.Fatalf("got %+v", v)
+	}
+
+	if _, err = Decode[orderV2](ctx, msg, WithRegistry(schema.NewMemoryRegistry())); !errors.Is(err, mq.ErrReject) {
+		t.Fatalf("Decode with unknown schema = %v", err)
+	}
+}
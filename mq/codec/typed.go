@@ -0,0 +1,194 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/davveo/go-toolkit/mq"
+	"github.com/davveo/go-toolkit/mq/schema"
+)
+
+type (
+	Options struct {
+		// 发送时使用的 Codec, 默认为 JSON, 指定了 Avro schema 时为该 schema 的 Avro Codec
+		codec Codec
+		// 发送时记录到 mq.HeaderSchemaID
+		schema *schema.Schema
+		// 消费时按 mq.HeaderSchemaID 查找写入方的 schema
+		registry schema.Registry
+	}
+	Option func(o *Options)
+)
+
+func WithCodec(c Codec) Option {
+	return func(o *Options) {
+		o.codec = c
+	}
+}
+
+// WithSchema 发送时在 mq.HeaderSchemaID 中记录 schema 的 ID, schema 为 Avro 且未指定 Codec 时按该 schema 编码
+func WithSchema(s *schema.Schema) Option {
+	return func(o *Options) {
+		o.schema = s
+	}
+}
+
+// WithRegistry 消费时按 mq.HeaderSchemaID 从 registry 获取写入方的 schema:
+// Avro 消息按写入方的 schema 解码, ID 未注册的消息被拒绝
+func WithRegistry(r schema.Registry) Option {
+	return func(o *Options) {
+		o.registry = r
+	}
+}
+
+func newOptions(opts []Option) (*Options, error) {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.codec == nil && o.schema != nil && o.schema.Type == schema.Avro {
+		c, err := Avro(o.schema.Definition)
+		if err != nil {
+			return nil, err
+		}
+		o.codec = c
+	}
+	if o.codec == nil {
+		o.codec = JSON
+	}
+	return o, nil
+}
+
+// NewMsg 编码 v 作为消息体, 并设置 mq.HeaderContentType 和 mq.HeaderSchemaID
+func NewMsg[T any](topic, tag string, v T, opts ...Option) (*mq.Msg, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := o.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msg := mq.NewMsg(topic, tag, body)
+	msg.SetHeader(mq.HeaderContentType, o.codec.ContentType())
+	if o.schema != nil {
+		msg.SetHeader(mq.HeaderSchemaID, strconv.Itoa(o.schema.ID))
+	}
+	return msg, nil
+}
+
+// Publish 编码 v 并发送, 需要设置 Key 等属性时使用 NewMsg
+func Publish[T any](ctx context.Context, p mq.Producer, topic, tag string, v T, opts ...Option) (string, error) {
+	msg, err := NewMsg(topic, tag, v, opts...)
+	if err != nil {
+		return "", err
+	}
+	return p.Send(ctx, msg)
+}
+
+// Decode 按消息的 mq.HeaderContentType 解码消息体, 没有 content-type 时使用 WithCodec 指定的 Codec
+func Decode[T any](ctx context.Context, msg *mq.Msg, opts ...Option) (T, error) {
+	var v T
+	d, err := newDecoder(opts)
+	if err != nil {
+		return v, err
+	}
+	return v, d.decode(ctx, msg, &v)
+}
+
+// Subscribe 订阅 topic, 消息体解码为 T 后交给 h; 无法解码的消息被拒绝, 直接进入死信 topic
+func Subscribe[T any](c mq.Consumer, topic, tag string, h func(ctx context.Context, msg *mq.Msg, v T) error, opts ...Option) error {
+	d, err := newDecoder(opts)
+	if err != nil {
+		return err
+	}
+	return c.Subscribe(topic, tag, func(ctx context.Context, msg *mq.Msg) error {
+		var v T
+		if err := d.decode(ctx, msg, &v); err != nil {
+			return err
+		}
+		return h(ctx, msg, v)
+	})
+}
+
+type decoder struct {
+	opts *Options
+
+	mu sync.Mutex
+	// schema ID -> 写入方 schema 的 Avro Codec
+	avro map[int]Codec
+}
+
+func newDecoder(opts []Option) (*decoder, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &decoder{opts: o, avro: make(map[int]Codec)}, nil
+}
+
+// decode 除查询 registry 失败外的错误都以 mq.Reject 包装, 重试也无法解码
+func (d *decoder) decode(ctx context.Context, msg *mq.Msg, v interface{}) error {
+	c, err := d.codec(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if err = c.Unmarshal(msg.Body, v); err != nil {
+		return mq.Reject(err)
+	}
+	return nil
+}
+
+func (d *decoder) codec(ctx context.Context, msg *mq.Msg) (Codec, error) {
+	ct := msg.Header(mq.HeaderContentType)
+	if d.opts.registry != nil {
+		if id := msg.Header(mq.HeaderSchemaID); id != "" {
+			c, err := d.writerCodec(ctx, id)
+			if err != nil || c != nil {
+				return c, err
+			}
+		}
+	}
+	switch ct {
+	case "", d.opts.codec.ContentType():
+		return d.opts.codec, nil
+	case ContentTypeJSON:
+		return JSON, nil
+	case ContentTypeProtobuf:
+		return Protobuf, nil
+	}
+	return nil, mq.Reject(fmt.Errorf("%w: %s", ErrUnsupported, ct))
+}
+
+// writerCodec 返回写入方 schema 对应的 Codec, 不是 Avro 时返回 nil
+func (d *decoder) writerCodec(ctx context.Context, id string) (Codec, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, mq.Reject(fmt.Errorf("codec: invalid schema id %q", id))
+	}
+	d.mu.Lock()
+	c, ok := d.avro[n]
+	d.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+	s, err := d.opts.registry.GetByID(ctx, n)
+	if errors.Is(err, schema.ErrNotFound) {
+		return nil, mq.Reject(fmt.Errorf("codec: schema %d: %w", n, err))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Type == schema.Avro {
+		if c, err = Avro(s.Definition); err != nil {
+			return nil, mq.Reject(err)
+		}
+	}
+	d.mu.Lock()
+	d.avro[n] = c
+	d.mu.Unlock()
+	return c, nil
+}
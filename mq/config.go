@@ -1,10 +1,65 @@
 package mq
 
-import "time"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Msg struct {
+	// 消息 ID, 发送时为空则自动生成
+	ID    string
 	Topic string
 	Tag   string
-	Body  []byte
+	// 业务 key, 用于分区/顺序消息和消息查询
+	Key  string
+	Body []byte
+	// 自定义属性, 各实现映射为 kafka header / amqp header / rocketmq property 等
+	Headers map[string]string
+	// 发送时间, 发送时为零值则取当前时间
+	Timestamp time.Time
+	// 延迟投递时长, 0 表示立即投递
 	Delay time.Duration
+	// 投递次数, 由 Consumer 填充, 首次投递为 1
+	Attempts int
+}
+
+func NewMsg(topic, tag string, body []byte) *Msg {
+	return &Msg{Topic: topic, Tag: tag, Body: body}
+}
+
+// Prepare 填充 ID 和 Timestamp, 由 Producer 在发送前调用
+func (m *Msg) Prepare() {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+}
+
+func (m *Msg) Header(key string) string {
+	return m.Headers[key]
+}
+
+func (m *Msg) SetHeader(key, value string) {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = value
+}
+
+// Clone 复制消息, Headers 和 Body 不与原消息共享
+func (m *Msg) Clone() *Msg {
+	c := *m
+	if m.Headers != nil {
+		c.Headers = make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			c.Headers[k] = v
+		}
+	}
+	if m.Body != nil {
+		c.Body = append([]byte(nil), m.Body...)
+	}
+	return &c
 }
@@ -0,0 +1,46 @@
+package idempotent
+
+import (
+	"context"
+	"time"
+
+	"github.com/davveo/go-toolkit/cache"
+)
+
+const (
+	stateProcessing = "processing"
+	stateDone       = "done"
+)
+
+type cacheStore struct {
+	adapter cache.Adapter
+}
+
+// NewCacheStore 基于 cache.Adapter 的 Store, 多个消费者实例之间去重需要使用共享的缓存(如 redis)
+func NewCacheStore(adapter cache.Adapter) Store {
+	return &cacheStore{adapter: adapter}
+}
+
+func (s *cacheStore) Begin(ctx context.Context, key string, lease time.Duration) error {
+	ok, err := s.adapter.SetIfNotExist(ctx, key, stateProcessing, lease)
+	if err != nil || ok {
+		return err
+	}
+	v, err := s.adapter.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	// 记录恰好过期时也按处理中返回, 重试时重新登记
+	if v != nil && cache.KeyString(v) == stateDone {
+		return ErrDuplicate
+	}
+	return ErrInProgress
+}
+
+func (s *cacheStore) Done(ctx context.Context, key string, ttl time.Duration) error {
+	return s.adapter.Set(ctx, key, stateDone, ttl)
+}
+
+func (s *cacheStore) Abort(ctx context.Context, key string) error {
+	return s.adapter.Delete(ctx, key)
+}
@@ -0,0 +1,61 @@
+package idempotent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+var (
+	// ErrDuplicate 消息已处理完成
+	ErrDuplicate = errors.New("idempotent: message already processed")
+	// ErrInProgress 消息正在被其他消费者处理, 稍后重试
+	ErrInProgress = errors.New("idempotent: message in progress")
+)
+
+// Store 记录消息的处理状态: 处理中的记录在 lease 后过期, 处理完成的记录在 ttl 后过期
+type Store interface {
+	// Begin 登记开始处理 key, 已处理完成时返回 ErrDuplicate, 正在处理时返回 ErrInProgress
+	Begin(ctx context.Context, key string, lease time.Duration) error
+	// Done 标记处理完成, ttl 内再次 Begin 返回 ErrDuplicate
+	Done(ctx context.Context, key string, ttl time.Duration) error
+	// Abort 处理失败, 删除处理中的记录使消息可以重新处理
+	Abort(ctx context.Context, key string) error
+}
+
+// Middleware 跳过已处理完成的重复消息; 同一条消息同时投递给多个消费者时只有一个处理,
+// 其余返回 ErrInProgress 等待重试. Store 出错时返回错误, 消息稍后重新投递.
+func Middleware(store Store, opts ...Option) mq.Middleware {
+	o := newOptions(opts)
+	return func(next mq.Handler) mq.Handler {
+		return func(ctx context.Context, msg *mq.Msg) error {
+			key := o.prefix + o.key(msg)
+			if err := store.Begin(ctx, key, o.lease); err != nil {
+				if errors.Is(err, ErrDuplicate) {
+					return nil
+				}
+				return err
+			}
+			if err := next(ctx, msg); err != nil {
+				if aerr := store.Abort(context.Background(), key); aerr != nil {
+					warn("idempotent: abort failed", aerr, logger.KV("key", key))
+				}
+				return err
+			}
+			// 标记失败时消息已处理, 不再重试, lease 过期前的重复投递仍会被跳过
+			if err := store.Done(context.Background(), key, o.ttl); err != nil {
+				warn("idempotent: mark done failed", err, logger.KV("key", key))
+			}
+			return nil
+		}
+	}
+}
+
+func warn(msg string, err error, kvs ...logger.Entry) {
+	if logger.IsInitialized() {
+		logger.WarnErr(msg, err, kvs...)
+	}
+}
@@ -0,0 +1,121 @@
+package idempotent
+
+import (
+	"context"
+	gosql "database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/davveo/go-toolkit/cache/local"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	db, err := gosql.Open("sqlite3", filepath.Join(t.TempDir(), "idempotent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite 不支持并发写
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if err = CreateTable(context.Background(), db, WithDialect(SQLite)); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLStore(db, WithDialect(SQLite))
+}
+
+func stores(t *testing.T) map[string]Store {
+	adapter := local.NewAdapterLocal()
+	t.Cleanup(func() { _ = adapter.Close(context.Background()) })
+	return map[string]Store{
+		"cache": NewCacheStore(adapter),
+		"sql":   newTestSQLStore(t),
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := s.Begin(ctx, "k", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Begin(ctx, "k", time.Minute); !errors.Is(err, ErrInProgress) {
+				t.Fatalf("Begin = %v, want ErrInProgress", err)
+			}
+			if err := s.Abort(ctx, "k"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Begin(ctx, "k", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Done(ctx, "k", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Begin(ctx, "k", time.Minute); !errors.Is(err, ErrDuplicate) {
+				t.Fatalf("Begin = %v, want ErrDuplicate", err)
+			}
+			// 处理中的记录过期后可被重新登记
+			if err := s.Begin(ctx, "crashed", 20*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if err := s.Begin(ctx, "crashed", time.Minute); err != nil {
+				t.Fatalf("Begin after lease = %v", err)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			h := mq.Chain(func(ctx context.Context, msg *mq.Msg) error {
+				calls++
+				if calls == 1 {
+					return errors.New("busy")
+				}
+				return nil
+			}, Middleware(s, Prefix(name+":")))
+
+			msg := mq.NewMsg("orders", "", nil)
+			msg.Prepare()
+			// 失败后可以重新处理
+			if err := h(ctx, msg); err == nil {
+				t.Fatal("expected error")
+			}
+			if err := h(ctx, msg); err != nil {
+				t.Fatal(err)
+			}
+			// 重复投递被跳过
+			if err := h(ctx, msg.Clone()); err != nil {
+				t.Fatal(err)
+			}
+			if calls != 2 {
+				t.Fatalf("calls = %d", calls)
+			}
+			other := mq.NewMsg("payments", "", nil)
+			other.ID = msg.ID
+			if err := h(ctx, other); err != nil || calls != 3 {
+				t.Fatalf("err = %v, calls = %d", err, calls)
+			}
+		})
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLStore(t)
+	_ = s.Begin(ctx, "a", time.Millisecond)
+	_ = s.Begin(ctx, "b", time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	if n, err := s.Cleanup(ctx); err != nil || n != 1 {
+		t.Fatalf("Cleanup = %d, %v", n, err)
+	}
+}
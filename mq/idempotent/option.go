@@ -0,0 +1,120 @@
+package idempotent
+
+import (
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const (
+	defaultPrefix = "mq:idempotent:"
+	defaultTTL    = 24 * time.Hour
+	defaultLease  = 5 * time.Minute
+	defaultTable  = "mq_idempotent"
+)
+
+type (
+	Options struct {
+		// key 前缀, 共用 Store 的不同消费组需要使用不同的前缀
+		prefix string
+		// 消息处理完成后记录的保留时长, 应大于 broker 可能重复投递的时间窗口
+		ttl time.Duration
+		// 处理中的记录的有效期, 消费者崩溃后超过 lease 消息才能被重新处理, 应大于 Handler 的最长处理时间
+		lease time.Duration
+		// 消息的唯一标识, 默认为 topic + ":" + Msg.ID
+		key func(msg *mq.Msg) string
+	}
+	Option func(o *Options)
+
+	SQLOptions struct {
+		table   string
+		dialect Dialect
+	}
+	SQLOption func(o *SQLOptions)
+)
+
+func Prefix(prefix string) Option {
+	return func(o *Options) {
+		o.prefix = prefix
+	}
+}
+
+func TTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.ttl = ttl
+	}
+}
+
+func Lease(lease time.Duration) Option {
+	return func(o *Options) {
+		o.lease = lease
+	}
+}
+
+// Key 按业务字段去重, 如同一个订单的重复事件使用不同的 Msg.ID 时
+func Key(key func(msg *mq.Msg) string) Option {
+	return func(o *Options) {
+		o.key = key
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		prefix: defaultPrefix,
+		ttl:    defaultTTL,
+		lease:  defaultLease,
+		key: func(msg *mq.Msg) string {
+			return msg.Topic + ":" + msg.ID
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Dialect 不同数据库的 SQL 差异
+type Dialect struct {
+	// 数据库当前时间(unix 毫秒)的表达式, 所有节点以数据库时间判断过期
+	Now string
+	// 忽略主键冲突的插入语句前缀
+	InsertIgnore string
+	// key 列类型
+	KeyType string
+}
+
+var (
+	MySQL = Dialect{
+		Now:          "CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED)",
+		InsertIgnore: "INSERT IGNORE INTO",
+		KeyType:      "VARCHAR(191)",
+	}
+	SQLite = Dialect{
+		Now:          "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)",
+		InsertIgnore: "INSERT OR IGNORE INTO",
+		KeyType:      "TEXT",
+	}
+)
+
+func Table(table string) SQLOption {
+	return func(o *SQLOptions) {
+		o.table = table
+	}
+}
+
+func WithDialect(dialect Dialect) SQLOption {
+	return func(o *SQLOptions) {
+		o.dialect = dialect
+	}
+}
+
+func newSQLOptions(opts []SQLOption) *SQLOptions {
+	o := &SQLOptions{
+		table:   defaultTable,
+		dialect: MySQL,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
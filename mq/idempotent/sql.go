@@ -0,0 +1,96 @@
+package idempotent
+
+import (
+	"context"
+	gosql "database/sql"
+	"fmt"
+	"time"
+)
+
+// 每个 key 一行, done 为 0 表示处理中, expire_at 为数据库时间的 unix 毫秒, 过期的行可被重新登记.
+// 过期的行不会自动删除, 需要定期调用 Cleanup.
+
+type SQLStore struct {
+	db      *gosql.DB
+	table   string
+	dialect Dialect
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// NewSQLStore 基于数据库表的 Store, 表需先通过 CreateTable 创建
+func NewSQLStore(db *gosql.DB, opts ...SQLOption) *SQLStore {
+	o := newSQLOptions(opts)
+	return &SQLStore{db: db, table: o.table, dialect: o.dialect}
+}
+
+// CreateTable 创建去重表(已存在时忽略)
+func CreateTable(ctx context.Context, db *gosql.DB, opts ...SQLOption) error {
+	o := newSQLOptions(opts)
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	msg_key %s NOT NULL PRIMARY KEY,
+	done INT NOT NULL DEFAULT 0,
+	expire_at BIGINT NOT NULL DEFAULT 0
+)`, o.table, o.dialect.KeyType))
+	return err
+}
+
+func (s *SQLStore) Begin(ctx context.Context, key string, lease time.Duration) error {
+	ok, err := s.affected(ctx, fmt.Sprintf(
+		"%s %s (msg_key, done, expire_at) VALUES (?, 0, %s + ?)",
+		s.dialect.InsertIgnore, s.table, s.dialect.Now), key, lease.Milliseconds())
+	if err != nil || ok {
+		return err
+	}
+	ok, err = s.affected(ctx, fmt.Sprintf(
+		"UPDATE %s SET done = 0, expire_at = %s + ? WHERE msg_key = ? AND expire_at <= %s",
+		s.table, s.dialect.Now, s.dialect.Now), lease.Milliseconds(), key)
+	if err != nil || ok {
+		return err
+	}
+	var done int
+	err = s.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT done FROM %s WHERE msg_key = ?", s.table), key).Scan(&done)
+	if err == gosql.ErrNoRows {
+		return ErrInProgress
+	}
+	if err != nil {
+		return err
+	}
+	if done == 1 {
+		return ErrDuplicate
+	}
+	return ErrInProgress
+}
+
+func (s *SQLStore) Done(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET done = 1, expire_at = %s + ? WHERE msg_key = ?", s.table, s.dialect.Now),
+		ttl.Milliseconds(), key)
+	return err
+}
+
+func (s *SQLStore) Abort(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE msg_key = ? AND done = 0", s.table), key)
+	return err
+}
+
+// Cleanup 删除已过期的记录, 返回删除的行数
+func (s *SQLStore) Cleanup(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE expire_at <= %s", s.table, s.dialect.Now))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLStore) affected(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
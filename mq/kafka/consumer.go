@@ -0,0 +1,160 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// Subscribe 以 Group 指定的消费组加入 topic 的消费, tag 过滤在客户端进行,
+// 不匹配的消息直接提交 offset
+func (k *Kafka) Subscribe(topic, tag string, handler mq.Handler) error {
+	h := &groupHandler{k: k, group: k.opts.group, filter: tag, handler: handler}
+	return k.startGroup(k.opts.group, []string{topic}, h)
+}
+
+func (k *Kafka) startGroup(groupID string, topics []string, handler sarama.ConsumerGroupHandler) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return mq.ErrClosed
+	}
+	group, err := sarama.NewConsumerGroup(k.opts.brokers, groupID, k.config)
+	if err != nil {
+		return err
+	}
+	k.groups = append(k.groups, group)
+	k.wg.Add(1)
+	go k.consume(group, topics, handler)
+	return nil
+}
+
+func (k *Kafka) consume(group sarama.ConsumerGroup, topics []string, handler sarama.ConsumerGroupHandler) {
+	defer k.wg.Done()
+	for k.ctx.Err() == nil {
+		// 每次 rebalance 后 Consume 返回, 需要重新加入消费组
+		if err := group.Consume(k.ctx, topics, handler); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			warn("kafka: consume failed", err, logger.KV("topics", topics))
+			sleep(k.ctx, k.opts.minBackoff)
+		}
+	}
+}
+
+type groupHandler struct {
+	k       *Kafka
+	group   string
+	filter  string
+	handler mq.Handler
+}
+
+// Setup rebalance 完成, 开始消费新分配的分区
+func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	if logger.IsInitialized() {
+		logger.InfoKV("kafka: partitions assigned",
+			logger.KV("group", h.group),
+			logger.KV("member", session.MemberID()),
+			logger.KV("claims", session.Claims()))
+	}
+	return nil
+}
+
+// Cleanup 分区即将被回收, 所有 ConsumeClaim 都已返回, 处理完成的消息都已提交
+func (h *groupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	if logger.IsInitialized() {
+		logger.InfoKV("kafka: partitions revoked",
+			logger.KV("group", h.group),
+			logger.KV("member", session.MemberID()),
+			logger.KV("claims", session.Claims()))
+	}
+	return nil
+}
+
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case cm, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !h.handle(session, cm) {
+				// 会话在重试期间结束, 未提交的消息由分区的新持有者重新消费
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// handle 处理成功、被忽略或转入死信 topic 后提交 offset 并返回 true, 会话结束时返回 false
+func (h *groupHandler) handle(session sarama.ConsumerGroupSession, cm *sarama.ConsumerMessage) bool {
+	ctx := session.Context()
+	msg := fromConsumerMessage(cm)
+	if mq.MatchTag(h.filter, msg.Tag) {
+		for {
+			msg.Attempts++
+			err := h.handler(ctx, msg)
+			if err == nil {
+				break
+			}
+			delay, ok := h.k.opts.retry.Next(msg.Attempts)
+			if errors.Is(err, mq.ErrReject) || !ok {
+				if !h.k.retry(ctx, "kafka: send to dead letter topic failed", func() error {
+					return h.k.deadLetter(h.group, msg, err)
+				}) {
+					return false
+				}
+				break
+			}
+			if !sleep(ctx, delay) {
+				return false
+			}
+		}
+	}
+	session.MarkMessage(cm, "")
+	session.Commit()
+	return true
+}
+
+func (k *Kafka) deadLetter(group string, msg *mq.Msg, err error) error {
+	dl := msg.Clone()
+	dl.Topic = mq.DeadLetterTopic(group)
+	dl.Delay = 0
+	dl.Attempts = 0
+	dl.SetHeader(mq.HeaderOriginTopic, msg.Topic)
+	dl.SetHeader(mq.HeaderError, err.Error())
+	return k.send(toProducerMessage(dl))
+}
+
+// retry 按退避策略重试 fn 直到成功, ctx 结束时返回 false
+func (k *Kafka) retry(ctx context.Context, msg string, fn func() error) bool {
+	for attempts := 1; ; attempts++ {
+		err := fn()
+		if err == nil {
+			return true
+		}
+		warn(msg, err)
+		if !sleep(ctx, k.backoff(attempts)) {
+			return false
+		}
+	}
+}
+
+func (k *Kafka) backoff(attempts int) time.Duration {
+	d := k.opts.minBackoff
+	for i := 1; i < attempts && d < k.opts.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > k.opts.maxBackoff {
+		d = k.opts.maxBackoff
+	}
+	return d
+}
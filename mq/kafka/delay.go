@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// 延迟消息使用的 header, 转发到目标 topic 时移除
+const (
+	// 目标 topic
+	headerDelayTopic = "mq-delay-topic"
+	// 投递时间, unix 毫秒
+	headerDeliverAt = "mq-deliver-at"
+	// 进入当前延迟桶的时间, unix 毫秒
+	headerBucketAt = "mq-bucket-at"
+)
+
+var errMalformedDelay = errors.New("kafka: missing delay headers")
+
+func (o *Options) bucketTopic(bucket time.Duration) string {
+	return fmt.Sprintf("%s%ds", o.delayPrefix, int64(bucket/time.Second))
+}
+
+// bucket 返回不超过 d 的最大延迟桶, d 小于最小的桶时返回最小的桶
+func (o *Options) bucket(d time.Duration) time.Duration {
+	b := o.delayBuckets[0]
+	for _, v := range o.delayBuckets {
+		if v > d {
+			break
+		}
+		b = v
+	}
+	return b
+}
+
+// delayed 构造写入延迟桶的消息, 消息在 deliverAt 投递到 target
+func (k *Kafka) delayed(msg *mq.Msg, target string, deliverAt time.Time) *sarama.ProducerMessage {
+	now := time.Now()
+	m := msg.Clone()
+	m.Topic = k.opts.bucketTopic(k.opts.bucket(deliverAt.Sub(now)))
+	m.Delay = 0
+	m.SetHeader(headerDelayTopic, target)
+	m.SetHeader(headerDeliverAt, strconv.FormatInt(deliverAt.UnixMilli(), 10))
+	m.SetHeader(headerBucketAt, strconv.FormatInt(now.UnixMilli(), 10))
+	return toProducerMessage(m)
+}
+
+// RelayDelay 在后台消费所有延迟桶 topic, 到期的消息转发到目标 topic,
+// 剩余延迟仍超过最小桶的消息转入更小的桶, 直到 Close.
+// 延迟桶 topic 需要预先创建, 多个实例调用时以消费组 delayPrefix+"relay" 分摊分区.
+func (k *Kafka) RelayDelay() error {
+	if len(k.opts.delayBuckets) == 0 {
+		return ErrNoDelayBucket
+	}
+	topics := make([]string, 0, len(k.opts.delayBuckets))
+	for _, b := range k.opts.delayBuckets {
+		topics = append(topics, k.opts.bucketTopic(b))
+	}
+	return k.startGroup(k.opts.delayPrefix+"relay", topics, &delayHandler{k: k})
+}
+
+type delayHandler struct {
+	k *Kafka
+}
+
+func (h *delayHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *delayHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim 同一个桶内的消息按进入时间排列, 到期时间(进入时间+桶时长)单调递增,
+// 因此只需等待分区中的第一条消息到期
+func (h *delayHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	bucket := h.k.buckets[claim.Topic()]
+	for {
+		select {
+		case cm, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !h.relay(session, bucket, cm) {
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (h *delayHandler) relay(session sarama.ConsumerGroupSession, bucket time.Duration, cm *sarama.ConsumerMessage) bool {
+	ctx := session.Context()
+	msg := fromConsumerMessage(cm)
+	target := msg.Header(headerDelayTopic)
+	deliverAt, err1 := unixMilli(msg.Header(headerDeliverAt))
+	bucketAt, err2 := unixMilli(msg.Header(headerBucketAt))
+	if target == "" || err1 != nil || err2 != nil {
+		warn("kafka: drop malformed delay message", errMalformedDelay,
+			logger.KV("topic", cm.Topic), logger.KV("partition", cm.Partition), logger.KV("offset", cm.Offset))
+		session.MarkMessage(cm, "")
+		session.Commit()
+		return true
+	}
+
+	due := bucketAt.Add(bucket)
+	if deliverAt.Before(due) {
+		due = deliverAt
+	}
+	if !sleep(ctx, time.Until(due)) {
+		return false
+	}
+
+	var pm *sarama.ProducerMessage
+	if time.Until(deliverAt) > 0 {
+		pm = h.k.delayed(msg, target, deliverAt)
+	} else {
+		delete(msg.Headers, headerDelayTopic)
+		delete(msg.Headers, headerDeliverAt)
+		delete(msg.Headers, headerBucketAt)
+		msg.Topic = target
+		pm = toProducerMessage(msg)
+	}
+	if !h.k.retry(ctx, "kafka: relay delay message failed", func() error {
+		return h.k.send(pm)
+	}) {
+		return false
+	}
+	session.MarkMessage(cm, "")
+	session.Commit()
+	return true
+}
+
+func unixMilli(s string) (time.Time, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// kafka 的消息无法单独删除, 死信 topic 的队列头部记录在消费组 DLQ-group-admin 的 offset 中:
+// List 从头部开始读取; Replay/Purge 读取到当前末尾后提交 offset,
+// 只处理部分消息时, 其余消息重新追加到死信 topic 末尾.
+
+// 分区在该时长内没有新消息时认为已读到末尾(末尾可能是事务的控制记录)
+const scanIdle = 2 * time.Second
+
+var _ mq.DeadLetterQueue = (*Kafka)(nil)
+
+func adminGroup(group string) string {
+	return mq.DeadLetterTopic(group) + "-admin"
+}
+
+func (k *Kafka) List(ctx context.Context, group string, limit int) ([]*mq.Msg, error) {
+	var msgs []*mq.Msg
+	err := k.scan(ctx, group, false, func(cm *sarama.ConsumerMessage) (bool, error) {
+		msgs = append(msgs, fromConsumerMessage(cm))
+		return limit <= 0 || len(msgs) < limit, nil
+	})
+	return msgs, err
+}
+
+func (k *Kafka) Replay(ctx context.Context, group string, ids ...string) (int, error) {
+	return k.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		return k.send(toProducerMessage(mq.Revive(msg)))
+	})
+}
+
+func (k *Kafka) Purge(ctx context.Context, group string, ids ...string) (int, error) {
+	return k.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		return nil
+	})
+}
+
+// drain 读取死信 topic 的全部消息, 匹配 ids 的交给 fn 处理, 其余的重新追加到末尾, 然后移动队列头部
+func (k *Kafka) drain(ctx context.Context, group string, ids []string, fn func(msg *mq.Msg) error) (int, error) {
+	set := mq.NewIDSet(ids)
+	n := 0
+	err := k.scan(ctx, group, true, func(cm *sarama.ConsumerMessage) (bool, error) {
+		msg := fromConsumerMessage(cm)
+		if !set.Match(msg.ID) {
+			return true, k.send(toProducerMessage(msg))
+		}
+		if err := fn(msg); err != nil {
+			return false, err
+		}
+		n++
+		return true, nil
+	})
+	return n, err
+}
+
+// scan 依次读取每个分区从队列头部到当前末尾的消息, fn 返回 false 或错误时停止;
+// commit 为 true 时将队列头部移动到最后一条处理成功的消息之后
+func (k *Kafka) scan(ctx context.Context, group string, commit bool, fn func(cm *sarama.ConsumerMessage) (bool, error)) error {
+	topic := mq.DeadLetterTopic(group)
+	client, err := sarama.NewClient(k.opts.brokers, k.config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	partitions, err := client.Partitions(topic)
+	if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	om, err := sarama.NewOffsetManagerFromClient(adminGroup(group), client)
+	if err != nil {
+		return err
+	}
+	defer om.Close()
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	var poms []sarama.PartitionOffsetManager
+	defer func() {
+		if commit {
+			om.Commit()
+		}
+		for _, pom := range poms {
+			pom.AsyncClose()
+		}
+	}()
+	for _, p := range partitions {
+		pom, err := om.ManagePartition(topic, p)
+		if err != nil {
+			return err
+		}
+		poms = append(poms, pom)
+		more, err := scanPartition(ctx, client, consumer, pom, topic, p, commit, fn)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanPartition 返回 false 表示 fn 要求停止
+func scanPartition(ctx context.Context, client sarama.Client, consumer sarama.Consumer,
+	pom sarama.PartitionOffsetManager, topic string, p int32, commit bool,
+	fn func(cm *sarama.ConsumerMessage) (bool, error)) (bool, error) {
+	next, _ := pom.NextOffset()
+	oldest, err := client.GetOffset(topic, p, sarama.OffsetOldest)
+	if err != nil {
+		return false, err
+	}
+	// 未提交过 offset, 或头部之前的消息已过期删除
+	if next < oldest {
+		next = oldest
+	}
+	end, err := client.GetOffset(topic, p, sarama.OffsetNewest)
+	if err != nil || next >= end {
+		return err == nil, err
+	}
+	pc, err := consumer.ConsumePartition(topic, p, next)
+	if err != nil {
+		return false, err
+	}
+	defer pc.Close()
+
+	idle := time.NewTimer(scanIdle)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-idle.C:
+			return true, nil
+		case cm := <-pc.Messages():
+			more, err := fn(cm)
+			if err != nil {
+				return false, err
+			}
+			if commit {
+				pom.MarkOffset(cm.Offset+1, "")
+			}
+			if !more || cm.Offset+1 >= end {
+				return more, nil
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(scanIdle)
+		}
+	}
+}
@@ -1 +1,315 @@
 package kafka
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+var (
+	// ErrNotTransactional 未通过 Transactional 开启事务生产者
+	ErrNotTransactional = errors.New("kafka: producer is not transactional")
+	// ErrNoDelayBucket 未配置延迟桶, 无法发送延迟消息
+	ErrNoDelayBucket = errors.New("kafka: no delay bucket configured")
+)
+
+// 框架使用的 header, 不会出现在 Msg.Headers 中
+const (
+	headerID  = "mq-id"
+	headerTag = "mq-tag"
+)
+
+// Kafka 基于 sarama 的 mq.MQ 实现.
+// Msg.Key 作为分区 key, 相同 key 的消息进入同一分区并按顺序消费;
+// 消费失败时在本地按退避策略重试, 处理成功或转入死信 topic 后才提交 offset,
+// 重试期间同一分区的后续消息不会被处理.
+type Kafka struct {
+	opts     *Options
+	config   *sarama.Config
+	producer sarama.SyncProducer
+	// 事务生产者同一时刻只能有一个进行中的事务
+	txMu sync.Mutex
+	// 延迟桶 topic -> 桶时长
+	buckets map[string]time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	groups []sarama.ConsumerGroup
+}
+
+var _ mq.MQ = (*Kafka)(nil)
+
+func NewKafka(opts ...Option) (*Kafka, error) {
+	o := &Options{
+		brokers:      []string{"127.0.0.1:9092"},
+		version:      sarama.DefaultVersion,
+		group:        defaultGroup,
+		maxAttempts:  defaultMaxAttempts,
+		minBackoff:   defaultMinBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		delayBuckets: defaultDelayBuckets,
+		delayPrefix:  defaultDelayPrefix,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.delayBuckets = normalizeBuckets(o.delayBuckets)
+	if o.retry == nil {
+		o.retry = mq.ExponentialRetry(o.minBackoff, o.maxBackoff, 0, o.maxAttempts)
+	}
+
+	config := o.saramaConfig()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	producer := o.producer
+	if producer == nil {
+		var err error
+		if producer, err = sarama.NewSyncProducer(o.brokers, config); err != nil {
+			return nil, err
+		}
+	}
+	k := &Kafka{
+		opts:     o,
+		config:   config,
+		producer: producer,
+		buckets:  make(map[string]time.Duration, len(o.delayBuckets)),
+	}
+	for _, b := range o.delayBuckets {
+		k.buckets[o.bucketTopic(b)] = b
+	}
+	k.ctx, k.cancel = context.WithCancel(context.Background())
+	return k, nil
+}
+
+func (o *Options) saramaConfig() *sarama.Config {
+	c := o.config
+	if c == nil {
+		c = sarama.NewConfig()
+		c.Version = o.version
+	}
+	// SyncProducer 要求返回发送结果
+	c.Producer.Return.Successes = true
+	c.Producer.Return.Errors = true
+	if o.idempotent {
+		c.Producer.Idempotent = true
+		c.Producer.RequiredAcks = sarama.WaitForAll
+		c.Net.MaxOpenRequests = 1
+	}
+	if o.transactionalID != "" {
+		c.Producer.Transaction.ID = o.transactionalID
+	}
+	// 处理成功后手动提交
+	c.Consumer.Offsets.AutoCommit.Enable = false
+	// 不消费已中止事务中的消息
+	if c.Version.IsAtLeast(sarama.V0_11_0_0) {
+		c.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
+	return c
+}
+
+func (k *Kafka) Send(ctx context.Context, msg *mq.Msg) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if k.isClosed() {
+		return "", mq.ErrClosed
+	}
+	msg.Prepare()
+	pm, err := k.producerMessage(msg)
+	if err != nil {
+		return "", err
+	}
+	if err = k.send(pm); err != nil {
+		return "", err
+	}
+	return msg.ID, nil
+}
+
+func (k *Kafka) SendAsync(ctx context.Context, msg *mq.Msg, callback func(id string, err error)) {
+	mq.SendAsync(ctx, k, msg, callback)
+}
+
+// SendDelay 消息先写入不超过 delay 的最大延迟桶 topic, 由 RelayDelay 到期后转发,
+// 实际投递时间的误差不超过最小的延迟桶
+func (k *Kafka) SendDelay(ctx context.Context, msg *mq.Msg, delay time.Duration) (string, error) {
+	msg.Delay = delay
+	return k.Send(ctx, msg)
+}
+
+// SendTx 在一个事务中发送多条消息, 要么全部对消费者可见, 要么全部丢弃
+func (k *Kafka) SendTx(ctx context.Context, msgs ...*mq.Msg) error {
+	if !k.producer.IsTransactional() {
+		return ErrNotTransactional
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if k.isClosed() {
+		return mq.ErrClosed
+	}
+	pms := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		msg.Prepare()
+		pm, err := k.producerMessage(msg)
+		if err != nil {
+			return err
+		}
+		pms = append(pms, pm)
+	}
+	return k.send(pms...)
+}
+
+// send 事务生产者的每次发送都在独立的事务中提交
+func (k *Kafka) send(pms ...*sarama.ProducerMessage) error {
+	if !k.producer.IsTransactional() {
+		return k.producer.SendMessages(pms)
+	}
+	k.txMu.Lock()
+	defer k.txMu.Unlock()
+	if err := k.producer.BeginTxn(); err != nil {
+		return err
+	}
+	err := k.producer.SendMessages(pms)
+	if err == nil {
+		err = k.producer.CommitTxn()
+	}
+	if err != nil {
+		if abortErr := k.producer.AbortTxn(); abortErr != nil {
+			warn("kafka: abort transaction failed", abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (k *Kafka) producerMessage(msg *mq.Msg) (*sarama.ProducerMessage, error) {
+	if msg.Delay <= 0 {
+		return toProducerMessage(msg), nil
+	}
+	if len(k.opts.delayBuckets) == 0 {
+		return nil, ErrNoDelayBucket
+	}
+	return k.delayed(msg, msg.Topic, time.Now().Add(msg.Delay)), nil
+}
+
+// Close 停止消费并等待处理中的消息完成, 然后关闭生产者(包括通过 Producer 注入的)
+func (k *Kafka) Close() error {
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return nil
+	}
+	k.closed = true
+	groups := k.groups
+	k.mu.Unlock()
+
+	k.cancel()
+	var errs []error
+	for _, g := range groups {
+		if err := g.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	k.wg.Wait()
+	if err := k.producer.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (k *Kafka) isClosed() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.closed
+}
+
+func toProducerMessage(msg *mq.Msg) *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{
+		Topic:     msg.Topic,
+		Value:     sarama.ByteEncoder(msg.Body),
+		Timestamp: msg.Timestamp,
+		Headers:   make([]sarama.RecordHeader, 0, len(msg.Headers)+2),
+	}
+	if msg.Key != "" {
+		pm.Key = sarama.StringEncoder(msg.Key)
+	}
+	pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(headerID), Value: []byte(msg.ID)})
+	if msg.Tag != "" {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(headerTag), Value: []byte(msg.Tag)})
+	}
+	for k, v := range msg.Headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return pm
+}
+
+func fromConsumerMessage(cm *sarama.ConsumerMessage) *mq.Msg {
+	msg := &mq.Msg{
+		Topic:     cm.Topic,
+		Key:       string(cm.Key),
+		Body:      cm.Value,
+		Timestamp: cm.Timestamp,
+	}
+	for _, h := range cm.Headers {
+		if h == nil {
+			continue
+		}
+		switch k := string(h.Key); k {
+		case headerID:
+			msg.ID = string(h.Value)
+		case headerTag:
+			msg.Tag = string(h.Value)
+		default:
+			msg.SetHeader(k, string(h.Value))
+		}
+	}
+	return msg
+}
+
+// normalizeBuckets 按秒取整, 去重并升序排列
+func normalizeBuckets(buckets []time.Duration) []time.Duration {
+	seen := make(map[time.Duration]bool, len(buckets))
+	out := make([]time.Duration, 0, len(buckets))
+	for _, b := range buckets {
+		b = b.Truncate(time.Second)
+		if b <= 0 || seen[b] {
+			continue
+		}
+		seen[b] = true
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func warn(msg string, err error, kvs ...logger.Entry) {
+	if logger.IsInitialized() {
+		logger.WarnErr(msg, err, kvs...)
+	}
+}
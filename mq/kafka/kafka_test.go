@@ -0,0 +1,281 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+func newTestKafka(t *testing.T, producer sarama.SyncProducer, opts ...Option) *Kafka {
+	t.Helper()
+	opts = append([]Option{Producer(producer), Backoff(time.Millisecond, time.Millisecond)}, opts...)
+	k, err := NewKafka(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = k.Close() })
+	return k
+}
+
+func headers(pm *sarama.ProducerMessage) map[string]string {
+	m := make(map[string]string, len(pm.Headers))
+	for _, h := range pm.Headers {
+		m[string(h.Key)] = string(h.Value)
+	}
+	return m
+}
+
+func consumerMessage(pm *sarama.ProducerMessage, offset int64) *sarama.ConsumerMessage {
+	cm := &sarama.ConsumerMessage{Topic: pm.Topic, Offset: offset, Timestamp: pm.Timestamp}
+	if pm.Key != nil {
+		cm.Key, _ = pm.Key.Encode()
+	}
+	cm.Value, _ = pm.Value.Encode()
+	for i := range pm.Headers {
+		cm.Headers = append(cm.Headers, &pm.Headers[i])
+	}
+	return cm
+}
+
+type fakeSession struct {
+	ctx context.Context
+
+	mu      sync.Mutex
+	marked  []int64
+	commits int
+}
+
+func (s *fakeSession) Claims() map[string][]int32                             { return nil }
+func (s *fakeSession) MemberID() string                                       { return "member" }
+func (s *fakeSession) GenerationID() int32                                    { return 1 }
+func (s *fakeSession) MarkOffset(topic string, p int32, off int64, m string)  {}
+func (s *fakeSession) ResetOffset(topic string, p int32, off int64, m string) {}
+func (s *fakeSession) Context() context.Context                               { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commits++
+}
+
+type fakeClaim struct {
+	topic string
+	ch    chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return c.topic }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.ch }
+
+// consumeAll 把 msgs 交给 handler 处理直到全部被消费
+func consumeAll(t *testing.T, h sarama.ConsumerGroupHandler, session *fakeSession, topic string, msgs ...*sarama.ConsumerMessage) {
+	t.Helper()
+	claim := &fakeClaim{topic: topic, ch: make(chan *sarama.ConsumerMessage, len(msgs))}
+	for _, m := range msgs {
+		claim.ch <- m
+	}
+	close(claim.ch)
+	if err := h.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	p := mocks.NewSyncProducer(t, nil)
+	var sent *sarama.ProducerMessage
+	p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pm *sarama.ProducerMessage) error {
+		sent = pm
+		return nil
+	})
+	k := newTestKafka(t, p)
+
+	msg := mq.NewMsg("orders", "created", []byte("hello"))
+	msg.Key = "order-1"
+	msg.SetHeader("trace", "abc")
+	id, err := k.Send(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Topic != "orders" {
+		t.Fatalf("topic = %s", sent.Topic)
+	}
+	if key, _ := sent.Key.Encode(); string(key) != "order-1" {
+		t.Fatalf("key = %s", key)
+	}
+	h := headers(sent)
+	if h[headerID] != id || h[headerTag] != "created" || h["trace"] != "abc" {
+		t.Fatalf("headers = %v", h)
+	}
+
+	got := fromConsumerMessage(consumerMessage(sent, 0))
+	if got.ID != id || got.Tag != "created" || got.Key != "order-1" || string(got.Body) != "hello" ||
+		got.Header("trace") != "abc" || len(got.Headers) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestSendDelay(t *testing.T) {
+	p := mocks.NewSyncProducer(t, nil)
+	var sent *sarama.ProducerMessage
+	p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pm *sarama.ProducerMessage) error {
+		sent = pm
+		return nil
+	})
+	k := newTestKafka(t, p, DelayBuckets(time.Second, time.Minute, 1500*time.Millisecond))
+
+	if _, err := k.SendDelay(context.Background(), mq.NewMsg("orders", "", nil), 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Topic != "mq-delay-60s" {
+		t.Fatalf("topic = %s", sent.Topic)
+	}
+	h := headers(sent)
+	deliverAt, err := unixMilli(h[headerDeliverAt])
+	if err != nil || h[headerDelayTopic] != "orders" {
+		t.Fatalf("headers = %v", h)
+	}
+	if d := time.Until(deliverAt); d < 89*time.Second || d > 90*time.Second {
+		t.Fatalf("deliver in %v", d)
+	}
+
+	k2 := newTestKafka(t, mocks.NewSyncProducer(t, nil), DelayBuckets())
+	if _, err = k2.SendDelay(context.Background(), mq.NewMsg("orders", "", nil), time.Second); !errors.Is(err, ErrNoDelayBucket) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSendTx(t *testing.T) {
+	k := newTestKafka(t, mocks.NewSyncProducer(t, nil))
+	if err := k.SendTx(context.Background(), mq.NewMsg("a", "", nil)); !errors.Is(err, ErrNotTransactional) {
+		t.Fatalf("err = %v", err)
+	}
+
+	o := &Options{version: sarama.DefaultVersion}
+	Transactional("tx-1")(o)
+	p := mocks.NewSyncProducer(t, o.saramaConfig())
+	p.ExpectSendMessageAndSucceed()
+	p.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	k = newTestKafka(t, p)
+	err := k.SendTx(context.Background(), mq.NewMsg("a", "", nil), mq.NewMsg("b", "", nil))
+	if !errors.Is(err, sarama.ErrOutOfBrokers) {
+		t.Fatalf("err = %v", err)
+	}
+	if p.TxnStatus() != sarama.ProducerTxnFlagReady {
+		t.Fatalf("transaction not aborted: %v", p.TxnStatus())
+	}
+}
+
+func TestConsume(t *testing.T) {
+	p := mocks.NewSyncProducer(t, nil)
+	var dead *sarama.ProducerMessage
+	p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(pm *sarama.ProducerMessage) error {
+		dead = pm
+		return nil
+	})
+	k := newTestKafka(t, p, Group("g1"), MaxAttempts(3))
+
+	msg := func(offset int64, tag, body string) *sarama.ConsumerMessage {
+		m := mq.NewMsg("orders", tag, []byte(body))
+		m.Prepare()
+		return consumerMessage(toProducerMessage(m), offset)
+	}
+	attempts := make(map[string]int)
+	h := &groupHandler{k: k, group: "g1", filter: "a||b", handler: func(ctx context.Context, m *mq.Msg) error {
+		attempts[string(m.Body)] = m.Attempts
+		switch string(m.Body) {
+		case "flaky":
+			if m.Attempts < 2 {
+				return errors.New("busy")
+			}
+		case "bad":
+			return mq.Reject(errors.New("malformed"))
+		case "broken":
+			return errors.New("always")
+		}
+		return nil
+	}}
+	session := &fakeSession{ctx: context.Background()}
+	consumeAll(t, h, session, "orders",
+		msg(0, "a", "ok"), msg(1, "b", "flaky"), msg(2, "c", "skipped"), msg(3, "a", "bad"))
+	if fmt.Sprint(session.marked) != "[0 1 2 3]" || session.commits != 4 {
+		t.Fatalf("marked %v, commits %d", session.marked, session.commits)
+	}
+	if attempts["ok"] != 1 || attempts["flaky"] != 2 || attempts["bad"] != 1 {
+		t.Fatalf("attempts = %v", attempts)
+	}
+	if _, ok := attempts["skipped"]; ok {
+		t.Fatal("message with filtered tag was handled")
+	}
+	if dead.Topic != mq.DeadLetterTopic("g1") {
+		t.Fatalf("dead letter topic = %s", dead.Topic)
+	}
+	if hs := headers(dead); hs[mq.HeaderOriginTopic] != "orders" || hs[mq.HeaderError] == "" {
+		t.Fatalf("dead letter headers = %v", hs)
+	}
+
+	// 重试期间会话结束: 不提交, 由新的分区持有者重新消费
+	ctx, cancel := context.WithCancel(context.Background())
+	session = &fakeSession{ctx: ctx}
+	h.handler = func(context.Context, *mq.Msg) error {
+		cancel()
+		return errors.New("always")
+	}
+	consumeAll(t, h, session, "orders", msg(4, "a", "broken"))
+	if len(session.marked) != 0 || session.commits != 0 {
+		t.Fatalf("marked %v, commits %d", session.marked, session.commits)
+	}
+}
+
+func TestRelayDelay(t *testing.T) {
+	p := mocks.NewSyncProducer(t, nil)
+	var sent []*sarama.ProducerMessage
+	check := func(pm *sarama.ProducerMessage) error {
+		sent = append(sent, pm)
+		return nil
+	}
+	p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(check)
+	p.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(check)
+	k := newTestKafka(t, p, DelayBuckets(time.Second, time.Minute))
+
+	bucketMsg := func(offset int64, body string, bucketAt, deliverAt time.Time) *sarama.ConsumerMessage {
+		m := mq.NewMsg("mq-delay-60s", "", []byte(body))
+		m.Prepare()
+		m.SetHeader("trace", body)
+		m.SetHeader(headerDelayTopic, "orders")
+		m.SetHeader(headerDeliverAt, strconv.FormatInt(deliverAt.UnixMilli(), 10))
+		m.SetHeader(headerBucketAt, strconv.FormatInt(bucketAt.UnixMilli(), 10))
+		return consumerMessage(toProducerMessage(m), offset)
+	}
+	now := time.Now()
+	session := &fakeSession{ctx: context.Background()}
+	consumeAll(t, &delayHandler{k: k}, session, "mq-delay-60s",
+		bucketMsg(0, "due", now.Add(-time.Minute), now.Add(-time.Millisecond)),
+		bucketMsg(1, "cascade", now.Add(-time.Minute), now.Add(30*time.Second)))
+
+	if len(sent) != 2 || fmt.Sprint(session.marked) != "[0 1]" {
+		t.Fatalf("sent %d, marked %v", len(sent), session.marked)
+	}
+	if h := headers(sent[0]); sent[0].Topic != "orders" || h["trace"] != "due" || h[headerDelayTopic] != "" {
+		t.Fatalf("forwarded %s %v", sent[0].Topic, h)
+	}
+	if h := headers(sent[1]); sent[1].Topic != "mq-delay-1s" || h[headerDelayTopic] != "orders" {
+		t.Fatalf("cascaded %s %v", sent[1].Topic, h)
+	}
+}
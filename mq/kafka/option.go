@@ -0,0 +1,132 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const (
+	defaultGroup       = "default"
+	defaultMaxAttempts = 16
+	defaultMinBackoff  = 100 * time.Millisecond
+	defaultMaxBackoff  = time.Minute
+	defaultDelayPrefix = "mq-delay-"
+)
+
+// 默认的延迟桶, 与 rocketmq 的延迟级别接近
+var defaultDelayBuckets = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour,
+}
+
+type (
+	Options struct {
+		brokers []string
+		// 为空时使用 sarama.NewConfig() 并按 version 等选项调整
+		config  *sarama.Config
+		version sarama.KafkaVersion
+		// 消费组, 同组的实例分摊 topic 的分区
+		group string
+
+		// 幂等生产者, 避免 broker 重试导致的重复写入
+		idempotent bool
+		// 事务生产者的 transactional.id, 非空时每次发送都在事务中提交
+		transactionalID string
+		// 注入已创建的生产者(主要用于测试), 设置后忽略 brokers 和生产者相关配置
+		producer sarama.SyncProducer
+
+		// 最大投递次数, 超过后进入死信 topic
+		maxAttempts int
+		// 重试间隔从 minBackoff 开始指数增长, 不超过 maxBackoff
+		minBackoff time.Duration
+		maxBackoff time.Duration
+		// 消费失败的重试策略, 设置后代替 maxAttempts 和 backoff; 发送死信等内部重试仍使用 backoff
+		retry mq.RetryPolicy
+
+		// 延迟桶, 每个桶对应一个 topic: delayPrefix + 秒数 + "s", 需要预先创建
+		delayBuckets []time.Duration
+		delayPrefix  string
+	}
+	Option func(o *Options)
+)
+
+func Brokers(addrs ...string) Option {
+	return func(o *Options) {
+		o.brokers = addrs
+	}
+}
+
+// Config 使用自定义的 sarama 配置, 其他选项仍会覆盖其中对应的字段
+func Config(config *sarama.Config) Option {
+	return func(o *Options) {
+		o.config = config
+	}
+}
+
+func Version(version sarama.KafkaVersion) Option {
+	return func(o *Options) {
+		o.version = version
+	}
+}
+
+func Group(group string) Option {
+	return func(o *Options) {
+		o.group = group
+	}
+}
+
+func Idempotent() Option {
+	return func(o *Options) {
+		o.idempotent = true
+	}
+}
+
+// Transactional 开启事务生产者, 隐含 Idempotent
+func Transactional(id string) Option {
+	return func(o *Options) {
+		o.idempotent = true
+		o.transactionalID = id
+	}
+}
+
+func Producer(producer sarama.SyncProducer) Option {
+	return func(o *Options) {
+		o.producer = producer
+	}
+}
+
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.maxAttempts = n
+	}
+}
+
+func Backoff(min, max time.Duration) Option {
+	return func(o *Options) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+func RetryPolicy(policy mq.RetryPolicy) Option {
+	return func(o *Options) {
+		o.retry = policy
+	}
+}
+
+// DelayBuckets 设置延迟桶, 不足一秒的部分向下取整
+func DelayBuckets(buckets ...time.Duration) Option {
+	return func(o *Options) {
+		o.delayBuckets = buckets
+	}
+}
+
+func DelayTopicPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.delayPrefix = prefix
+	}
+}
@@ -0,0 +1,71 @@
+package local
+
+import (
+	"context"
+	"strings"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+var _ mq.DeadLetterQueue = (*Broker)(nil)
+
+// retain 保存发送到死信 topic 的消息, 没有订阅者时也不会丢失
+func (b *Broker) retain(msg *mq.Msg) {
+	if !strings.HasPrefix(msg.Topic, mq.DeadLetterTopic("")) {
+		return
+	}
+	b.deadMu.Lock()
+	b.dead[msg.Topic] = append(b.dead[msg.Topic], msg.Clone())
+	b.deadMu.Unlock()
+}
+
+func (b *Broker) List(ctx context.Context, group string, limit int) ([]*mq.Msg, error) {
+	b.deadMu.Lock()
+	defer b.deadMu.Unlock()
+	dead := b.dead[mq.DeadLetterTopic(group)]
+	if limit > 0 && len(dead) > limit {
+		dead = dead[:limit]
+	}
+	msgs := make([]*mq.Msg, 0, len(dead))
+	for _, m := range dead {
+		msgs = append(msgs, m.Clone())
+	}
+	return msgs, nil
+}
+
+func (b *Broker) Replay(ctx context.Context, group string, ids ...string) (int, error) {
+	msgs := b.remove(group, ids)
+	for i, m := range msgs {
+		if _, err := b.Send(ctx, mq.Revive(m)); err != nil {
+			// 未发送的放回死信队列
+			b.deadMu.Lock()
+			topic := mq.DeadLetterTopic(group)
+			b.dead[topic] = append(msgs[i:], b.dead[topic]...)
+			b.deadMu.Unlock()
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
+
+func (b *Broker) Purge(ctx context.Context, group string, ids ...string) (int, error) {
+	return len(b.remove(group, ids)), nil
+}
+
+// remove 从死信队列中取出匹配 ids 的消息
+func (b *Broker) remove(group string, ids []string) []*mq.Msg {
+	set := mq.NewIDSet(ids)
+	topic := mq.DeadLetterTopic(group)
+	b.deadMu.Lock()
+	defer b.deadMu.Unlock()
+	var removed, kept []*mq.Msg
+	for _, m := range b.dead[topic] {
+		if set.Match(m.ID) {
+			removed = append(removed, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	b.dead[topic] = kept
+	return removed
+}
@@ -1 +1,240 @@
 package local
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// Broker 进程内的消息队列, 消息不落盘, 进程退出即丢失.
+// 每个 (topic, 消费组) 有独立的队列, 消费组订阅之前发送的消息不会投递给该组;
+// 消费组的 Consumer 全部关闭后队列保留, 新的 Consumer 订阅后继续消费.
+type Broker struct {
+	opts  *Options
+	sched *scheduler
+
+	mu        sync.RWMutex
+	closed    bool
+	topics    map[string]map[string]*group
+	consumers map[*consumer]struct{}
+
+	// 死信 topic -> 死信消息, 供 DeadLetterQueue 查看和重放
+	deadMu sync.Mutex
+	dead   map[string][]*mq.Msg
+}
+
+type group struct {
+	name   string
+	filter string
+	queue  *queue
+}
+
+func NewBroker(opts ...Option) *Broker {
+	o := &Options{
+		maxAttempts: defaultMaxAttempts,
+		minBackoff:  defaultMinBackoff,
+		maxBackoff:  defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.retry == nil {
+		o.retry = mq.ExponentialRetry(o.minBackoff, o.maxBackoff, 0, o.maxAttempts)
+	}
+	return &Broker{
+		opts:      o,
+		sched:     newScheduler(),
+		topics:    make(map[string]map[string]*group),
+		consumers: make(map[*consumer]struct{}),
+		dead:      make(map[string][]*mq.Msg),
+	}
+}
+
+func (b *Broker) Send(ctx context.Context, msg *mq.Msg) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return "", mq.ErrClosed
+	}
+	msg.Prepare()
+	m := msg.Clone()
+	if m.Delay > 0 {
+		b.sched.after(m.Delay, func() {
+			b.publish(m)
+		})
+		return m.ID, nil
+	}
+	b.publish(m)
+	return m.ID, nil
+}
+
+func (b *Broker) SendAsync(ctx context.Context, msg *mq.Msg, callback func(id string, err error)) {
+	mq.SendAsync(ctx, b, msg, callback)
+}
+
+func (b *Broker) SendDelay(ctx context.Context, msg *mq.Msg, delay time.Duration) (string, error) {
+	msg.Delay = delay
+	return b.Send(ctx, msg)
+}
+
+// Close 关闭 Broker 及其所有 Consumer, 未到期的延迟消息被丢弃
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	consumers := make([]*consumer, 0, len(b.consumers))
+	for c := range b.consumers {
+		consumers = append(consumers, c)
+	}
+	b.mu.Unlock()
+	for _, c := range consumers {
+		_ = c.Close()
+	}
+	b.sched.close()
+	return nil
+}
+
+// Pending 消费组 group 在 topic 上待消费的消息数(不含等待重试的消息)
+func (b *Broker) Pending(topic, group string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if g, ok := b.topics[topic][group]; ok {
+		return g.queue.len()
+	}
+	return 0
+}
+
+// publish 投递给订阅了 topic 且 tag 匹配的每个消费组
+func (b *Broker) publish(msg *mq.Msg) {
+	b.retain(msg)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, g := range b.topics[msg.Topic] {
+		if mq.MatchTag(g.filter, msg.Tag) {
+			g.queue.push(msg.Clone())
+		}
+	}
+}
+
+func (b *Broker) group(topic, name, filter string) *group {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	groups, ok := b.topics[topic]
+	if !ok {
+		groups = make(map[string]*group)
+		b.topics[topic] = groups
+	}
+	g, ok := groups[name]
+	if !ok {
+		g = &group{name: name, queue: newQueue()}
+		groups[name] = g
+	}
+	// 同组的 Consumer 应使用相同的过滤表达式, 以最后一次订阅为准
+	g.filter = filter
+	return g
+}
+
+func (b *Broker) handle(ctx context.Context, g *group, msg *mq.Msg, handler mq.Handler) {
+	msg.Attempts++
+	err := handler(ctx, msg)
+	if err == nil {
+		return
+	}
+	delay, ok := b.opts.retry.Next(msg.Attempts)
+	if errors.Is(err, mq.ErrReject) || !ok {
+		b.deadLetter(g, msg, err)
+		return
+	}
+	b.sched.after(delay, func() {
+		g.queue.push(msg)
+	})
+}
+
+func (b *Broker) deadLetter(g *group, msg *mq.Msg, err error) {
+	dl := msg.Clone()
+	dl.Topic = mq.DeadLetterTopic(g.name)
+	dl.Delay = 0
+	dl.Attempts = 0
+	dl.SetHeader(mq.HeaderOriginTopic, msg.Topic)
+	dl.SetHeader(mq.HeaderError, err.Error())
+	b.publish(dl)
+}
+
+type consumer struct {
+	broker *Broker
+	opts   *ConsumerOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewConsumer 创建消费组中的一个 Consumer
+func (b *Broker) NewConsumer(opts ...ConsumerOption) mq.Consumer {
+	o := &ConsumerOptions{
+		group:       defaultGroup,
+		concurrency: defaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &consumer{broker: b, opts: o, ctx: ctx, cancel: cancel}
+	b.mu.Lock()
+	if b.closed {
+		c.closed = true
+		cancel()
+	} else {
+		b.consumers[c] = struct{}{}
+	}
+	b.mu.Unlock()
+	return c
+}
+
+func (c *consumer) Subscribe(topic, tag string, handler mq.Handler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return mq.ErrClosed
+	}
+	g := c.broker.group(topic, c.opts.group, tag)
+	for i := 0; i < c.opts.concurrency; i++ {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			for c.ctx.Err() == nil {
+				msg, ok := g.queue.pop(c.ctx)
+				if !ok {
+					return
+				}
+				c.broker.handle(c.ctx, g, msg, handler)
+			}
+		}()
+	}
+	return nil
+}
+
+// Close 停止消费并等待处理中的消息完成
+func (c *consumer) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.cancel()
+	c.wg.Wait()
+	c.broker.mu.Lock()
+	delete(c.broker.consumers, c)
+	c.broker.mu.Unlock()
+	return nil
+}
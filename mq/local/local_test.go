@@ -0,0 +1,345 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+func receive(t *testing.T, ch <-chan *mq.Msg) *mq.Msg {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+		return nil
+	}
+}
+
+func TestSendSubscribe(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+	defer b.Close()
+
+	received := make(chan *mq.Msg, 10)
+	c := b.NewConsumer()
+	if err := c.Subscribe("topic", "a || b", func(ctx context.Context, msg *mq.Msg) error {
+		received <- msg
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := mq.NewMsg("topic", "a", []byte("hello"))
+	msg.Key = "k"
+	msg.SetHeader("h", "v")
+	id, err := b.Send(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" || id != msg.ID {
+		t.Fatalf("id = %q, msg.ID = %q", id, msg.ID)
+	}
+	// tag 不匹配的消息被过滤
+	if _, err = b.Send(ctx, mq.NewMsg("topic", "c", nil)); err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, received)
+	if got.ID != id || string(got.Body) != "hello" || got.Key != "k" || got.Header("h") != "v" || got.Attempts != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(received) != 0 {
+		t.Fatal("filtered message delivered")
+	}
+}
+
+func TestConsumerGroups(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+	defer b.Close()
+
+	const n = 100
+	var (
+		mu     sync.Mutex
+		counts = map[string]int{}
+		seen   = map[string]map[string]bool{}
+		wg     sync.WaitGroup
+	)
+	wg.Add(2 * n)
+	handler := func(name, group string) mq.Handler {
+		return func(ctx context.Context, msg *mq.Msg) error {
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			counts[name]++
+			if seen[group] == nil {
+				seen[group] = map[string]bool{}
+			}
+			if seen[group][msg.ID] {
+				t.Errorf("group %s received %s twice", group, msg.ID)
+			}
+			seen[group][msg.ID] = true
+			wg.Done()
+			return nil
+		}
+	}
+	// g1 中两个 Consumer 竞争消费, g2 独立收到全部消息
+	for _, name := range []string{"g1-a", "g1-b"} {
+		_ = b.NewConsumer(Group("g1"), Concurrency(2)).Subscribe("topic", "", handler(name, "g1"))
+	}
+	_ = b.NewConsumer(Group("g2")).Subscribe("topic", "*", handler("g2", "g2"))
+
+	for i := 0; i < n; i++ {
+		if _, err := b.Send(ctx, mq.NewMsg("topic", "", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if counts["g1-a"]+counts["g1-b"] != n || counts["g2"] != n {
+		t.Fatalf("counts = %v", counts)
+	}
+	if counts["g1-a"] == 0 || counts["g1-b"] == 0 {
+		t.Fatalf("messages not shared between competing consumers: %v", counts)
+	}
+}
+
+func TestSendDelay(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+	defer b.Close()
+
+	received := make(chan *mq.Msg, 3)
+	_ = b.NewConsumer().Subscribe("topic", "", func(ctx context.Context, msg *mq.Msg) error {
+		received <- msg
+		return nil
+	})
+	start := time.Now()
+	_, _ = b.SendDelay(ctx, mq.NewMsg("topic", "", []byte("late")), 150*time.Millisecond)
+	_, _ = b.SendDelay(ctx, mq.NewMsg("topic", "", []byte("early")), 50*time.Millisecond)
+	_, _ = b.Send(ctx, mq.NewMsg("topic", "", []byte("now")))
+
+	for _, want := range []string{"now", "early", "late"} {
+		if got := receive(t, received); string(got.Body) != want {
+			t.Fatalf("got %q, want %q", got.Body, want)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("delayed message delivered after %v", elapsed)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(Backoff(10*time.Millisecond, 40*time.Millisecond))
+	defer b.Close()
+
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+	)
+	done := make(chan *mq.Msg, 1)
+	_ = b.NewConsumer().Subscribe("topic", "", func(ctx context.Context, msg *mq.Msg) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if msg.Attempts < 3 {
+			return errors.New("temporary")
+		}
+		done <- msg
+		return nil
+	})
+	_, _ = b.Send(ctx, mq.NewMsg("topic", "", nil))
+	if msg := receive(t, done); msg.Attempts != 3 {
+		t.Fatalf("Attempts = %d, want 3", msg.Attempts)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// 重试间隔指数增长: 10ms, 20ms
+	if d := attempts[2].Sub(attempts[1]); d < 20*time.Millisecond {
+		t.Fatalf("second backoff = %v", d)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(MaxAttempts(3), Backoff(time.Millisecond, time.Millisecond))
+	defer b.Close()
+
+	var calls int32
+	c := b.NewConsumer(Group("g"))
+	_ = c.Subscribe("topic", "", func(ctx context.Context, msg *mq.Msg) error {
+		atomic.AddInt32(&calls, 1)
+		if msg.Tag == "bad" {
+			return mq.Reject(errors.New("malformed"))
+		}
+		return errors.New("always fails")
+	})
+	dead := make(chan *mq.Msg, 2)
+	_ = b.NewConsumer(Group("dlq")).Subscribe(mq.DeadLetterTopic("g"), "", func(ctx context.Context, msg *mq.Msg) error {
+		dead <- msg
+		return nil
+	})
+
+	id, _ := b.Send(ctx, mq.NewMsg("topic", "retry", nil))
+	msg := receive(t, dead)
+	if msg.ID != id || msg.Header(mq.HeaderOriginTopic) != "topic" || msg.Header(mq.HeaderError) != "always fails" {
+		t.Fatalf("dead letter = %+v", msg)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("calls = %d, want 3", n)
+	}
+
+	// Reject 的消息不重试
+	_, _ = b.Send(ctx, mq.NewMsg("topic", "bad", nil))
+	msg = receive(t, dead)
+	if msg.Tag != "bad" || atomic.LoadInt32(&calls) != 4 {
+		t.Fatalf("rejected message retried, calls = %d", calls)
+	}
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker(RetryPolicy(mq.FixedRetry(time.Millisecond, 2)))
+	defer b.Close()
+
+	healthy := make(chan bool, 1)
+	received := make(chan *mq.Msg, 4)
+	_ = b.NewConsumer(Group("g")).Subscribe("topic", "", func(ctx context.Context, msg *mq.Msg) error {
+		select {
+		case <-healthy:
+			received <- msg
+			return nil
+		default:
+			return errors.New("down")
+		}
+	})
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, _ := b.Send(ctx, mq.NewMsg("topic", "", []byte{byte('a' + i)}))
+		ids = append(ids, id)
+	}
+	var dead []*mq.Msg
+	for deadline := time.Now().Add(2 * time.Second); len(dead) < 3; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letters = %d", len(dead))
+		}
+		dead, _ = b.List(ctx, "g", 0)
+	}
+	if d := dead[0]; d.Header(mq.HeaderError) != "down" || d.Header(mq.HeaderOriginTopic) != "topic" {
+		t.Fatalf("dead letter = %+v", d)
+	}
+	if msgs, _ := b.List(ctx, "g", 1); len(msgs) != 1 {
+		t.Fatalf("List(1) = %d", len(msgs))
+	}
+
+	if n, err := b.Purge(ctx, "g", ids[0]); err != nil || n != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	healthy <- true
+	if n, err := b.Replay(ctx, "g", ids[1]); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	msg := receive(t, received)
+	if msg.ID != ids[1] || msg.Topic != "topic" || msg.Attempts != 1 || len(msg.Headers) != 0 {
+		t.Fatalf("replayed = %+v", msg)
+	}
+	if msgs, _ := b.List(ctx, "g", 0); len(msgs) != 1 || msgs[0].ID != ids[2] {
+		t.Fatalf("remaining = %+v", msgs)
+	}
+	if n, _ := b.Purge(ctx, "g"); n != 1 {
+		t.Fatalf("Purge all = %d", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+
+	c := b.NewConsumer()
+	received := make(chan *mq.Msg, 1)
+	_ = c.Subscribe("topic", "", func(ctx context.Context, msg *mq.Msg) error {
+		received <- msg
+		return nil
+	})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 消费组的队列保留, 新的 Consumer 继续消费
+	_, _ = b.Send(ctx, mq.NewMsg("topic", "", nil))
+	if n := b.Pending("topic", "default"); n != 1 {
+		t.Fatalf("Pending = %d, want 1", n)
+	}
+	_ = b.NewConsumer().Subscribe("topic", "", func(ctx context.Context, msg *mq.Msg) error {
+		received <- msg
+		return nil
+	})
+	receive(t, received)
+
+	_ = b.Close()
+	if _, err := b.Send(ctx, mq.NewMsg("topic", "", nil)); !errors.Is(err, mq.ErrClosed) {
+		t.Fatalf("Send after Close = %v", err)
+	}
+	if err := b.NewConsumer().Subscribe("topic", "", nil); !errors.Is(err, mq.ErrClosed) {
+		t.Fatalf("Subscribe after Close = %v", err)
+	}
+}
+
+func TestRequestReply(t *testing.T) {
+	b := NewBroker()
+	defer b.Close()
+	server := mq.NewServer(b, b.NewConsumer(Group("server")))
+	if err := server.Handle("echo", "", func(ctx context.Context, req *mq.Msg) (*mq.Msg, error) {
+		switch string(req.Body) {
+		case "fail":
+			return nil, errors.New("boom")
+		case "slow":
+			// 超时后的响应被丢弃
+			time.Sleep(100 * time.Millisecond)
+		}
+		return mq.NewMsg("", "", append([]byte("re: "), req.Body...)), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	r := mq.NewRequester(b, b.NewConsumer(), "")
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprint(i)
+			reply, err := r.Request(ctx, mq.NewMsg("echo", "", []byte(body)))
+			if err != nil || string(reply.Body) != "re: "+body {
+				t.Errorf("Request(%s) = %v, %v", body, reply, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := r.Request(ctx, mq.NewMsg("echo", "", []byte("fail"))); !errors.Is(err, mq.ErrRemote) ||
+		!strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Request(fail) = %v", err)
+	}
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.Request(short, mq.NewMsg("echo", "", []byte("slow"))); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Request(slow) = %v", err)
+	}
+
+	_ = r.Close()
+	if _, err := r.Request(ctx, mq.NewMsg("echo", "", nil)); !errors.Is(err, mq.ErrClosed) {
+		t.Fatalf("Request after Close = %v", err)
+	}
+}
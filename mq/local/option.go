@@ -0,0 +1,67 @@
+package local
+
+import (
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const (
+	defaultGroup       = "default"
+	defaultConcurrency = 1
+	defaultMaxAttempts = 16
+	defaultMinBackoff  = 100 * time.Millisecond
+	defaultMaxBackoff  = time.Minute
+)
+
+type (
+	Options struct {
+		// 最大投递次数, 超过后进入死信 topic
+		maxAttempts int
+		// 重试间隔从 minBackoff 开始指数增长, 不超过 maxBackoff
+		minBackoff time.Duration
+		maxBackoff time.Duration
+		// 设置后代替 maxAttempts 和 backoff
+		retry mq.RetryPolicy
+	}
+	Option func(o *Options)
+
+	ConsumerOptions struct {
+		// 消费组, 同组的 Consumer 竞争消费, 不同组各自收到全部消息
+		group string
+		// 每个订阅的并发处理数
+		concurrency int
+	}
+	ConsumerOption func(o *ConsumerOptions)
+)
+
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.maxAttempts = n
+	}
+}
+
+func Backoff(min, max time.Duration) Option {
+	return func(o *Options) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+func RetryPolicy(policy mq.RetryPolicy) Option {
+	return func(o *Options) {
+		o.retry = policy
+	}
+}
+
+func Group(group string) ConsumerOption {
+	return func(o *ConsumerOptions) {
+		o.group = group
+	}
+}
+
+func Concurrency(n int) ConsumerOption {
+	return func(o *ConsumerOptions) {
+		o.concurrency = n
+	}
+}
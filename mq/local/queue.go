@@ -0,0 +1,162 @@
+package local
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// queue 无界 FIFO, 多个 worker 竞争消费
+type queue struct {
+	mu     sync.Mutex
+	msgs   []*mq.Msg
+	notify chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{notify: make(chan struct{}, 1)}
+}
+
+func (q *queue) push(msg *mq.Msg) {
+	q.mu.Lock()
+	q.msgs = append(q.msgs, msg)
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop 阻塞直到取到消息或 ctx 结束
+func (q *queue) pop(ctx context.Context) (*mq.Msg, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.msgs) > 0 {
+			msg := q.msgs[0]
+			q.msgs[0] = nil
+			q.msgs = q.msgs[1:]
+			remain := len(q.msgs)
+			q.mu.Unlock()
+			if remain > 0 {
+				// 唤醒其他等待的 worker
+				q.signal()
+			}
+			return msg, true
+		}
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-q.notify:
+		}
+	}
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.msgs)
+}
+
+type task struct {
+	at time.Time
+	fn func()
+}
+
+type tasks []*task
+
+func (t tasks) Len() int            { return len(t) }
+func (t tasks) Less(i, j int) bool  { return t[i].at.Before(t[j].at) }
+func (t tasks) Swap(i, j int)       { t[i], t[j] = t[j], t[i] }
+func (t *tasks) Push(x interface{}) { *t = append(*t, x.(*task)) }
+func (t *tasks) Pop() interface{} {
+	old := *t
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*t = old[:n-1]
+	return item
+}
+
+// scheduler 基于最小堆的定时器, 用于延迟投递和重试退避, 所有任务共用一个 goroutine
+type scheduler struct {
+	mu     sync.Mutex
+	tasks  tasks
+	wakeup chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newScheduler() *scheduler {
+	s := &scheduler{
+		wakeup: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *scheduler) after(d time.Duration, fn func()) {
+	s.mu.Lock()
+	heap.Push(&s.tasks, &task{at: time.Now().Add(d), fn: fn})
+	s.mu.Unlock()
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+func (s *scheduler) run() {
+	defer close(s.done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		var due []*task
+		now := time.Now()
+		for len(s.tasks) > 0 && !s.tasks[0].at.After(now) {
+			due = append(due, heap.Pop(&s.tasks).(*task))
+		}
+		wait := time.Hour
+		if len(s.tasks) > 0 {
+			wait = s.tasks[0].at.Sub(now)
+		}
+		s.mu.Unlock()
+		for _, t := range due {
+			t.fn()
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-s.stop:
+			return
+		case <-s.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+// close 停止调度, 未到期的任务被丢弃
+func (s *scheduler) close() {
+	close(s.stop)
+	<-s.done
+}
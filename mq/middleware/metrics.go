@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const (
+	resultOK     = "ok"
+	resultRetry  = "retry"
+	resultReject = "reject"
+)
+
+// Prometheus 同时提供消费指标的中间件和 prometheus.Collector
+//
+//	collector := middleware.NewPrometheus("app")
+//	prometheus.MustRegister(collector)
+//	consumer.Subscribe(topic, tag, mq.Chain(handler, collector.Middleware))
+type Prometheus struct {
+	messages *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// NewPrometheus namespace 为指标名前缀, topic 作为 label
+func NewPrometheus(namespace string) *Prometheus {
+	return &Prometheus{
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "messages_total",
+			Help: "Number of handled messages by result and delivery attempt.",
+		}, []string{"topic", "result", "redelivered"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "handle_duration_seconds",
+			Help:    "Message handler latency in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"topic"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "mq", Name: "in_flight",
+			Help: "Number of messages being handled.",
+		}, []string{"topic"}),
+	}
+}
+
+func (p *Prometheus) Middleware(next mq.Handler) mq.Handler {
+	return func(ctx context.Context, msg *mq.Msg) error {
+		inFlight := p.inFlight.WithLabelValues(msg.Topic)
+		inFlight.Inc()
+		defer inFlight.Dec()
+		start := time.Now()
+		err := next(ctx, msg)
+		p.latency.WithLabelValues(msg.Topic).Observe(time.Since(start).Seconds())
+		result := resultOK
+		switch {
+		case errors.Is(err, mq.ErrReject):
+			result = resultReject
+		case err != nil:
+			result = resultRetry
+		}
+		p.messages.WithLabelValues(msg.Topic, result, strconv.FormatBool(msg.Attempts > 1)).Inc()
+		return err
+	}
+}
+
+func (p *Prometheus) Describe(ch chan<- *prometheus.Desc) {
+	p.messages.Describe(ch)
+	p.latency.Describe(ch)
+	p.inFlight.Describe(ch)
+}
+
+func (p *Prometheus) Collect(ch chan<- prometheus.Metric) {
+	p.messages.Collect(ch)
+	p.latency.Collect(ch)
+	p.inFlight.Collect(ch)
+}
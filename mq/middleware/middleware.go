@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// ErrPanic Recovery 捕获到 Handler panic 时返回的错误, 消息按普通错误重试
+var ErrPanic = errors.New("mq: handler panicked")
+
+// Logging 记录每条消息的处理结果和耗时, 成功时为 debug 级别, 失败时为 warn 级别
+func Logging() mq.Middleware {
+	return func(next mq.Handler) mq.Handler {
+		return func(ctx context.Context, msg *mq.Msg) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			if !logger.IsInitialized() {
+				return err
+			}
+			kvs := []logger.Entry{
+				logger.KV("topic", msg.Topic),
+				logger.KV("tag", msg.Tag),
+				logger.KV("id", msg.ID),
+				logger.KV("attempts", msg.Attempts),
+				logger.KV("latency", time.Since(start)),
+			}
+			if err != nil {
+				logger.WarnErr("mq: handle message failed", err, kvs...)
+			} else {
+				logger.DebugKV("mq: message handled", kvs...)
+			}
+			return err
+		}
+	}
+}
+
+// Recovery 将 Handler 的 panic 转为包装了 ErrPanic 的错误, 并记录堆栈
+func Recovery() mq.Middleware {
+	return func(next mq.Handler) mq.Handler {
+		return func(ctx context.Context, msg *mq.Msg) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v", ErrPanic, r)
+					if logger.IsInitialized() {
+						logger.ErrorKV("mq: handler panicked",
+							logger.KV("topic", msg.Topic),
+							logger.KV("id", msg.ID),
+							logger.KV("panic", r),
+							logger.KV("stack", string(debug.Stack())))
+					}
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Timeout 限制单条消息的处理时长, Handler 需要响应 ctx 的取消
+func Timeout(d time.Duration) mq.Middleware {
+	return func(next mq.Handler) mq.Handler {
+		return func(ctx context.Context, msg *mq.Msg) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, msg)
+		}
+	}
+}
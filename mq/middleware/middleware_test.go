@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+func TestRecoveryAndTimeout(t *testing.T) {
+	h := mq.Chain(func(ctx context.Context, msg *mq.Msg) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("no deadline")
+		}
+		panic("boom")
+	}, Logging(), Recovery(), Timeout(time.Second))
+	err := h(context.Background(), mq.NewMsg("orders", "", nil))
+	if !errors.Is(err, ErrPanic) || err.Error() != "mq: handler panicked: boom" {
+		t.Fatalf("err = %v", err)
+	}
+
+	h = mq.Chain(func(ctx context.Context, msg *mq.Msg) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, Timeout(10*time.Millisecond))
+	if err = h(context.Background(), mq.NewMsg("orders", "", nil)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	collector := NewPrometheus("test")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	h := mq.Chain(func(ctx context.Context, msg *mq.Msg) error {
+		switch string(msg.Body) {
+		case "retry":
+			return errors.New("busy")
+		case "reject":
+			return mq.Reject(errors.New("malformed"))
+		}
+		return nil
+	}, collector.Middleware)
+	for _, body := range []string{"ok", "ok", "retry", "reject"} {
+		msg := mq.NewMsg("orders", "", []byte(body))
+		msg.Attempts = 1
+		_ = h(context.Background(), msg)
+	}
+	msg := mq.NewMsg("orders", "", []byte("ok"))
+	msg.Attempts = 2
+	_ = h(context.Background(), msg)
+
+	for _, c := range []struct {
+		result, redelivered string
+		want                float64
+	}{
+		{resultOK, "false", 2},
+		{resultOK, "true", 1},
+		{resultRetry, "false", 1},
+		{resultReject, "false", 1},
+	} {
+		if v := testutil.ToFloat64(collector.messages.WithLabelValues("orders", c.result, c.redelivered)); v != c.want {
+			t.Errorf("messages{%s,%s} = %v, want %v", c.result, c.redelivered, v, c.want)
+		}
+	}
+	if v := testutil.ToFloat64(collector.inFlight.WithLabelValues("orders")); v != 0 {
+		t.Fatalf("in flight = %v", v)
+	}
+	if n := testutil.CollectAndCount(collector, "test_mq_handle_duration_seconds"); n != 1 {
+		t.Fatalf("latency series = %d", n)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	msg := mq.NewMsg("orders", "", nil)
+	Inject(trace.ContextWithSpanContext(context.Background(), parent), msg)
+	if msg.Header("traceparent") == "" {
+		t.Fatalf("headers = %v", msg.Headers)
+	}
+
+	var got trace.SpanContext
+	h := mq.Chain(func(ctx context.Context, msg *mq.Msg) error {
+		got = trace.SpanContextFromContext(ctx)
+		return nil
+	}, Tracing(nil))
+	if err := h(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID() != parent.TraceID() {
+		t.Fatalf("trace id = %s, want %s", got.TraceID(), parent.TraceID())
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const tracerName = "github.com/davveo/go-toolkit/mq"
+
+// Inject 将 ctx 中的链路信息写入 msg.Headers, 发送前调用, 消费端由 Tracing 还原
+func Inject(ctx context.Context, msg *mq.Msg) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	for k, v := range carrier {
+		msg.SetHeader(k, v)
+	}
+}
+
+// Tracing 从 msg.Headers 还原发送端的链路, 为每次处理创建 consumer span;
+// tp 为 nil 时使用 otel 的全局 TracerProvider
+func Tracing(tp trace.TracerProvider) mq.Middleware {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := tp.Tracer(tracerName)
+	return func(next mq.Handler) mq.Handler {
+		return func(ctx context.Context, msg *mq.Msg) error {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.Headers))
+			ctx, span := tracer.Start(ctx, msg.Topic+" process",
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("messaging.operation", "process"),
+					attribute.String("messaging.destination.name", msg.Topic),
+					attribute.String("messaging.message.id", msg.ID),
+					attribute.String("messaging.message.tag", msg.Tag),
+					attribute.String("messaging.message.key", msg.Key),
+					attribute.Int("messaging.message.attempts", msg.Attempts),
+				))
+			defer span.End()
+			err := next(ctx, msg)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
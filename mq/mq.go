@@ -1,13 +1,116 @@
 package mq
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
-type MQ interface {
-	Send(ctx context.Context)
-	SendDelay(ctx context.Context)
-	Consume(ctx context.Context)
+var (
+	// ErrClosed Producer/Consumer 已关闭
+	ErrClosed = errors.New("mq: closed")
+	// ErrReject Handler 返回包装了 ErrReject 的错误时不再重试, 消息直接进入死信队列
+	ErrReject = errors.New("mq: message rejected")
+	// ErrNotSupported 后端不支持该操作
+	ErrNotSupported = errors.New("mq: not supported")
+)
+
+// Reject 标记消息无法处理(如格式错误), 重试也不会成功
+func Reject(err error) error {
+	return fmt.Errorf("%w: %w", ErrReject, err)
 }
 
+// Init 不做任何事, 仅为兼容旧代码保留
+//
+// Deprecated: 使用各后端的构造函数创建 Producer/Consumer.
 func Init() error {
 	return nil
 }
+
+// Handler 返回 nil 时确认消息; 返回 Reject 包装的错误时不再重试;
+// 返回其他错误时消息按重试策略重新投递, 超过最大次数后进入死信队列.
+// ctx 在 Consumer 关闭时取消.
+type Handler func(ctx context.Context, msg *Msg) error
+
+// Middleware 包装 Handler, 在处理消息前后执行通用逻辑
+type Middleware func(next Handler) Handler
+
+// Chain 按顺序组合中间件, 第一个中间件在最外层
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type Producer interface {
+	// Send 同步发送, msg.Delay > 0 时等同于 SendDelay
+	Send(ctx context.Context, msg *Msg) (id string, err error)
+	// SendAsync 异步发送, 发送结果通过 callback 返回, callback 可以为 nil
+	SendAsync(ctx context.Context, msg *Msg, callback func(id string, err error))
+	// SendDelay 延迟 delay 后投递
+	SendDelay(ctx context.Context, msg *Msg, delay time.Duration) (id string, err error)
+	Close() error
+}
+
+type Consumer interface {
+	// Subscribe 订阅 topic 并开始消费, tag 为空或 "*" 时接收所有消息, 多个 tag 用 "||" 分隔
+	Subscribe(topic, tag string, handler Handler) error
+	Close() error
+}
+
+// MQ 同时提供生产和消费的实现
+type MQ interface {
+	Producer
+	Consumer
+}
+
+// MatchTag 判断消息 tag 是否满足订阅时的 tag 过滤表达式
+func MatchTag(filter, tag string) bool {
+	filter = strings.TrimSpace(filter)
+	if filter == "" || filter == "*" {
+		return true
+	}
+	for _, f := range strings.Split(filter, "||") {
+		if strings.TrimSpace(f) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SendAsync 通过同步发送实现 Producer.SendAsync, 供没有原生异步接口的实现使用
+func SendAsync(ctx context.Context, p Producer, msg *Msg, callback func(id string, err error)) {
+	go func() {
+		id, err := p.Send(ctx, msg)
+		if callback != nil {
+			callback(id, err)
+		}
+	}()
+}
+
+const (
+	// HeaderOriginTopic 死信消息原来的 topic
+	HeaderOriginTopic = "x-origin-topic"
+	// HeaderError 消息进入死信队列前最后一次处理的错误
+	HeaderError = "x-error"
+	// HeaderAttempts 消息经重试 topic 转发时已经投递的次数
+	HeaderAttempts = "x-attempts"
+	// HeaderContentType 消息体的编码格式, 如 application/json
+	HeaderContentType = "content-type"
+	// HeaderSchemaID 编码消息体使用的 schema 在 schema registry 中的 ID
+	HeaderSchemaID = "x-schema-id"
+)
+
+// DeadLetterTopic 消费组 group 处理失败的消息转入的死信 topic,
+// 只使用各 broker 都允许的字符(kafka/rocketmq 的 topic 名不能包含 %)
+func DeadLetterTopic(group string) string {
+	return "DLQ-" + group
+}
+
+// RetryTopic 消费组 group 重试间隔不超过 tier 的消息转入的重试 topic
+func RetryTopic(group string, tier time.Duration) string {
+	return fmt.Sprintf("RETRY-%s-%dms", group, tier.Milliseconds())
+}
@@ -0,0 +1,110 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchTag(t *testing.T) {
+	cases := []struct {
+		filter, tag string
+		want        bool
+	}{
+		{"", "a", true},
+		{"*", "a", true},
+		{"a", "a", true},
+		{"a", "b", false},
+		{"a || b", "b", true},
+		{"a||b", "c", false},
+		{"a", "", false},
+	}
+	for _, c := range cases {
+		if got := MatchTag(c.filter, c.tag); got != c.want {
+			t.Errorf("MatchTag(%q, %q) = %v, want %v", c.filter, c.tag, got, c.want)
+		}
+	}
+}
+
+func TestMsg(t *testing.T) {
+	m := NewMsg("topic", "tag", []byte("body"))
+	m.Prepare()
+	if m.ID == "" || m.Timestamp.IsZero() {
+		t.Fatal("Prepare did not fill ID and Timestamp")
+	}
+	m.SetHeader("k", "v")
+	c := m.Clone()
+	c.SetHeader("k", "changed")
+	c.Body[0] = 'B'
+	if m.Header("k") != "v" || string(m.Body) != "body" {
+		t.Fatal("Clone shares Headers or Body")
+	}
+	cause := errors.New("bad")
+	if err := Reject(cause); !errors.Is(err, ErrReject) || !errors.Is(err, cause) {
+		t.Fatal("Reject does not wrap ErrReject and the cause")
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, msg *Msg) error {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+	h := Chain(func(ctx context.Context, msg *Msg) error {
+		calls = append(calls, "handler")
+		return nil
+	}, mw("a"), mw("b"))
+	if err := h(context.Background(), NewMsg("t", "", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(calls, ","); got != "a,b,handler" {
+		t.Fatalf("calls = %s", got)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := ExponentialRetry(100*time.Millisecond, time.Second, 0, 10)
+	for attempts, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 9: time.Second} {
+		if d, ok := p.Next(attempts); !ok || d != want {
+			t.Fatalf("Next(%d) = %v, %v, want %v", attempts, d, ok, want)
+		}
+	}
+	if _, ok := p.Next(10); ok {
+		t.Fatal("expected no more retries")
+	}
+	j := ExponentialRetry(time.Second, time.Second, 0.5, 0)
+	for i := 0; i < 100; i++ {
+		if d, ok := j.Next(100); !ok || d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jittered delay = %v", d)
+		}
+	}
+	f := FixedRetry(time.Second, 2)
+	if d, ok := f.Next(1); !ok || d != time.Second {
+		t.Fatalf("fixed Next(1) = %v, %v", d, ok)
+	}
+	if _, ok := f.Next(2); ok {
+		t.Fatal("expected no more retries")
+	}
+}
+
+func TestRevive(t *testing.T) {
+	dl := NewMsg(DeadLetterTopic("g"), "a", []byte("x"))
+	dl.SetHeader(HeaderOriginTopic, "orders")
+	dl.SetHeader(HeaderError, "boom")
+	dl.SetHeader("trace", "abc")
+	dl.Attempts = 3
+	m := Revive(dl)
+	if m.Topic != "orders" || m.Tag != "a" || m.Attempts != 0 || len(m.Headers) != 1 || m.Header("trace") != "abc" {
+		t.Fatalf("revived = %+v", m)
+	}
+	if dl.Header(HeaderOriginTopic) != "orders" {
+		t.Fatal("dead letter modified")
+	}
+}
@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+)
+
+const (
+	defaultTable           = "mq_outbox"
+	defaultBatch           = 100
+	defaultPollInterval    = time.Second
+	defaultMinBackoff      = time.Second
+	defaultMaxBackoff      = time.Minute
+	defaultMaxAttempts     = 16
+	defaultRetention       = 24 * time.Hour
+	defaultCleanupInterval = time.Minute
+)
+
+// Dialect 不同数据库的 SQL 差异
+type Dialect struct {
+	// 自增主键列定义, 消息按主键顺序发布
+	AutoIncrement string
+	// 消息体列类型
+	BlobType string
+	// 是否在 CREATE TABLE 中定义索引, 否则通过 CREATE INDEX IF NOT EXISTS 单独创建
+	InlineIndex bool
+}
+
+var (
+	MySQL = Dialect{
+		AutoIncrement: "BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY",
+		BlobType:      "MEDIUMBLOB",
+		InlineIndex:   true,
+	}
+	SQLite = Dialect{
+		AutoIncrement: "INTEGER PRIMARY KEY AUTOINCREMENT",
+		BlobType:      "BLOB",
+	}
+)
+
+type (
+	Options struct {
+		// outbox 表名
+		table   string
+		dialect Dialect
+		// 每轮读取的未发送消息数
+		batch int
+		// 没有待发送消息时的轮询间隔
+		pollInterval time.Duration
+		// 发送失败后的重试间隔从 minBackoff 开始指数增长, 不超过 maxBackoff
+		minBackoff time.Duration
+		maxBackoff time.Duration
+		// 最大发布次数, 达到后不再重试; <= 0 时不限次数
+		maxAttempts int
+		// 已发送的消息保留时长, <= 0 时发送后立即删除
+		retention       time.Duration
+		cleanupInterval time.Duration
+		// 多个 Relay 实例时通过锁保证同一时刻只有一个在发布, 否则无法保证同一个 key 的顺序
+		lock dislock.Lock
+	}
+	Option func(o *Options)
+)
+
+func Table(table string) Option {
+	return func(o *Options) {
+		o.table = table
+	}
+}
+
+func WithDialect(dialect Dialect) Option {
+	return func(o *Options) {
+		o.dialect = dialect
+	}
+}
+
+func Batch(n int) Option {
+	return func(o *Options) {
+		o.batch = n
+	}
+}
+
+func PollInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.pollInterval = d
+	}
+}
+
+func Backoff(min, max time.Duration) Option {
+	return func(o *Options) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.maxAttempts = n
+	}
+}
+
+func Retention(d time.Duration) Option {
+	return func(o *Options) {
+		o.retention = d
+	}
+}
+
+func CleanupInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.cleanupInterval = d
+	}
+}
+
+func Lock(lock dislock.Lock) Option {
+	return func(o *Options) {
+		o.lock = lock
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		table:           defaultTable,
+		dialect:         MySQL,
+		batch:           defaultBatch,
+		pollInterval:    defaultPollInterval,
+		minBackoff:      defaultMinBackoff,
+		maxBackoff:      defaultMaxBackoff,
+		maxAttempts:     defaultMaxAttempts,
+		retention:       defaultRetention,
+		cleanupInterval: defaultCleanupInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,124 @@
+package outbox
+
+import (
+	"context"
+	gosql "database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// 事务性发件箱: 业务数据和待发送的消息在同一个数据库事务中写入, 事务提交后由 Relay 读取并发布,
+// 避免数据库提交成功而发布失败(或相反)造成的不一致. 消息至少发布一次, 消费者需要按 Msg.ID 去重.
+// 每条消息一行, 按自增主键顺序发布, sent_at 为发布时间(unix 毫秒), 0 表示未发布,
+// -1 表示达到最大发布次数后放弃, 原因见 last_error; 将 sent_at 和 attempts 置为 0 后会重新发布.
+
+// Execer 执行写入的 *sql.Tx / *sql.DB / *sql.Conn
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (gosql.Result, error)
+}
+
+// CreateTable 创建 outbox 表(已存在时忽略)
+func CreateTable(ctx context.Context, db *gosql.DB, opts ...Option) error {
+	o := newOptions(opts)
+	index := ""
+	if o.dialect.InlineIndex {
+		index = ",\n\tINDEX idx_sent (sent_at, id),\n\tINDEX idx_key (sent_at, msg_key, id)"
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id %s,
+	msg_id VARCHAR(64) NOT NULL,
+	topic VARCHAR(255) NOT NULL,
+	tag VARCHAR(255) NOT NULL DEFAULT '',
+	msg_key VARCHAR(255) NOT NULL DEFAULT '',
+	headers TEXT NOT NULL,
+	body %s NOT NULL,
+	delay_ms BIGINT NOT NULL DEFAULT 0,
+	created_at BIGINT NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	next_at BIGINT NOT NULL DEFAULT 0,
+	last_error VARCHAR(1024) NOT NULL DEFAULT '',
+	sent_at BIGINT NOT NULL DEFAULT 0%s
+)`, o.table, o.dialect.AutoIncrement, o.dialect.BlobType, index))
+	if err != nil || o.dialect.InlineIndex {
+		return err
+	}
+	if _, err = db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS %s_sent ON %s (sent_at, id)", o.table, o.table)); err != nil {
+		return err
+	}
+	// Relay 查询同一个 key 之前是否有退避中的消息
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS %s_key ON %s (sent_at, msg_key, id)", o.table, o.table))
+	return err
+}
+
+type Outbox struct {
+	table string
+}
+
+func NewOutbox(opts ...Option) *Outbox {
+	o := newOptions(opts)
+	return &Outbox{table: o.table}
+}
+
+// Add 在调用方的事务 tx 中写入消息, 事务提交后消息才会被发布, 回滚则不会发布.
+// 消息的 ID 和 Timestamp 在写入时确定, Delay 从写入时开始计算.
+func (o *Outbox) Add(ctx context.Context, tx Execer, msgs ...*mq.Msg) error {
+	query := fmt.Sprintf(
+		"INSERT INTO %s (msg_id, topic, tag, msg_key, headers, body, delay_ms, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		o.table)
+	for _, msg := range msgs {
+		msg.Prepare()
+		headers, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return err
+		}
+		body := msg.Body
+		if body == nil {
+			body = []byte{}
+		}
+		if _, err = tx.ExecContext(ctx, query, msg.ID, msg.Topic, msg.Tag, msg.Key, string(headers), body,
+			msg.Delay.Milliseconds(), msg.Timestamp.UnixMilli()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type row struct {
+	id        int64
+	msgID     string
+	topic     string
+	tag       string
+	key       string
+	headers   string
+	body      []byte
+	delay     int64
+	createdAt int64
+	attempts  int
+	nextAt    int64
+}
+
+// msg 还原写入时的消息, 延迟消息只延迟剩余的时长
+func (r *row) msg(now time.Time) (*mq.Msg, error) {
+	msg := &mq.Msg{
+		ID:        r.msgID,
+		Topic:     r.topic,
+		Tag:       r.tag,
+		Key:       r.key,
+		Body:      r.body,
+		Timestamp: time.UnixMilli(r.createdAt),
+	}
+	if err := json.Unmarshal([]byte(r.headers), &msg.Headers); err != nil {
+		return nil, err
+	}
+	if r.delay > 0 {
+		if d := msg.Timestamp.Add(time.Duration(r.delay) * time.Millisecond).Sub(now); d > 0 {
+			msg.Delay = d
+		}
+	}
+	return msg, nil
+}
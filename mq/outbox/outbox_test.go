@@ -0,0 +1,278 @@
+package outbox
+
+import (
+	"context"
+	gosql "database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/davveo/go-toolkit/mq"
+	"github.com/davveo/go-toolkit/mq/local"
+)
+
+func newTestDB(t *testing.T) *gosql.DB {
+	db, err := gosql.Open("sqlite3", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite 不支持并发写
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	if err = CreateTable(context.Background(), db, WithDialect(SQLite)); err != nil {
+		t.Fatal(err)
+	}
+	// 重复创建被忽略
+	if err = CreateTable(context.Background(), db, WithDialect(SQLite)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func add(t *testing.T, db *gosql.DB, commit bool, msgs ...*mq.Msg) {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = NewOutbox().Add(ctx, tx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+	if commit {
+		err = tx.Commit()
+	} else {
+		err = tx.Rollback()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func count(t *testing.T, db *gosql.DB, where string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM mq_outbox WHERE " + where).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func receive(t *testing.T, ch <-chan *mq.Msg) *mq.Msg {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+		return nil
+	}
+}
+
+func TestRelay(t *testing.T) {
+	db := newTestDB(t)
+	b := local.NewBroker()
+	defer b.Close()
+	ch := make(chan *mq.Msg, 10)
+	if err := b.NewConsumer().Subscribe("orders", "", func(ctx context.Context, msg *mq.Msg) error {
+		ch <- msg
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	first := mq.NewMsg("orders", "created", []byte("1"))
+	first.Key = "order-1"
+	first.SetHeader("trace", "abc")
+	add(t, db, true, first, mq.NewMsg("orders", "paid", []byte("2")))
+	add(t, db, false, mq.NewMsg("orders", "created", []byte("rolled back")))
+	delayed := mq.NewMsg("orders", "created", []byte("delayed"))
+	delayed.Delay = 200 * time.Millisecond
+	add(t, db, true, delayed)
+
+	r := NewRelay(db, b, WithDialect(SQLite), PollInterval(10*time.Millisecond))
+	defer r.Close()
+
+	m := receive(t, ch)
+	if m.ID != first.ID || m.Key != "order-1" || m.Header("trace") != "abc" || string(m.Body) != "1" ||
+		!m.Timestamp.Equal(first.Timestamp.Truncate(time.Millisecond)) {
+		t.Fatalf("got %+v", m)
+	}
+	if m = receive(t, ch); string(m.Body) != "2" {
+		t.Fatalf("got %s", m.Body)
+	}
+	// 入库时 Timestamp 截断到毫秒
+	sent := delayed.Timestamp.Truncate(time.Millisecond)
+	if m = receive(t, ch); string(m.Body) != "delayed" || time.Since(sent) < 200*time.Millisecond {
+		t.Fatalf("got %s after %v", m.Body, time.Since(sent))
+	}
+	select {
+	case m = <-ch:
+		t.Fatalf("unexpected %s", m.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := count(t, db, "sent_at > 0"); n != 3 {
+		t.Fatalf("sent rows = %d", n)
+	}
+}
+
+// flakyProducer 记录发布顺序, 每个 body 在 failures 中的次数决定其前几次发布失败
+type flakyProducer struct {
+	mu       sync.Mutex
+	failures map[string]int
+	sent     []string
+}
+
+func (p *flakyProducer) Send(ctx context.Context, msg *mq.Msg) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	body := string(msg.Body)
+	if p.failures[body] > 0 {
+		p.failures[body]--
+		return "", errors.New("broker unavailable")
+	}
+	p.sent = append(p.sent, body)
+	return msg.ID, nil
+}
+
+func (p *flakyProducer) SendAsync(ctx context.Context, msg *mq.Msg, callback func(id string, err error)) {
+	mq.SendAsync(ctx, p, msg, callback)
+}
+
+func (p *flakyProducer) SendDelay(ctx context.Context, msg *mq.Msg, delay time.Duration) (string, error) {
+	msg.Delay = delay
+	return p.Send(ctx, msg)
+}
+
+func (p *flakyProducer) Close() error {
+	return nil
+}
+
+func (p *flakyProducer) result() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.sent...)
+}
+
+func TestOrderingPerKey(t *testing.T) {
+	db := newTestDB(t)
+	var msgs []*mq.Msg
+	for _, s := range []string{"a1", "b1", "a2", "-1", "b2", "a3"} {
+		m := mq.NewMsg("orders", "", []byte(s))
+		if s[0] != '-' {
+			m.Key = s[:1]
+		}
+		msgs = append(msgs, m)
+	}
+	add(t, db, true, msgs...)
+	p := &flakyProducer{failures: map[string]int{"a1": 2}}
+	r := &Relay{db: db, producer: p, opts: newOptions([]Option{WithDialect(SQLite), Backoff(50*time.Millisecond, time.Second)})}
+	ctx := context.Background()
+
+	// a1 失败后本轮不再发布 key a 的消息
+	if n, err := r.Flush(ctx); err != nil || n != 3 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	if got := fmt.Sprint(p.result()); got != "[b1 -1 b2]" {
+		t.Fatalf("sent %s", got)
+	}
+	var attempts int
+	var lastError string
+	if err := db.QueryRow("SELECT attempts, last_error FROM mq_outbox WHERE msg_id = ?", msgs[0].ID).Scan(&attempts, &lastError); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 || lastError != "broker unavailable" {
+		t.Fatalf("attempts = %d, last_error = %q", attempts, lastError)
+	}
+	// 退避时间内不重试
+	if n, err := r.Flush(ctx); err != nil || n != 0 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	// 第二次仍然失败, 退避时间翻倍
+	if n, err := r.Flush(ctx); err != nil || n != 0 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	time.Sleep(110 * time.Millisecond)
+	if n, err := r.Flush(ctx); err != nil || n != 3 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	if got := fmt.Sprint(p.result()); got != "[b1 -1 b2 a1 a2 a3]" {
+		t.Fatalf("sent %s", got)
+	}
+	if n := count(t, db, "sent_at = 0"); n != 0 {
+		t.Fatalf("pending rows = %d", n)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	db := newTestDB(t)
+	p := &flakyProducer{}
+	add(t, db, true, mq.NewMsg("orders", "", []byte("1")))
+	// 不保留时发布后立即删除
+	r := &Relay{db: db, producer: p, opts: newOptions([]Option{WithDialect(SQLite), Retention(0)})}
+	if n, err := r.Flush(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	if n := count(t, db, "1 = 1"); n != 0 {
+		t.Fatalf("rows = %d", n)
+	}
+
+	add(t, db, true, mq.NewMsg("orders", "", []byte("2")))
+	r2 := NewRelay(db, p, WithDialect(SQLite), PollInterval(10*time.Millisecond),
+		Retention(time.Millisecond), CleanupInterval(20*time.Millisecond))
+	defer r2.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for count(t, db, "1 = 1") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("sent rows not cleaned up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := fmt.Sprint(p.result()); got != "[1 2]" {
+		t.Fatalf("sent %s", got)
+	}
+}
+
+func TestPoisonRow(t *testing.T) {
+	db := newTestDB(t)
+	var msgs []*mq.Msg
+	for _, s := range []string{"a1", "a2", "a3", "b1"} {
+		m := mq.NewMsg("orders", "", []byte(s))
+		m.Key = s[:1]
+		msgs = append(msgs, m)
+	}
+	add(t, db, true, msgs...)
+	p := &flakyProducer{failures: map[string]int{"a1": 100}}
+	r := &Relay{db: db, producer: p, opts: newOptions([]Option{WithDialect(SQLite), Batch(2),
+		Backoff(50*time.Millisecond, time.Second), MaxAttempts(2)})}
+	ctx := context.Background()
+
+	if n, err := r.Flush(ctx); err != nil || n != 0 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	// 退避中的 a1 和其后的 a2、a3 不占用批次
+	if n, err := r.Flush(ctx); err != nil || n != 1 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	// 第二次失败后放弃 a1, 下一轮不再阻塞 key a
+	if n, err := r.Flush(ctx); err != nil || n != 0 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	if n, err := r.Flush(ctx); err != nil || n != 2 {
+		t.Fatalf("Flush = %d, %v", n, err)
+	}
+	if got := fmt.Sprint(p.result()); got != "[b1 a2 a3]" {
+		t.Fatalf("sent %s", got)
+	}
+	var attempts int
+	if err := db.QueryRow("SELECT attempts FROM mq_outbox WHERE sent_at = -1 AND msg_id = ?", msgs[0].ID).Scan(&attempts); err != nil || attempts != 2 {
+		t.Fatalf("attempts = %d, %v", attempts, err)
+	}
+}
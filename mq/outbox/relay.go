@@ -0,0 +1,251 @@
+package outbox
+
+import (
+	"context"
+	gosql "database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davveo/go-toolkit/dislock"
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const maxErrorLen = 1024
+
+// 达到最大发布次数后 sent_at 的值
+const failed = -1
+
+// Relay 轮询 outbox 表, 按写入顺序通过 producer 发布未发送的消息.
+// 发布失败的消息按退避时间重试, 重试前同一个 key 后续的消息不会发布, 保证同一个 key 的顺序;
+// 达到最大发布次数后标记为发布失败(sent_at = -1), 不再阻塞同一个 key 后续的消息.
+type Relay struct {
+	db       *gosql.DB
+	producer mq.Producer
+	opts     *Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRelay 启动发布和清理的后台任务, Close 时停止; Close 不关闭 db 和 producer
+func NewRelay(db *gosql.DB, producer mq.Producer, opts ...Option) *Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Relay{
+		db:       db,
+		producer: producer,
+		opts:     newOptions(opts),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	r.wg.Add(2)
+	go r.run()
+	go r.cleanup()
+	return r
+}
+
+func (r *Relay) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
+
+func (r *Relay) run() {
+	defer r.wg.Done()
+	for {
+		n, err := r.Flush(r.ctx)
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			warn("outbox: relay failed", err, logger.KV("table", r.opts.table))
+		}
+		// 本轮有消息发出时可能还有积压, 立即进行下一轮
+		if n > 0 && err == nil {
+			continue
+		}
+		if !sleep(r.ctx, r.opts.pollInterval) {
+			return
+		}
+	}
+}
+
+// Flush 发布一批到期的未发送消息, 返回发布成功的消息数.
+// 设置了 Lock 时只有获得锁的实例会发布, 未获得锁时返回 0.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	var lost <-chan struct{}
+	if r.opts.lock != nil {
+		h, err := r.opts.lock.TryLock(ctx, "mq-outbox:"+r.opts.table, 0)
+		if errors.Is(err, dislock.ErrNotObtained) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			_ = h.UnLock(context.Background())
+		}()
+		lost = h.Lost()
+	}
+
+	now := time.Now()
+	rows, err := r.pending(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	// 本轮不再发布的 key
+	blocked := make(map[string]bool)
+	var sent []int64
+	for _, row := range rows {
+		select {
+		case <-lost:
+			// 锁已被其他实例获得, 继续发布会打乱顺序
+			return len(sent), r.markSent(sent)
+		default:
+		}
+		if blocked[row.key] {
+			continue
+		}
+		if err = r.publish(ctx, row, now); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			r.block(blocked, row.key)
+			r.fail(row, err)
+			continue
+		}
+		sent = append(sent, row.id)
+	}
+	return len(sent), r.markSent(sent)
+}
+
+// block 没有 key 的消息之间没有顺序要求, 不阻塞其他消息
+func (r *Relay) block(blocked map[string]bool, key string) {
+	if key != "" {
+		blocked[key] = true
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, row *row, now time.Time) error {
+	msg, err := row.msg(now)
+	if err != nil {
+		return err
+	}
+	_, err = r.producer.Send(ctx, msg)
+	return err
+}
+
+// pending 读取到期的未发送消息: 退避中的消息和同一个 key 在其之后的消息都不读取,
+// 避免它们占满一批, 使其他消息无法发布
+func (r *Relay) pending(ctx context.Context, now time.Time) ([]*row, error) {
+	rs, err := r.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, msg_id, topic, tag, msg_key, headers, body, delay_ms, created_at, attempts, next_at FROM %s o
+WHERE sent_at = 0 AND next_at <= ? AND (msg_key = '' OR NOT EXISTS (
+	SELECT 1 FROM %s p WHERE p.sent_at = 0 AND p.msg_key = o.msg_key AND p.id < o.id AND p.next_at > ?))
+ORDER BY id LIMIT ?`,
+		r.opts.table, r.opts.table), now.UnixMilli(), now.UnixMilli(), r.opts.batch)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	var rows []*row
+	for rs.Next() {
+		row := &row{}
+		if err = rs.Scan(&row.id, &row.msgID, &row.topic, &row.tag, &row.key, &row.headers, &row.body,
+			&row.delay, &row.createdAt, &row.attempts, &row.nextAt); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, rs.Err()
+}
+
+// markSent 消息已经发出, 不受 ctx 取消的影响, 否则会重复发布
+func (r *Relay) markSent(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(ids)+1)
+	var query string
+	if r.opts.retention > 0 {
+		query = fmt.Sprintf("UPDATE %s SET sent_at = ? WHERE id IN (%s)", r.opts.table, placeholders(len(ids)))
+		args = append(args, time.Now().UnixMilli())
+	} else {
+		query = fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", r.opts.table, placeholders(len(ids)))
+	}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	_, err := r.db.ExecContext(context.Background(), query, args...)
+	return err
+}
+
+// fail 记录发布失败, 达到最大发布次数时标记为发布失败
+func (r *Relay) fail(row *row, err error) {
+	msg := err.Error()
+	if len(msg) > maxErrorLen {
+		msg = msg[:maxErrorLen]
+	}
+	attempts := row.attempts + 1
+	nextAt, sentAt, text := time.Now().Add(r.backoff(attempts)).UnixMilli(), int64(0), "outbox: publish failed"
+	if r.opts.maxAttempts > 0 && attempts >= r.opts.maxAttempts {
+		nextAt, sentAt, text = 0, failed, "outbox: publish failed, giving up"
+	}
+	if _, uerr := r.db.ExecContext(context.Background(), fmt.Sprintf(
+		"UPDATE %s SET attempts = attempts + 1, next_at = ?, last_error = ?, sent_at = ? WHERE id = ?", r.opts.table),
+		nextAt, msg, sentAt, row.id); uerr != nil {
+		warn("outbox: record failure failed", uerr, logger.KV("table", r.opts.table), logger.KV("id", row.msgID))
+	}
+	warn(text, err, logger.KV("table", r.opts.table), logger.KV("id", row.msgID), logger.KV("attempts", attempts))
+}
+
+// cleanup 定期删除超过保留时长的已发送消息
+func (r *Relay) cleanup() {
+	defer r.wg.Done()
+	if r.opts.retention <= 0 {
+		return
+	}
+	for sleep(r.ctx, r.opts.cleanupInterval) {
+		before := time.Now().Add(-r.opts.retention).UnixMilli()
+		if _, err := r.db.ExecContext(r.ctx, fmt.Sprintf(
+			"DELETE FROM %s WHERE sent_at > 0 AND sent_at < ?", r.opts.table), before); err != nil && r.ctx.Err() == nil {
+			warn("outbox: cleanup failed", err, logger.KV("table", r.opts.table))
+		}
+	}
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.opts.minBackoff
+	for i := 1; i < attempts && d < r.opts.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.opts.maxBackoff {
+		d = r.opts.maxBackoff
+	}
+	return d
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func warn(msg string, err error, kvs ...logger.Entry) {
+	if logger.IsInitialized() {
+		logger.WarnErr(msg, err, kvs...)
+	}
+}
@@ -0,0 +1,147 @@
+package rabbitmq
+
+import (
+	"errors"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+type subscription struct {
+	r        *RabbitMQ
+	topic    string
+	filter   string
+	handler  mq.Handler
+	queue    string
+	topology Topology
+}
+
+// Subscribe 声明消费组队列并按 tag 绑定到 topic exchange, tag 中的 "." "*" "#" 按 topic exchange 的规则匹配.
+// 修改 tag 过滤表达式后旧的绑定不会删除, 多收到的消息在客户端按过滤表达式忽略.
+func (r *RabbitMQ) Subscribe(topic, tag string, handler mq.Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return mq.ErrClosed
+	}
+	q := groupQueue(topic, r.opts.group)
+	s := &subscription{
+		r:       r,
+		topic:   topic,
+		filter:  tag,
+		handler: handler,
+		queue:   q.Name,
+		topology: Topology{
+			Exchanges: []Exchange{topicExchange(topic)},
+			Queues:    []Queue{q},
+			Bindings:  groupBindings(q.Name, topic, tag),
+		},
+	}
+	r.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// run 连接断开或 channel 异常关闭后重新建立 channel 并继续消费
+func (s *subscription) run() {
+	defer s.r.wg.Done()
+	ctx := s.r.ctx
+	for {
+		err := s.consume()
+		if ctx.Err() != nil {
+			return
+		}
+		warn("rabbitmq: consumer disconnected", err, logger.KV("queue", s.queue))
+		if !sleep(ctx, s.r.opts.reconnect) {
+			return
+		}
+	}
+}
+
+func (s *subscription) consume() error {
+	ch, err := s.r.channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	if err = ch.Qos(s.r.opts.prefetch, 0, false); err != nil {
+		return err
+	}
+	if err = s.topology.Declare(ch); err != nil {
+		return err
+	}
+	deliveries, err := ch.Consume(s.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-s.r.ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				if err := <-closed; err != nil {
+					return err
+				}
+				return amqp.ErrClosed
+			}
+			s.handle(&d)
+		}
+	}
+}
+
+// handle 处理成功、被忽略、转入重试队列或死信 topic 后确认消息, 转发失败时退回队列
+func (s *subscription) handle(d *amqp.Delivery) {
+	msg := fromDelivery(s.topic, d)
+	msg.Attempts++
+	if mq.MatchTag(s.filter, msg.Tag) {
+		if err := s.handler(s.r.ctx, msg); err != nil {
+			if delay, ok := s.r.opts.retry.Next(msg.Attempts); errors.Is(err, mq.ErrReject) || !ok {
+				err = s.r.deadLetter(msg, err)
+			} else {
+				err = s.retry(msg, delay)
+			}
+			if err != nil {
+				warn("rabbitmq: requeue failed message", err, logger.KV("queue", s.queue))
+				if err = d.Nack(false, true); err != nil {
+					warn("rabbitmq: nack failed", err, logger.KV("queue", s.queue))
+				}
+				return
+			}
+		}
+	}
+	if err := d.Ack(false); err != nil {
+		warn("rabbitmq: ack failed", err, logger.KV("queue", s.queue))
+	}
+}
+
+// retry 写入当前消费组的重试队列, 到期后回到消费组队列, 不影响其他消费组
+func (s *subscription) retry(msg *mq.Msg, delay time.Duration) error {
+	q := retryQueue(s.queue, round(milliseconds(delay)))
+	p := toPublishing(msg)
+	p.Headers[headerAttempts] = int64(msg.Attempts)
+	return s.r.publish(s.r.ctx, Topology{Queues: []Queue{q}}, "", q.Name, p)
+}
+
+func (r *RabbitMQ) deadLetter(msg *mq.Msg, err error) error {
+	dl := msg.Clone()
+	dl.Topic = mq.DeadLetterTopic(r.opts.group)
+	dl.Delay = 0
+	dl.Attempts = 0
+	dl.SetHeader(mq.HeaderOriginTopic, msg.Topic)
+	dl.SetHeader(mq.HeaderError, err.Error())
+	return r.publish(r.ctx, deadLetterTopology(dl.Topic), dl.Topic, dl.Tag, toPublishing(dl))
+}
+
+// round 保留两位有效数字, 限制重试队列的数量
+func round(ms int64) int64 {
+	unit := int64(1)
+	for ms/unit >= 100 {
+		unit *= 10
+	}
+	return ms / unit * unit
+}
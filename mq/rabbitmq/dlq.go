@@ -0,0 +1,102 @@
+package rabbitmq
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// 死信保存在队列 DLQ-group 中. 读取时不确认, 关闭 channel 后未确认的消息回到队列,
+// 因此 List/Replay/Purge 期间读取的消息暂时对其他消费者不可见, 且顺序可能改变.
+
+var _ mq.DeadLetterQueue = (*RabbitMQ)(nil)
+
+func (r *RabbitMQ) List(ctx context.Context, group string, limit int) ([]*mq.Msg, error) {
+	var msgs []*mq.Msg
+	err := r.scan(ctx, group, func(msg *mq.Msg) (bool, bool, error) {
+		msgs = append(msgs, msg)
+		return false, limit <= 0 || len(msgs) < limit, nil
+	})
+	return msgs, err
+}
+
+func (r *RabbitMQ) Replay(ctx context.Context, group string, ids ...string) (int, error) {
+	return r.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		_, err := r.Send(ctx, mq.Revive(msg))
+		return err
+	})
+}
+
+func (r *RabbitMQ) Purge(ctx context.Context, group string, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		ch, err := r.deadLetterChannel(group)
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close()
+		return ch.QueuePurge(mq.DeadLetterTopic(group), false)
+	}
+	return r.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		return nil
+	})
+}
+
+// drain 匹配 ids 的消息交给 fn 处理成功后确认, 其余的在结束后回到队列
+func (r *RabbitMQ) drain(ctx context.Context, group string, ids []string, fn func(msg *mq.Msg) error) (int, error) {
+	set := mq.NewIDSet(ids)
+	n := 0
+	err := r.scan(ctx, group, func(msg *mq.Msg) (bool, bool, error) {
+		if !set.Match(msg.ID) {
+			return false, true, nil
+		}
+		if err := fn(msg); err != nil {
+			return false, false, err
+		}
+		n++
+		return true, true, nil
+	})
+	return n, err
+}
+
+// scan 逐条读取死信队列直到为空, fn 返回是否确认该消息以及是否继续读取
+func (r *RabbitMQ) scan(ctx context.Context, group string, fn func(msg *mq.Msg) (ack, more bool, err error)) error {
+	ch, err := r.deadLetterChannel(group)
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	queue := mq.DeadLetterTopic(group)
+	for ctx.Err() == nil {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil || !ok {
+			return err
+		}
+		ack, more, err := fn(fromDelivery(queue, &d))
+		if err != nil {
+			return err
+		}
+		if ack {
+			if err = d.Ack(false); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+func (r *RabbitMQ) deadLetterChannel(group string) (*amqp.Channel, error) {
+	ch, err := r.channel()
+	if err != nil {
+		return nil, err
+	}
+	if err = deadLetterTopology(mq.DeadLetterTopic(group)).Declare(ch); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	return ch, nil
+}
@@ -1 +1,340 @@
 package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// ErrNacked broker 未确认发布的消息
+var ErrNacked = errors.New("rabbitmq: message nacked by broker")
+
+// 框架使用的 header
+const (
+	headerKey = "x-mq-key"
+	// 消息已投递的次数, 重试时写入
+	headerAttempts = "x-mq-attempts"
+	// 延迟时长(毫秒), 用于 headers exchange 路由到延迟队列
+	headerDelay = "mq-delay"
+)
+
+// RabbitMQ 基于 AMQP 0-9-1 的 mq.MQ 实现, 拓扑见 topology.go.
+// 发布使用 publisher confirms, 收到 broker 确认后 Send 才返回;
+// 连接断开后, 发布在下一次调用时重连, 订阅在 ReconnectInterval 后重连并重新声明拓扑.
+type RabbitMQ struct {
+	opts *Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	conn   *amqp.Connection
+	// 发布用的 channel, 处于 confirm 模式
+	pub *amqp.Channel
+	// 当前连接上已声明的 exchange/queue, 重连后清空
+	declared map[string]bool
+}
+
+var _ mq.MQ = (*RabbitMQ)(nil)
+
+// NewRabbitMQ 建立连接并声明 Declare 指定的拓扑
+func NewRabbitMQ(opts ...Option) (*RabbitMQ, error) {
+	o := &Options{
+		url:         defaultURL,
+		group:       defaultGroup,
+		prefetch:    defaultPrefetch,
+		maxAttempts: defaultMaxAttempts,
+		minBackoff:  defaultMinBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		reconnect:   defaultReconnect,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.retry == nil {
+		o.retry = mq.ExponentialRetry(o.minBackoff, o.maxBackoff, 0, o.maxAttempts)
+	}
+	r := &RabbitMQ{opts: o}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.mu.Lock()
+	_, err := r.connect()
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// connect 返回当前连接, 连接已断开时重连; 调用方持有 r.mu
+func (r *RabbitMQ) connect() (*amqp.Connection, error) {
+	if r.closed {
+		return nil, mq.ErrClosed
+	}
+	if r.conn != nil && !r.conn.IsClosed() {
+		return r.conn, nil
+	}
+	conn, err := amqp.DialConfig(r.opts.url, r.opts.config)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err == nil {
+		err = r.opts.topology.Declare(ch)
+		_ = ch.Close()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	r.conn = conn
+	r.pub = nil
+	r.declared = make(map[string]bool)
+	return conn, nil
+}
+
+// channel 在当前连接上打开新的 channel
+func (r *RabbitMQ) channel() (*amqp.Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, err := r.connect()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Channel()
+}
+
+// publisher 返回发布用的 channel; 调用方持有 r.mu
+func (r *RabbitMQ) publisher() (*amqp.Channel, error) {
+	if _, err := r.connect(); err != nil {
+		return nil, err
+	}
+	if r.pub != nil && !r.pub.IsClosed() {
+		return r.pub, nil
+	}
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err = ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	r.pub = ch
+	return ch, nil
+}
+
+// publish 声明 topology 后发布并等待 broker 确认; channel 或连接已关闭时重连后再试一次
+func (r *RabbitMQ) publish(ctx context.Context, topology Topology, exchange, key string, p amqp.Publishing) error {
+	for retried := false; ; retried = true {
+		confirm, err := r.publishDeferred(ctx, topology, exchange, key, p)
+		if err != nil {
+			if !retried && errors.Is(err, amqp.ErrClosed) {
+				continue
+			}
+			return err
+		}
+		ok, err := confirm.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNacked
+		}
+		return nil
+	}
+}
+
+func (r *RabbitMQ) publishDeferred(ctx context.Context, topology Topology, exchange, key string, p amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch, err := r.publisher()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.declare(ch, topology); err != nil {
+		return nil, err
+	}
+	return ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, p)
+}
+
+// declare 声明当前连接上尚未声明的部分; 调用方持有 r.mu
+func (r *RabbitMQ) declare(ch *amqp.Channel, t Topology) error {
+	var todo Topology
+	for _, e := range t.Exchanges {
+		if !r.declared["exchange:"+e.Name] {
+			todo.Exchanges = append(todo.Exchanges, e)
+		}
+	}
+	for _, q := range t.Queues {
+		if !r.declared["queue:"+q.Name] {
+			todo.Queues = append(todo.Queues, q)
+		}
+	}
+	for _, b := range t.Bindings {
+		if !r.declared["binding:"+b.Queue+":"+b.Exchange+":"+b.Key] {
+			todo.Bindings = append(todo.Bindings, b)
+		}
+	}
+	if err := todo.Declare(ch); err != nil {
+		return err
+	}
+	for _, e := range todo.Exchanges {
+		r.declared["exchange:"+e.Name] = true
+	}
+	for _, q := range todo.Queues {
+		r.declared["queue:"+q.Name] = true
+	}
+	for _, b := range todo.Bindings {
+		r.declared["binding:"+b.Queue+":"+b.Exchange+":"+b.Key] = true
+	}
+	return nil
+}
+
+func (r *RabbitMQ) Send(ctx context.Context, msg *mq.Msg) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	msg.Prepare()
+	p := toPublishing(msg)
+	var err error
+	if msg.Delay > 0 {
+		ms := milliseconds(msg.Delay)
+		p.Headers[headerDelay] = strconv.FormatInt(ms, 10)
+		err = r.publish(ctx, delayTopology(msg.Topic, ms), msg.Topic+".delay", msg.Tag, p)
+	} else {
+		err = r.publish(ctx, Topology{Exchanges: []Exchange{topicExchange(msg.Topic)}}, msg.Topic, msg.Tag, p)
+	}
+	if err != nil {
+		return "", err
+	}
+	return msg.ID, nil
+}
+
+func (r *RabbitMQ) SendAsync(ctx context.Context, msg *mq.Msg, callback func(id string, err error)) {
+	mq.SendAsync(ctx, r, msg, callback)
+}
+
+// SendDelay 每个不同的 delay 对应一个延迟队列, 应使用少量固定的延迟时长
+func (r *RabbitMQ) SendDelay(ctx context.Context, msg *mq.Msg, delay time.Duration) (string, error) {
+	msg.Delay = delay
+	return r.Send(ctx, msg)
+}
+
+// Close 停止消费并等待处理中的消息完成, 然后关闭连接
+func (r *RabbitMQ) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+	r.cancel()
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil && !r.conn.IsClosed() {
+		return r.conn.Close()
+	}
+	return nil
+}
+
+func toPublishing(msg *mq.Msg) amqp.Publishing {
+	headers := make(amqp.Table, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	if msg.Key != "" {
+		headers[headerKey] = msg.Key
+	}
+	return amqp.Publishing{
+		Headers:      headers,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.ID,
+		Timestamp:    msg.Timestamp,
+		// 重试和延迟投递会改变 routing key, tag 另存在 type 属性中
+		Type: msg.Tag,
+		Body: msg.Body,
+	}
+}
+
+// fromDelivery AMQP 的 timestamp 只精确到秒
+func fromDelivery(topic string, d *amqp.Delivery) *mq.Msg {
+	msg := &mq.Msg{
+		ID:        d.MessageId,
+		Topic:     topic,
+		Tag:       d.Type,
+		Body:      d.Body,
+		Timestamp: d.Timestamp,
+	}
+	for k, v := range d.Headers {
+		switch {
+		case k == headerKey:
+			msg.Key = fmt.Sprint(v)
+		case k == headerAttempts:
+			msg.Attempts = toInt(v)
+		case k == headerDelay, strings.HasPrefix(k, "x-death"),
+			strings.HasPrefix(k, "x-first-death-"), strings.HasPrefix(k, "x-last-death-"):
+			// broker 死信时添加的头
+		default:
+			msg.SetHeader(k, fmt.Sprint(v))
+		}
+	}
+	return msg
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int8:
+		return int(n)
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+func milliseconds(d time.Duration) int64 {
+	ms := int64(d / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return ms
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func warn(msg string, err error, kvs ...logger.Entry) {
+	if logger.IsInitialized() {
+		logger.WarnErr(msg, err, kvs...)
+	}
+}
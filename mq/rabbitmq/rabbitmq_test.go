@@ -0,0 +1,228 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+func TestPublishingRoundTrip(t *testing.T) {
+	msg := mq.NewMsg("orders", "created", []byte("hello"))
+	msg.Key = "order-1"
+	msg.SetHeader("trace", "abc")
+	msg.Prepare()
+
+	p := toPublishing(msg)
+	p.Headers[headerAttempts] = int64(3)
+	p.Headers[headerDelay] = "1000"
+	p.Headers["x-death"] = []interface{}{amqp.Table{"count": int64(1)}}
+	got := fromDelivery("orders", &amqp.Delivery{
+		Headers:   p.Headers,
+		MessageId: p.MessageId,
+		Timestamp: p.Timestamp,
+		Type:      p.Type,
+		Body:      p.Body,
+	})
+	if got.ID != msg.ID || got.Tag != "created" || got.Key != "order-1" || string(got.Body) != "hello" ||
+		got.Attempts != 3 || got.Header("trace") != "abc" || len(got.Headers) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if p.DeliveryMode != amqp.Persistent {
+		t.Fatalf("delivery mode = %d", p.DeliveryMode)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	keys := func(bs []Binding) string {
+		var s []string
+		for _, b := range bs {
+			s = append(s, b.Key)
+		}
+		return fmt.Sprint(s)
+	}
+	if k := keys(groupBindings("orders.g", "orders", "")); k != "[#]" {
+		t.Fatalf("bindings = %s", k)
+	}
+	if k := keys(groupBindings("orders.g", "orders", "a || b")); k != "[a b]" {
+		t.Fatalf("bindings = %s", k)
+	}
+
+	d := delayTopology("orders", 1500)
+	q := d.Queues[0]
+	if q.Name != "orders.delay.1500" || q.Args["x-message-ttl"] != int64(1500) || q.Args["x-dead-letter-exchange"] != "orders" {
+		t.Fatalf("delay queue = %+v", q)
+	}
+	if _, ok := q.Args["x-dead-letter-routing-key"]; ok {
+		t.Fatal("delay queue must keep the original routing key")
+	}
+	if b := d.Bindings[0]; b.Exchange != "orders.delay" || b.Args[headerDelay] != "1500" {
+		t.Fatalf("delay binding = %+v", b)
+	}
+
+	r := retryQueue("orders.g", 200)
+	if r.Name != "orders.g.retry.200" || r.Args["x-dead-letter-routing-key"] != "orders.g" || r.Args["x-dead-letter-exchange"] != "" {
+		t.Fatalf("retry queue = %+v", r)
+	}
+	for _, table := range []amqp.Table{q.Args, d.Bindings[0].Args, r.Args} {
+		if err := table.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for ms, want := range map[int64]int64{1: 1, 99: 99, 100: 100, 1234: 1200, 60000: 60000, 61999: 61000} {
+		if got := round(ms); got != want {
+			t.Fatalf("round(%d) = %d, want %d", ms, got, want)
+		}
+	}
+}
+
+// newTestRabbitMQ 连接 RABBITMQ_URL 指定的 broker, 未设置时跳过
+func newTestRabbitMQ(t *testing.T, opts ...Option) *RabbitMQ {
+	url := os.Getenv("RABBITMQ_URL")
+	if url == "" {
+		t.Skip("RABBITMQ_URL not set")
+	}
+	opts = append([]Option{URL(url), Backoff(50*time.Millisecond, 50*time.Millisecond)}, opts...)
+	r, err := NewRabbitMQ(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+func receive(t *testing.T, ch <-chan *mq.Msg) *mq.Msg {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+		return nil
+	}
+}
+
+func TestSendSubscribe(t *testing.T) {
+	ctx := context.Background()
+	group := "g-" + uuid.New().String()
+	r := newTestRabbitMQ(t, Group(group), MaxAttempts(2))
+	topic := "mq-test-" + uuid.New().String()
+	ch := make(chan *mq.Msg, 8)
+	if err := r.Subscribe(topic, "a||b", func(ctx context.Context, m *mq.Msg) error {
+		ch <- m
+		switch string(m.Body) {
+		case "flaky":
+			if m.Attempts < 2 {
+				return errors.New("busy")
+			}
+		case "bad":
+			return mq.Reject(errors.New("malformed"))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	dead := make(chan *mq.Msg, 1)
+	if err := r.Subscribe(mq.DeadLetterTopic(group), "", func(ctx context.Context, m *mq.Msg) error {
+		dead <- m
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// 等待队列声明和绑定完成
+	time.Sleep(500 * time.Millisecond)
+
+	for _, m := range []*mq.Msg{
+		mq.NewMsg(topic, "c", []byte("skipped")),
+		mq.NewMsg(topic, "a", []byte("ok")),
+	} {
+		if _, err := r.Send(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m := receive(t, ch); string(m.Body) != "ok" || m.Attempts != 1 {
+		t.Fatalf("got %s attempts %d", m.Body, m.Attempts)
+	}
+
+	if _, err := r.Send(ctx, mq.NewMsg(topic, "b", []byte("flaky"))); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ch)
+	if m := receive(t, ch); string(m.Body) != "flaky" || m.Attempts != 2 || m.Tag != "b" {
+		t.Fatalf("retried %s attempts %d tag %s", m.Body, m.Attempts, m.Tag)
+	}
+
+	if _, err := r.Send(ctx, mq.NewMsg(topic, "a", []byte("bad"))); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ch)
+	if d := receive(t, dead); string(d.Body) != "bad" || d.Header(mq.HeaderOriginTopic) != topic {
+		t.Fatalf("dead letter %+v", d)
+	}
+
+	start := time.Now()
+	if _, err := r.SendDelay(ctx, mq.NewMsg(topic, "a", []byte("delayed")), 300*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if m := receive(t, ch); string(m.Body) != "delayed" || time.Since(start) < 300*time.Millisecond {
+		t.Fatalf("got %s after %v", m.Body, time.Since(start))
+	}
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+	group := "g-" + uuid.New().String()
+	r := newTestRabbitMQ(t, Group(group))
+	topic := "mq-test-" + uuid.New().String()
+	healthy := make(chan bool, 1)
+	received := make(chan *mq.Msg, 1)
+	if err := r.Subscribe(topic, "", func(ctx context.Context, m *mq.Msg) error {
+		select {
+		case <-healthy:
+			received <- m
+			return nil
+		default:
+			return mq.Reject(errors.New("down"))
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		id, err := r.Send(ctx, mq.NewMsg(topic, "", []byte{byte('a' + i)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	var dead []*mq.Msg
+	for deadline := time.Now().Add(5 * time.Second); len(dead) < 2; time.Sleep(100 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letters = %d", len(dead))
+		}
+		dead, _ = r.List(ctx, group, 0)
+	}
+	if n, err := r.Purge(ctx, group, ids[0]); err != nil || n != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	healthy <- true
+	if n, err := r.Replay(ctx, group, ids[1]); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	if m := receive(t, received); m.ID != ids[1] || m.Header(mq.HeaderOriginTopic) != "" {
+		t.Fatalf("replayed = %+v", m)
+	}
+	if msgs, err := r.List(ctx, group, 0); err != nil || len(msgs) != 0 {
+		t.Fatalf("remaining = %d, %v", len(msgs), err)
+	}
+}
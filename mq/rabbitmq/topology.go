@@ -0,0 +1,138 @@
+package rabbitmq
+
+import (
+	"strconv"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type (
+	Exchange struct {
+		Name string
+		// amqp.ExchangeDirect/ExchangeFanout/ExchangeTopic/ExchangeHeaders
+		Kind       string
+		Durable    bool
+		AutoDelete bool
+		Internal   bool
+		Args       amqp.Table
+	}
+
+	Queue struct {
+		Name       string
+		Durable    bool
+		AutoDelete bool
+		Exclusive  bool
+		Args       amqp.Table
+	}
+
+	Binding struct {
+		Queue    string
+		Exchange string
+		Key      string
+		Args     amqp.Table
+	}
+
+	// Topology 按 Exchanges, Queues, Bindings 的顺序声明
+	Topology struct {
+		Exchanges []Exchange
+		Queues    []Queue
+		Bindings  []Binding
+	}
+)
+
+func (t Topology) Declare(ch *amqp.Channel) error {
+	for _, e := range t.Exchanges {
+		if err := ch.ExchangeDeclare(e.Name, e.Kind, e.Durable, e.AutoDelete, e.Internal, false, e.Args); err != nil {
+			return err
+		}
+	}
+	for _, q := range t.Queues {
+		if _, err := ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.Args); err != nil {
+			return err
+		}
+	}
+	for _, b := range t.Bindings {
+		if err := ch.QueueBind(b.Queue, b.Key, b.Exchange, false, b.Args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 内置拓扑:
+//
+//	topic                      topic exchange, 消息以 tag 为 routing key 发布到这里
+//	topic.group                消费组的队列, 按 tag 过滤表达式绑定到 topic
+//	topic.delay                headers exchange, 延迟消息按 headerDelay 路由到对应时长的延迟队列
+//	topic.delay.<ms>           消息 TTL 为 ms 的延迟队列, 过期后以原 routing key 死信到 topic
+//	topic.group.retry.<ms>     消息 TTL 为 ms 的重试队列, 过期后死信回 topic.group
+//	DLQ-group                  死信 topic 的 exchange, 以及绑定在其上保存全部死信的同名队列
+
+func topicExchange(topic string) Exchange {
+	return Exchange{Name: topic, Kind: amqp.ExchangeTopic, Durable: true}
+}
+
+func groupQueue(topic, group string) Queue {
+	return Queue{Name: topic + "." + group, Durable: true}
+}
+
+// groupBindings tag 过滤表达式对应的 routing key, 多个 tag 分别绑定
+func groupBindings(queue, topic, filter string) []Binding {
+	filter = strings.TrimSpace(filter)
+	if filter == "" || filter == "*" {
+		return []Binding{{Queue: queue, Exchange: topic, Key: "#"}}
+	}
+	var bindings []Binding
+	for _, tag := range strings.Split(filter, "||") {
+		bindings = append(bindings, Binding{Queue: queue, Exchange: topic, Key: strings.TrimSpace(tag)})
+	}
+	return bindings
+}
+
+func delayExchange(topic string) Exchange {
+	return Exchange{Name: topic + ".delay", Kind: amqp.ExchangeHeaders, Durable: true}
+}
+
+func delayTopology(topic string, ms int64) Topology {
+	delay := strconv.FormatInt(ms, 10)
+	queue := topic + ".delay." + delay
+	return Topology{
+		Exchanges: []Exchange{topicExchange(topic), delayExchange(topic)},
+		Queues: []Queue{{
+			Name:    queue,
+			Durable: true,
+			Args: amqp.Table{
+				"x-message-ttl":          ms,
+				"x-dead-letter-exchange": topic,
+			},
+		}},
+		Bindings: []Binding{{
+			Queue:    queue,
+			Exchange: topic + ".delay",
+			// headers exchange 匹配时忽略 x- 开头的头, headerDelay 不能以 x- 开头
+			Args: amqp.Table{"x-match": "all", headerDelay: delay},
+		}},
+	}
+}
+
+func retryQueue(queue string, ms int64) Queue {
+	return Queue{
+		Name:    queue + ".retry." + strconv.FormatInt(ms, 10),
+		Durable: true,
+		Args: amqp.Table{
+			"x-message-ttl":             ms,
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		},
+	}
+}
+
+// deadLetterTopology 死信保存在与 exchange 同名的队列中, 没有订阅者时也不会丢失
+func deadLetterTopology(topic string) Topology {
+	return Topology{
+		Exchanges: []Exchange{topicExchange(topic)},
+		Queues:    []Queue{{Name: topic, Durable: true}},
+		Bindings:  []Binding{{Queue: topic, Exchange: topic, Key: "#"}},
+	}
+}
@@ -0,0 +1,266 @@
+package redis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+// retryConsumer 处理失败等待重试的消息在 pending 列表中的所属消费者
+const retryConsumer = "mq-retry"
+
+type subscription struct {
+	r       *Redis
+	topic   string
+	stream  string
+	filter  string
+	handler mq.Handler
+}
+
+// Subscribe 以 Group 指定的消费组订阅 topic, 消费组不存在时创建,
+// 新创建的消费组只接收创建之后发送的消息
+func (r *Redis) Subscribe(topic, tag string, handler mq.Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return mq.ErrClosed
+	}
+	s := &subscription{r: r, topic: topic, stream: r.stream(topic), filter: tag, handler: handler}
+	if err := s.createGroup(); err != nil {
+		return err
+	}
+	r.wg.Add(4)
+	go s.read()
+	go s.claim()
+	go s.retry()
+	go s.move()
+	return nil
+}
+
+func (s *subscription) createGroup() error {
+	err := s.r.client.ProcessContext(s.r.ctx,
+		goredis.NewStatusCmd("xgroup", "create", s.stream, s.r.opts.group, "$", "mkstream"))
+	if isRedisError(err, "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// read 读取新消息
+func (s *subscription) read() {
+	defer s.r.wg.Done()
+	ctx := s.r.ctx
+	for ctx.Err() == nil {
+		// XReadGroup 会按 Block 延长读超时
+		streams, err := s.r.client.XReadGroup(&goredis.XReadGroupArgs{
+			Group:    s.r.opts.group,
+			Consumer: s.r.opts.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    s.r.opts.batch,
+			Block:    s.r.opts.block,
+		}).Result()
+		if err != nil {
+			if err == goredis.Nil || ctx.Err() != nil {
+				continue
+			}
+			warn("mq/redis: read stream failed", err, logger.KV("stream", s.stream))
+			// stream 被删除后重建消费组
+			if isRedisError(err, "NOGROUP") {
+				if err = s.createGroup(); err != nil {
+					warn("mq/redis: create group failed", err, logger.KV("stream", s.stream))
+				}
+			}
+			sleep(ctx, s.r.opts.pollInterval)
+			continue
+		}
+		for _, st := range streams {
+			for _, m := range st.Messages {
+				s.handle(m, 1)
+			}
+		}
+	}
+}
+
+// claim 定期接管其他消费者 pending 列表中闲置超过 claimIdle 的消息(消费者崩溃或处理超时),
+// retryConsumer 名下等待重试的消息由 retry 按重试策略的间隔投递, 不在这里接管
+func (s *subscription) claim() {
+	defer s.r.wg.Done()
+	ctx := s.r.ctx
+	interval := s.r.opts.claimIdle / 2
+	for sleep(ctx, interval) {
+		start := "-"
+		for ctx.Err() == nil {
+			cmd := goredis.NewXPendingExtCmd("xpending", s.stream, s.r.opts.group,
+				"idle", milliseconds(s.r.opts.claimIdle), start, "+", s.r.opts.batch)
+			if err := s.r.client.ProcessContext(ctx, cmd); err != nil {
+				warn("mq/redis: query pending messages failed", err, logger.KV("stream", s.stream))
+				break
+			}
+			pending := cmd.Val()
+			var ids []string
+			attempts := make(map[string]int, len(pending))
+			for _, p := range pending {
+				if p.Consumer != retryConsumer {
+					ids = append(ids, p.ID)
+					// XCLAIM 会增加投递次数
+					attempts[p.ID] = int(p.RetryCount) + 1
+				}
+			}
+			if len(ids) > 0 {
+				// 闲置时长在 XCLAIM 时再次检查, 期间被处理或转给 retryConsumer 的消息不会被接管
+				msgs, err := s.r.client.XClaim(&goredis.XClaimArgs{
+					Stream:   s.stream,
+					Group:    s.r.opts.group,
+					Consumer: s.r.opts.consumer,
+					MinIdle:  s.r.opts.claimIdle,
+					Messages: ids,
+				}).Result()
+				if err != nil {
+					warn("mq/redis: claim pending messages failed", err, logger.KV("stream", s.stream))
+					break
+				}
+				for _, m := range msgs {
+					s.handle(m, attempts[m.ID])
+				}
+			}
+			// 遍历完整个 pending 列表后等待下一轮
+			if int64(len(pending)) < s.r.opts.batch {
+				break
+			}
+			start = nextID(pending[len(pending)-1].ID)
+		}
+	}
+}
+
+// retry 定期重新投递 retryConsumer 名下到达重试间隔的消息
+func (s *subscription) retry() {
+	defer s.r.wg.Done()
+	ctx := s.r.ctx
+	for sleep(ctx, s.r.opts.pollInterval) {
+		// 逐批遍历, 避免排在前面的长间隔消息挡住后面已到期的消息
+		for start := "-"; ctx.Err() == nil; {
+			pending, err := s.r.client.XPendingExt(&goredis.XPendingExtArgs{
+				Stream:   s.stream,
+				Group:    s.r.opts.group,
+				Start:    start,
+				End:      "+",
+				Count:    s.r.opts.batch,
+				Consumer: retryConsumer,
+			}).Result()
+			if err != nil {
+				warn("mq/redis: query pending messages failed", err, logger.KV("stream", s.stream))
+				break
+			}
+			for _, p := range pending {
+				s.redeliver(p)
+			}
+			if int64(len(pending)) < s.r.opts.batch {
+				break
+			}
+			start = nextID(pending[len(pending)-1].ID)
+		}
+	}
+}
+
+// redeliver 到达重试间隔时接管并处理 p
+func (s *subscription) redeliver(p goredis.XPendingExt) {
+	delay, _ := s.r.opts.retry.Next(int(p.RetryCount))
+	if p.Idle < delay {
+		return
+	}
+	// 组内的其他消费者可能已经接管, 此时返回空
+	msgs, err := s.r.client.XClaim(&goredis.XClaimArgs{
+		Stream:   s.stream,
+		Group:    s.r.opts.group,
+		Consumer: s.r.opts.consumer,
+		MinIdle:  delay,
+		Messages: []string{p.ID},
+	}).Result()
+	if err != nil {
+		warn("mq/redis: claim retry message failed", err, logger.KV("stream", s.stream))
+		return
+	}
+	for _, m := range msgs {
+		s.handle(m, int(p.RetryCount)+1)
+	}
+}
+
+// park 将处理失败的消息转给 retryConsumer, 重置闲置时长, 投递次数保持为 attempts
+func (s *subscription) park(id string, attempts int) {
+	err := s.r.client.ProcessContext(s.r.ctx, goredis.NewStringSliceCmd("xclaim", s.stream, s.r.opts.group,
+		retryConsumer, 0, id, "retrycount", attempts, "justid"))
+	if err != nil {
+		warn("mq/redis: park failed message failed", err, logger.KV("stream", s.stream), logger.KV("id", id))
+	}
+}
+
+// handle 处理成功、被忽略或转入死信 topic 后确认消息; 处理失败时不确认, 等待重新投递
+func (s *subscription) handle(m goredis.XMessage, attempts int) {
+	msg := decode(s.topic, m.Values)
+	msg.Attempts = attempts
+	// 被接管时已被裁剪的消息没有字段, 直接确认
+	if len(m.Values) > 0 && mq.MatchTag(s.filter, msg.Tag) {
+		err := s.handler(s.r.ctx, msg)
+		if err != nil {
+			if _, ok := s.r.opts.retry.Next(attempts); ok && !errors.Is(err, mq.ErrReject) {
+				s.park(m.ID, attempts)
+				return
+			}
+			if err = s.r.deadLetter(msg, err); err != nil {
+				warn("mq/redis: send to dead letter topic failed", err, logger.KV("stream", s.stream))
+				return
+			}
+		}
+	}
+	if err := s.r.client.XAck(s.stream, s.r.opts.group, m.ID).Err(); err != nil {
+		warn("mq/redis: ack failed", err, logger.KV("stream", s.stream), logger.KV("id", m.ID))
+	}
+}
+
+func (r *Redis) deadLetter(msg *mq.Msg, err error) error {
+	dl := msg.Clone()
+	dl.Topic = mq.DeadLetterTopic(r.opts.group)
+	dl.Delay = 0
+	dl.Attempts = 0
+	dl.SetHeader(mq.HeaderOriginTopic, msg.Topic)
+	dl.SetHeader(mq.HeaderError, err.Error())
+	return r.add(r.ctx, dl)
+}
+
+// move 定期把到期的延迟消息搬入 stream, 多个消费者同时搬运时由脚本保证不重复
+func (s *subscription) move() {
+	defer s.r.wg.Done()
+	ctx := s.r.ctx
+	keys := []interface{}{delayKey(s.stream), delayMsgKey(s.stream), s.stream}
+	for sleep(ctx, s.r.opts.pollInterval) {
+		for ctx.Err() == nil {
+			args := append([]interface{}{"eval", moveScript, len(keys)}, keys...)
+			args = append(args, s.r.opts.batch, s.r.opts.maxLen)
+			cmd := goredis.NewIntCmd(args...)
+			if err := s.r.client.ProcessContext(ctx, cmd); err != nil {
+				warn("mq/redis: move delayed messages failed", err, logger.KV("stream", s.stream))
+				break
+			}
+			if cmd.Val() < s.r.opts.batch {
+				break
+			}
+		}
+	}
+}
+
+// nextID 返回 stream 中 id 之后的最小 ID, 用作不包含 id 的范围起点
+func nextID(id string) string {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return id
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return id
+	}
+	return ms + "-" + strconv.FormatUint(n+1, 10)
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/davveo/go-toolkit/mq"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+// 死信消息保存在 stream prefix + "{DLQ-group}" 中, Replay/Purge 通过 XDEL 删除处理过的消息
+
+var _ mq.DeadLetterQueue = (*Redis)(nil)
+
+func (r *Redis) List(ctx context.Context, group string, limit int) ([]*mq.Msg, error) {
+	topic := mq.DeadLetterTopic(group)
+	args := []interface{}{"xrange", r.stream(topic), "-", "+"}
+	if limit > 0 {
+		args = append(args, "count", limit)
+	}
+	cmd := goredis.NewXMessageSliceCmd(args...)
+	if err := r.client.ProcessContext(ctx, cmd); err != nil {
+		return nil, err
+	}
+	msgs := make([]*mq.Msg, 0, len(cmd.Val()))
+	for _, m := range cmd.Val() {
+		msgs = append(msgs, decode(topic, m.Values))
+	}
+	return msgs, nil
+}
+
+func (r *Redis) Replay(ctx context.Context, group string, ids ...string) (int, error) {
+	return r.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		_, err := r.Send(ctx, mq.Revive(msg))
+		return err
+	})
+}
+
+func (r *Redis) Purge(ctx context.Context, group string, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		// 保留 stream 和消费组
+		n, err := r.client.XTrim(r.stream(mq.DeadLetterTopic(group)), 0).Result()
+		return int(n), err
+	}
+	return r.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		return nil
+	})
+}
+
+// drain 分批遍历死信 stream, 匹配 ids 的消息交给 fn 处理成功后删除
+func (r *Redis) drain(ctx context.Context, group string, ids []string, fn func(msg *mq.Msg) error) (int, error) {
+	topic := mq.DeadLetterTopic(group)
+	stream := r.stream(topic)
+	set := mq.NewIDSet(ids)
+	n := 0
+	start := "-"
+	for {
+		cmd := goredis.NewXMessageSliceCmd("xrange", stream, start, "+", "count", r.opts.batch)
+		if err := r.client.ProcessContext(ctx, cmd); err != nil {
+			return n, err
+		}
+		entries := cmd.Val()
+		for _, m := range entries {
+			msg := decode(topic, m.Values)
+			if !set.Match(msg.ID) {
+				continue
+			}
+			if err := fn(msg); err != nil {
+				return n, err
+			}
+			if err := r.client.XDel(stream, m.ID).Err(); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if int64(len(entries)) < r.opts.batch {
+			return n, nil
+		}
+		// 从上一批的最后一条之后开始
+		start = "(" + entries[len(entries)-1].ID
+	}
+}
@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const (
+	defaultPrefix       = "mq:"
+	defaultGroup        = "default"
+	defaultMaxLen       = 100000
+	defaultBatch        = 16
+	defaultBlock        = time.Second
+	defaultClaimIdle    = 30 * time.Second
+	defaultMaxAttempts  = 16
+	defaultMinBackoff   = 100 * time.Millisecond
+	defaultMaxBackoff   = time.Minute
+	defaultPollInterval = 100 * time.Millisecond
+)
+
+type (
+	Options struct {
+		// stream key 前缀, topic 对应的 stream 为 prefix + "{" + topic + "}"
+		prefix string
+		// 消费组, 同组的消费者竞争消费, 不同组各自收到全部消息
+		group string
+		// 消费者名称, 同组内唯一, 默认为 hostname + 随机串
+		consumer string
+		// 发送时按 MAXLEN ~ maxLen 近似裁剪 stream, <= 0 不裁剪;
+		// 被裁剪掉的未确认消息无法再重新投递
+		maxLen int64
+		// 每次 XREADGROUP/XPENDING 读取的消息数
+		batch int64
+		// XREADGROUP 的阻塞时长, 应小于客户端的 ReadTimeout, 同时决定 Close 的最长等待时间
+		block time.Duration
+		// 消费者崩溃后, 其 pending 列表中的消息闲置超过 claimIdle 后被其他消费者接管并重新投递,
+		// 应大于 handler 的最长处理时间, 否则处理中的消息会被重复投递
+		claimIdle time.Duration
+		// 最大投递次数, 超过后进入死信 topic
+		maxAttempts int
+		// 处理失败后的重试策略, 默认按 maxAttempts 指数退避; 等待重试的消息不会被提前接管
+		retry mq.RetryPolicy
+		// 检查到期延迟消息的间隔
+		pollInterval time.Duration
+	}
+	Option func(o *Options)
+)
+
+func Prefix(prefix string) Option {
+	return func(o *Options) {
+		o.prefix = prefix
+	}
+}
+
+func Group(group string) Option {
+	return func(o *Options) {
+		o.group = group
+	}
+}
+
+func Consumer(name string) Option {
+	return func(o *Options) {
+		o.consumer = name
+	}
+}
+
+func MaxLen(n int64) Option {
+	return func(o *Options) {
+		o.maxLen = n
+	}
+}
+
+func Batch(n int64) Option {
+	return func(o *Options) {
+		o.batch = n
+	}
+}
+
+func Block(d time.Duration) Option {
+	return func(o *Options) {
+		o.block = d
+	}
+}
+
+func ClaimIdle(d time.Duration) Option {
+	return func(o *Options) {
+		o.claimIdle = d
+	}
+}
+
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.maxAttempts = n
+	}
+}
+
+func RetryPolicy(policy mq.RetryPolicy) Option {
+	return func(o *Options) {
+		o.retry = policy
+	}
+}
+
+func PollInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.pollInterval = d
+	}
+}
@@ -1 +1,256 @@
 package redis
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+// delayScript 延迟消息的属性和 body 存入 hash, 到期时间(redis 服务端毫秒时间)存入 zset
+const delayScript = `
+redis.replicate_commands()
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call("hset", KEYS[2], ARGV[2], ARGV[3])
+redis.call("hset", KEYS[2], ARGV[2] .. "|body", ARGV[4])
+return redis.call("zadd", KEYS[1], now + tonumber(ARGV[1]), ARGV[2])`
+
+// moveScript 把最多 ARGV[1] 条到期的延迟消息写入 stream, 返回写入的条数
+const moveScript = `
+redis.replicate_commands()
+local t = redis.call("time")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local due = redis.call("zrangebyscore", KEYS[1], "-inf", now, "limit", 0, ARGV[1])
+for _, id in ipairs(due) do
+	local meta = redis.call("hget", KEYS[2], id)
+	if meta then
+		local fields = cjson.decode(meta)
+		table.insert(fields, "body")
+		table.insert(fields, redis.call("hget", KEYS[2], id .. "|body"))
+		if tonumber(ARGV[2]) > 0 then
+			redis.call("xadd", KEYS[3], "maxlen", "~", ARGV[2], "*", unpack(fields))
+		else
+			redis.call("xadd", KEYS[3], "*", unpack(fields))
+		end
+	end
+	redis.call("hdel", KEYS[2], id, id .. "|body")
+	redis.call("zrem", KEYS[1], id)
+end
+return #due`
+
+// stream 中的字段, 自定义属性以 headerPrefix 开头
+const (
+	fieldID      = "id"
+	fieldTag     = "tag"
+	fieldKey     = "key"
+	fieldTime    = "ts"
+	fieldBody    = "body"
+	headerPrefix = "h:"
+)
+
+// Redis 基于 Redis Streams (>= 6.2) 的 mq.MQ 实现.
+// 每个 topic 对应一个 stream, 消费组对应 stream 的 consumer group;
+// 处理失败的消息不确认, 转给 pending 列表中的虚拟消费者 retryConsumer, 按 RetryPolicy 的间隔通过 XCLAIM 重新投递;
+// 崩溃的消费者未确认的消息在闲置超过 ClaimIdle 后通过 XCLAIM 被组内其他消费者接管.
+// 延迟消息由订阅了该 topic 的消费者在到期后搬入 stream.
+type Redis struct {
+	client goredis.UniversalClient
+	opts   *Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+var _ mq.MQ = (*Redis)(nil)
+
+func NewRedis(client goredis.UniversalClient, opts ...Option) *Redis {
+	o := &Options{
+		prefix:       defaultPrefix,
+		group:        defaultGroup,
+		maxLen:       defaultMaxLen,
+		batch:        defaultBatch,
+		block:        defaultBlock,
+		claimIdle:    defaultClaimIdle,
+		maxAttempts:  defaultMaxAttempts,
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.retry == nil {
+		o.retry = mq.ExponentialRetry(defaultMinBackoff, defaultMaxBackoff, 0, o.maxAttempts)
+	}
+	if o.consumer == "" {
+		host, _ := os.Hostname()
+		o.consumer = host + "-" + uuid.New().String()[:8]
+	}
+	r := &Redis{client: client, opts: o}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	return r
+}
+
+func (r *Redis) Send(ctx context.Context, msg *mq.Msg) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if r.isClosed() {
+		return "", mq.ErrClosed
+	}
+	msg.Prepare()
+	if msg.Delay > 0 {
+		meta, err := json.Marshal(metaFields(msg))
+		if err != nil {
+			return "", err
+		}
+		stream := r.stream(msg.Topic)
+		err = r.client.ProcessContext(ctx, goredis.NewIntCmd("eval", delayScript, 2,
+			delayKey(stream), delayMsgKey(stream), milliseconds(msg.Delay), msg.ID, meta, msg.Body))
+		if err != nil {
+			return "", err
+		}
+		return msg.ID, nil
+	}
+	if err := r.add(ctx, msg); err != nil {
+		return "", err
+	}
+	return msg.ID, nil
+}
+
+func (r *Redis) SendAsync(ctx context.Context, msg *mq.Msg, callback func(id string, err error)) {
+	mq.SendAsync(ctx, r, msg, callback)
+}
+
+func (r *Redis) SendDelay(ctx context.Context, msg *mq.Msg, delay time.Duration) (string, error) {
+	msg.Delay = delay
+	return r.Send(ctx, msg)
+}
+
+// Close 停止消费并等待处理中的消息完成, 不关闭 client
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+	r.cancel()
+	r.wg.Wait()
+	return nil
+}
+
+func (r *Redis) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// add XADD 并按 maxLen 近似裁剪
+func (r *Redis) add(ctx context.Context, msg *mq.Msg) error {
+	args := []interface{}{"xadd", r.stream(msg.Topic)}
+	if r.opts.maxLen > 0 {
+		args = append(args, "maxlen", "~", r.opts.maxLen)
+	}
+	args = append(args, "*")
+	for _, f := range metaFields(msg) {
+		args = append(args, f)
+	}
+	args = append(args, fieldBody, msg.Body)
+	return r.client.ProcessContext(ctx, goredis.NewStringCmd(args...))
+}
+
+// stream topic 对应的 stream key, 延迟消息的 key 使用同一个 hash tag, 兼容集群模式
+func (r *Redis) stream(topic string) string {
+	return r.opts.prefix + "{" + topic + "}"
+}
+
+func delayKey(stream string) string {
+	return stream + ":delay"
+}
+
+func delayMsgKey(stream string) string {
+	return stream + ":delay:msgs"
+}
+
+// metaFields 除 body 以外的字段, 依次为字段名和值
+func metaFields(msg *mq.Msg) []string {
+	fields := []string{
+		fieldID, msg.ID,
+		fieldTag, msg.Tag,
+		fieldKey, msg.Key,
+		fieldTime, strconv.FormatInt(msg.Timestamp.UnixMilli(), 10),
+	}
+	for k, v := range msg.Headers {
+		fields = append(fields, headerPrefix+k, v)
+	}
+	return fields
+}
+
+func decode(topic string, values map[string]interface{}) *mq.Msg {
+	msg := &mq.Msg{Topic: topic}
+	for k, v := range values {
+		s, _ := v.(string)
+		switch k {
+		case fieldID:
+			msg.ID = s
+		case fieldTag:
+			msg.Tag = s
+		case fieldKey:
+			msg.Key = s
+		case fieldTime:
+			if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+				msg.Timestamp = time.UnixMilli(ms)
+			}
+		case fieldBody:
+			msg.Body = []byte(s)
+		default:
+			if strings.HasPrefix(k, headerPrefix) {
+				msg.SetHeader(strings.TrimPrefix(k, headerPrefix), s)
+			}
+		}
+	}
+	return msg
+}
+
+func milliseconds(d time.Duration) int64 {
+	ms := int64(d / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return ms
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func warn(msg string, err error, kvs ...logger.Entry) {
+	if logger.IsInitialized() {
+		logger.WarnErr(msg, err, kvs...)
+	}
+}
+
+func isRedisError(err error, prefix string) bool {
+	return err != nil && strings.HasPrefix(err.Error(), prefix)
+}
@@ -0,0 +1,303 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/davveo/go-toolkit/mq"
+	goredis "github.com/go-redis/redis/v7"
+)
+
+func newTestRedis(t *testing.T, opts ...Option) (*Redis, goredis.UniversalClient) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	opts = append([]Option{
+		Block(20 * time.Millisecond),
+		ClaimIdle(50 * time.Millisecond),
+		PollInterval(10 * time.Millisecond),
+	}, opts...)
+	r := NewRedis(client, opts...)
+	t.Cleanup(func() { _ = r.Close() })
+	return r, client
+}
+
+func receive(t *testing.T, ch <-chan *mq.Msg) *mq.Msg {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+		return nil
+	}
+}
+
+func TestSendSubscribe(t *testing.T) {
+	ctx := context.Background()
+	r, client := newTestRedis(t)
+	ch := make(chan *mq.Msg, 4)
+	if err := r.Subscribe("orders", "a||b", func(ctx context.Context, m *mq.Msg) error {
+		ch <- m
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	skipped := mq.NewMsg("orders", "c", []byte("skipped"))
+	if _, err := r.Send(ctx, skipped); err != nil {
+		t.Fatal(err)
+	}
+	msg := mq.NewMsg("orders", "a", []byte{0, 0xff, 'x'})
+	msg.Key = "order-1"
+	msg.SetHeader("trace", "abc")
+	id, err := r.Send(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := receive(t, ch)
+	if got.ID != id || got.Topic != "orders" || got.Tag != "a" || got.Key != "order-1" ||
+		string(got.Body) != "\x00\xffx" || got.Header("trace") != "abc" || got.Attempts != 1 ||
+		got.Timestamp.UnixMilli() != msg.Timestamp.UnixMilli() {
+		t.Fatalf("got %+v", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	pending, err := client.XPending("mq:{orders}", defaultGroup).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Count != 0 {
+		t.Fatalf("pending = %d", pending.Count)
+	}
+	select {
+	case m := <-ch:
+		t.Fatalf("unexpected message %s", m.Body)
+	default:
+	}
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestRedis(t, Group("g1"), MaxAttempts(2))
+	ch := make(chan *mq.Msg, 8)
+	if err := r.Subscribe("orders", "", func(ctx context.Context, m *mq.Msg) error {
+		ch <- m
+		switch string(m.Body) {
+		case "flaky":
+			if m.Attempts < 2 {
+				return errors.New("busy")
+			}
+		case "bad":
+			return mq.Reject(errors.New("malformed"))
+		case "broken":
+			return errors.New("always")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	dead := make(chan *mq.Msg, 2)
+	if err := r.Subscribe(mq.DeadLetterTopic("g1"), "", func(ctx context.Context, m *mq.Msg) error {
+		dead <- m
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Send(ctx, mq.NewMsg("orders", "", []byte("flaky"))); err != nil {
+		t.Fatal(err)
+	}
+	if m := receive(t, ch); m.Attempts != 1 {
+		t.Fatalf("attempts = %d", m.Attempts)
+	}
+	if m := receive(t, ch); string(m.Body) != "flaky" || m.Attempts != 2 {
+		t.Fatalf("redelivered %s attempts = %d", m.Body, m.Attempts)
+	}
+
+	for _, body := range []string{"bad", "broken"} {
+		if _, err := r.Send(ctx, mq.NewMsg("orders", "", []byte(body))); err != nil {
+			t.Fatal(err)
+		}
+		d := receive(t, dead)
+		if string(d.Body) != body || d.Header(mq.HeaderOriginTopic) != "orders" || d.Header(mq.HeaderError) == "" {
+			t.Fatalf("dead letter %+v", d)
+		}
+	}
+}
+
+func TestClaimFromCrashedConsumer(t *testing.T) {
+	ctx := context.Background()
+	r, client := newTestRedis(t)
+	if err := client.XGroupCreateMkStream("mq:{orders}", defaultGroup, "$").Err(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := r.Send(ctx, mq.NewMsg("orders", "", []byte("orphan")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 另一个消费者读取后崩溃, 消息未确认
+	if err = client.XReadGroup(&goredis.XReadGroupArgs{
+		Group: defaultGroup, Consumer: "crashed", Streams: []string{"mq:{orders}", ">"}, Block: -1,
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan *mq.Msg, 1)
+	if err = r.Subscribe("orders", "", func(ctx context.Context, m *mq.Msg) error {
+		ch <- m
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if m := receive(t, ch); m.ID != id || m.Attempts != 2 {
+		t.Fatalf("claimed %s attempts = %d", m.ID, m.Attempts)
+	}
+}
+
+func TestRetryBackoffLongerThanClaimIdle(t *testing.T) {
+	ctx := context.Background()
+	// 重试间隔远大于 ClaimIdle(50ms), 等待重试的消息不能被 claim 提前接管
+	r, _ := newTestRedis(t, RetryPolicy(mq.FixedRetry(400*time.Millisecond, 3)))
+	attempts := make(chan time.Time, 4)
+	if err := r.Subscribe("orders", "", func(ctx context.Context, m *mq.Msg) error {
+		attempts <- time.Now()
+		if m.Attempts < 2 {
+			return errors.New("busy")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Send(ctx, mq.NewMsg("orders", "", []byte("x"))); err != nil {
+		t.Fatal(err)
+	}
+	var first, second time.Time
+	select {
+	case first = <-attempts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	}
+	select {
+	case second = <-attempts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not redelivered")
+	}
+	if d := second.Sub(first); d < 400*time.Millisecond {
+		t.Fatalf("redelivered after %v", d)
+	}
+	select {
+	case <-attempts:
+		t.Fatal("unexpected redelivery")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSendDelay(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestRedis(t)
+	ch := make(chan *mq.Msg, 1)
+	if err := r.Subscribe("orders", "", func(ctx context.Context, m *mq.Msg) error {
+		ch <- m
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	msg := mq.NewMsg("orders", "t", []byte{0xff})
+	msg.SetHeader("trace", "abc")
+	start := time.Now()
+	id, err := r.SendDelay(ctx, msg, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, ch)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("delivered after %v", elapsed)
+	}
+	if got.ID != id || got.Tag != "t" || string(got.Body) != "\xff" || got.Header("trace") != "abc" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestMaxLen(t *testing.T) {
+	ctx := context.Background()
+	r, client := newTestRedis(t, MaxLen(10))
+	for i := 0; i < 50; i++ {
+		if _, err := r.Send(ctx, mq.NewMsg("orders", "", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := client.XLen("mq:{orders}").Val(); n >= 50 {
+		t.Fatalf("stream not trimmed: %d", n)
+	}
+
+	_ = r.Close()
+	if _, err := r.Send(ctx, mq.NewMsg("orders", "", nil)); !errors.Is(err, mq.ErrClosed) {
+		t.Fatalf("Send after Close = %v", err)
+	}
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+	// Batch(1) 时每批只有一条, 遍历死信需要跳过上一批的最后一条
+	r, _ := newTestRedis(t, Group("g"), Batch(1), RetryPolicy(mq.FixedRetry(10*time.Millisecond, 2)))
+	healthy := make(chan bool, 1)
+	received := make(chan *mq.Msg, 4)
+	if err := r.Subscribe("orders", "", func(ctx context.Context, m *mq.Msg) error {
+		select {
+		case <-healthy:
+			received <- m
+			return nil
+		default:
+			return errors.New("down")
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := r.Send(ctx, mq.NewMsg("orders", "", []byte{byte('a' + i)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	var dead []*mq.Msg
+	for deadline := time.Now().Add(2 * time.Second); len(dead) < 3; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letters = %d", len(dead))
+		}
+		dead, _ = r.List(ctx, "g", 0)
+	}
+	if d := dead[0]; d.Header(mq.HeaderError) != "down" || d.Header(mq.HeaderOriginTopic) != "orders" {
+		t.Fatalf("dead letter = %+v", d)
+	}
+	if msgs, _ := r.List(ctx, "g", 1); len(msgs) != 1 {
+		t.Fatalf("List(1) = %d", len(msgs))
+	}
+
+	if n, err := r.Purge(ctx, "g", ids[0]); err != nil || n != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	healthy <- true
+	if n, err := r.Replay(ctx, "g", ids[2]); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	msg := receive(t, received)
+	if msg.ID != ids[2] || msg.Topic != "orders" || msg.Attempts != 1 || len(msg.Headers) != 0 {
+		t.Fatalf("replayed = %+v", msg)
+	}
+	if msgs, _ := r.List(ctx, "g", 0); len(msgs) != 1 || msgs[0].ID != ids[1] {
+		t.Fatalf("remaining = %+v", msgs)
+	}
+	if n, _ := r.Purge(ctx, "g"); n != 1 {
+		t.Fatalf("Purge all = %d", n)
+	}
+}
@@ -0,0 +1,206 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderCorrelationID 请求的关联 ID, 响应携带相同的值
+	HeaderCorrelationID = "x-correlation-id"
+	// HeaderReplyTo 请求方接收响应的 topic
+	HeaderReplyTo = "x-reply-to"
+	// HeaderDeadline 请求方等待的截止时间(unix 毫秒), 服务端跳过已过期的请求
+	HeaderDeadline = "x-deadline"
+	// HeaderReplyError 服务端处理失败时响应中的错误信息
+	HeaderReplyError = "x-reply-error"
+)
+
+// ErrRemote 服务端处理请求失败, Request 返回的错误包装了服务端的错误信息
+var ErrRemote = errors.New("mq: remote handler failed")
+
+// Requester 通过 mq 发送请求并等待响应.
+// 每个 Requester 使用独立的响应 topic, 第一次请求时订阅, 响应按 HeaderCorrelationID 交给等待的请求.
+type Requester struct {
+	producer Producer
+	consumer Consumer
+	topic    string
+
+	mu         sync.Mutex
+	subscribed bool
+	closed     bool
+	pending    map[string]chan *Msg
+}
+
+// NewRequester consumer 只用于接收响应, 由 Requester 关闭; replyTopic 为空时生成 "REPLY-" + uuid,
+// 需要预先创建 topic 的后端(如关闭了自动创建的 kafka)应指定已创建的 topic, 且不能与其他 Requester 共用
+func NewRequester(producer Producer, consumer Consumer, replyTopic string) *Requester {
+	if replyTopic == "" {
+		replyTopic = "REPLY-" + uuid.New().String()
+	}
+	return &Requester{
+		producer: producer,
+		consumer: consumer,
+		topic:    replyTopic,
+		pending:  make(map[string]chan *Msg),
+	}
+}
+
+// ReplyTopic 接收响应的 topic
+func (r *Requester) ReplyTopic() string {
+	return r.topic
+}
+
+// Request 发送请求并等待响应直到 ctx 结束, 应通过 ctx 设置超时.
+// 服务端处理失败时返回的错误包装了 ErrRemote, 同时返回响应消息.
+func (r *Requester) Request(ctx context.Context, msg *Msg) (*Msg, error) {
+	if err := r.subscribe(); err != nil {
+		return nil, err
+	}
+	msg.Prepare()
+	id := uuid.New().String()
+	msg.SetHeader(HeaderCorrelationID, id)
+	msg.SetHeader(HeaderReplyTo, r.topic)
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.SetHeader(HeaderDeadline, strconv.FormatInt(deadline.UnixMilli(), 10))
+	}
+
+	ch := make(chan *Msg, 1)
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrClosed
+	}
+	r.pending[id] = ch
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	if _, err := r.producer.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case reply, ok := <-ch:
+		if !ok {
+			return nil, ErrClosed
+		}
+		if e := reply.Header(HeaderReplyError); e != "" {
+			return reply, fmt.Errorf("%w: %s", ErrRemote, e)
+		}
+		return reply, nil
+	}
+}
+
+// Close 关闭 consumer, 等待中的请求返回 ErrClosed
+func (r *Requester) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	for id, ch := range r.pending {
+		close(ch)
+		delete(r.pending, id)
+	}
+	r.mu.Unlock()
+	return r.consumer.Close()
+}
+
+func (r *Requester) subscribe() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	if r.subscribed {
+		return nil
+	}
+	if err := r.consumer.Subscribe(r.topic, "", r.receive); err != nil {
+		return err
+	}
+	r.subscribed = true
+	return nil
+}
+
+// receive 没有等待者的响应(请求已超时)直接丢弃
+func (r *Requester) receive(ctx context.Context, msg *Msg) error {
+	id := msg.Header(HeaderCorrelationID)
+	r.mu.Lock()
+	ch, ok := r.pending[id]
+	delete(r.pending, id)
+	r.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+	return nil
+}
+
+// ReplyHandler 处理请求并返回响应, 返回 nil 响应时发送空消息, 返回的错误通过 HeaderReplyError 发送给请求方
+type ReplyHandler func(ctx context.Context, req *Msg) (*Msg, error)
+
+// Reply 将 ReplyHandler 包装为 Handler, 响应发送到请求的 HeaderReplyTo topic.
+// 没有 HeaderReplyTo 的消息只执行 ReplyHandler; 请求已超过 HeaderDeadline 时直接确认;
+// 发送响应失败时返回错误, 请求按重试策略重新投递.
+func Reply(producer Producer, h ReplyHandler) Handler {
+	return func(ctx context.Context, req *Msg) error {
+		replyTo := req.Header(HeaderReplyTo)
+		if replyTo == "" {
+			_, err := h(ctx, req)
+			return err
+		}
+		hctx := ctx
+		if ms, err := strconv.ParseInt(req.Header(HeaderDeadline), 10, 64); err == nil {
+			deadline := time.UnixMilli(ms)
+			if !time.Now().Before(deadline) {
+				return nil
+			}
+			var cancel context.CancelFunc
+			hctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+		resp, err := h(hctx, req)
+		if resp == nil {
+			resp = &Msg{}
+		}
+		resp.Topic = replyTo
+		resp.Delay = 0
+		resp.SetHeader(HeaderCorrelationID, req.Header(HeaderCorrelationID))
+		if err != nil {
+			resp.SetHeader(HeaderReplyError, err.Error())
+		}
+		// 发送响应不受请求的截止时间限制
+		_, err = producer.Send(ctx, resp)
+		return err
+	}
+}
+
+// Server 在 Consumer 上注册返回响应的 Handler
+type Server struct {
+	producer Producer
+	consumer Consumer
+}
+
+func NewServer(producer Producer, consumer Consumer) *Server {
+	return &Server{producer: producer, consumer: consumer}
+}
+
+// Handle 订阅 topic, 请求交给 h 处理后将响应发送给请求方
+func (s *Server) Handle(topic, tag string, h ReplyHandler) error {
+	return s.consumer.Subscribe(topic, tag, Reply(s.producer, h))
+}
+
+func (s *Server) Close() error {
+	return s.consumer.Close()
+}
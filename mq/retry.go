@@ -0,0 +1,107 @@
+package mq
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 决定处理失败的消息何时重新投递
+type RetryPolicy interface {
+	// Next 第 attempts 次投递处理失败后到下一次投递的间隔, ok 为 false 时不再重试, 消息进入死信 topic
+	Next(attempts int) (delay time.Duration, ok bool)
+}
+
+type fixedRetry struct {
+	interval    time.Duration
+	maxAttempts int
+}
+
+// FixedRetry 固定间隔重试, 最多投递 maxAttempts 次, maxAttempts <= 0 时不限次数
+func FixedRetry(interval time.Duration, maxAttempts int) RetryPolicy {
+	return &fixedRetry{interval: interval, maxAttempts: maxAttempts}
+}
+
+func (p *fixedRetry) Next(attempts int) (time.Duration, bool) {
+	if p.maxAttempts > 0 && attempts >= p.maxAttempts {
+		return 0, false
+	}
+	return p.interval, true
+}
+
+type exponentialRetry struct {
+	min, max    time.Duration
+	jitter      float64
+	maxAttempts int
+}
+
+// ExponentialRetry 间隔从 min 开始指数增长, 不超过 max, 最多投递 maxAttempts 次, maxAttempts <= 0 时不限次数.
+// jitter 取值 [0, 1], 实际间隔在 [d*(1-jitter), d] 之间随机, 避免大量消息同时重试.
+func ExponentialRetry(min, max time.Duration, jitter float64, maxAttempts int) RetryPolicy {
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	return &exponentialRetry{min: min, max: max, jitter: jitter, maxAttempts: maxAttempts}
+}
+
+func (p *exponentialRetry) Next(attempts int) (time.Duration, bool) {
+	if p.maxAttempts > 0 && attempts >= p.maxAttempts {
+		return 0, false
+	}
+	d := p.min
+	for i := 1; i < attempts && d < p.max; i++ {
+		d *= 2
+	}
+	if d > p.max {
+		d = p.max
+	}
+	if p.jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.jitter * float64(d))
+	}
+	return d, true
+}
+
+// DeadLetterQueue 查看和处理消费组的死信消息, 死信消息的 HeaderOriginTopic 和 HeaderError 记录了原 topic 和最后一次的错误
+type DeadLetterQueue interface {
+	// List 按进入死信 topic 的顺序返回最早的最多 limit 条死信消息, 不改变消息的状态
+	List(ctx context.Context, group string, limit int) ([]*Msg, error)
+	// Replay 将 ID 在 ids 中的死信消息重新发送到原 topic 并从死信 topic 删除, ids 为空时重放全部, 返回重放的消息数
+	Replay(ctx context.Context, group string, ids ...string) (int, error)
+	// Purge 删除 ID 在 ids 中的死信消息, ids 为空时删除全部, 返回删除的消息数
+	Purge(ctx context.Context, group string, ids ...string) (int, error)
+}
+
+// Revive 由死信消息还原重放时发送的消息: 恢复原 topic, 清除死信和重试相关的 header
+func Revive(dl *Msg) *Msg {
+	m := dl.Clone()
+	m.Topic = dl.Header(HeaderOriginTopic)
+	m.Delay = 0
+	m.Attempts = 0
+	delete(m.Headers, HeaderOriginTopic)
+	delete(m.Headers, HeaderError)
+	delete(m.Headers, HeaderAttempts)
+	if len(m.Headers) == 0 {
+		m.Headers = nil
+	}
+	return m
+}
+
+// IDSet 判断消息 ID 是否在 ids 中, ids 为空时匹配全部, 供 DeadLetterQueue 的实现使用
+type IDSet map[string]bool
+
+func NewIDSet(ids []string) IDSet {
+	if len(ids) == 0 {
+		return nil
+	}
+	s := make(IDSet, len(ids))
+	for _, id := range ids {
+		s[id] = true
+	}
+	return s
+}
+
+func (s IDSet) Match(id string) bool {
+	return s == nil || s[id]
+}
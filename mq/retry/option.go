@@ -0,0 +1,67 @@
+package retry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const defaultMaxAttempts = 16
+
+var defaultTiers = []time.Duration{time.Second, 10 * time.Second, time.Minute, 10 * time.Minute}
+
+type (
+	Options struct {
+		// 重试策略, 默认从 1s 开始指数增长, 不超过 10m, 最多投递 16 次
+		policy mq.RetryPolicy
+		// 重试级别, 每个级别对应一个重试 topic, 按从小到大排列
+		tiers []time.Duration
+	}
+	Option func(o *Options)
+)
+
+func Policy(policy mq.RetryPolicy) Option {
+	return func(o *Options) {
+		o.policy = policy
+	}
+}
+
+// Tiers 设置重试级别, 重试间隔取不小于策略给出的间隔的最小级别, 超过最大级别时取最大级别
+func Tiers(tiers ...time.Duration) Option {
+	return func(o *Options) {
+		o.tiers = tiers
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		policy: mq.ExponentialRetry(time.Second, 10*time.Minute, 0, defaultMaxAttempts),
+		tiers:  defaultTiers,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	tiers := make([]time.Duration, 0, len(o.tiers))
+	for _, t := range o.tiers {
+		if t > 0 {
+			tiers = append(tiers, t)
+		}
+	}
+	if len(tiers) == 0 {
+		tiers = defaultTiers
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i] < tiers[j] })
+	o.tiers = tiers
+	return o
+}
+
+// tier 返回重试间隔 d 对应的级别
+func (o *Options) tier(d time.Duration) time.Duration {
+	for _, t := range o.tiers {
+		if t >= d {
+			return t
+		}
+	}
+	return o.tiers[len(o.tiers)-1]
+}
@@ -0,0 +1,127 @@
+// Package retry 通过重试 topic 实现分级重试.
+//
+// 处理失败的消息不依赖 broker 的重新投递, 而是按 RetryPolicy 选择重试级别,
+// 延迟发送到该级别的重试 topic mq.RetryTopic(group, tier), 到期后由同一个 Router 交还给原 topic 的 Handler;
+// 超过最大投递次数或被 Reject 的消息发送到死信 topic mq.DeadLetterTopic(group), 可通过后端的 mq.DeadLetterQueue 查看和重放.
+// 重试 topic 按消费组区分, 重试不会影响订阅了同一 topic 的其他消费组;
+// 每个级别使用固定的延迟, 适合 SendDelay 只支持少量固定延迟的后端(如 kafka 的延迟桶和 rabbitmq 的延迟队列).
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+type subscription struct {
+	filter  string
+	handler mq.Handler
+}
+
+// Router 为 Consumer 的订阅增加分级重试, 同一个消费组的所有实例应订阅相同的 topic
+type Router struct {
+	producer mq.Producer
+	consumer mq.Consumer
+	group    string
+	opts     *Options
+
+	mu    sync.Mutex
+	subs  map[string]*subscription
+	tiers bool
+}
+
+// NewRouter group 应与 consumer 的消费组一致, 重试和死信消息通过 producer 发送
+func NewRouter(producer mq.Producer, consumer mq.Consumer, group string, opts ...Option) *Router {
+	return &Router{
+		producer: producer,
+		consumer: consumer,
+		group:    group,
+		opts:     newOptions(opts),
+		subs:     make(map[string]*subscription),
+	}
+}
+
+// Subscribe 订阅 topic, 第一次订阅时同时订阅全部重试 topic; 同一个 topic 只能订阅一次
+func (r *Router) Subscribe(topic, tag string, handler mq.Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subs[topic]; ok {
+		return fmt.Errorf("retry: topic %s already subscribed", topic)
+	}
+	if !r.tiers {
+		for _, tier := range r.opts.tiers {
+			if err := r.consumer.Subscribe(mq.RetryTopic(r.group, tier), "", r.dispatch); err != nil {
+				return err
+			}
+		}
+		r.tiers = true
+	}
+	sub := &subscription{filter: tag, handler: handler}
+	r.subs[topic] = sub
+	if err := r.consumer.Subscribe(topic, tag, func(ctx context.Context, msg *mq.Msg) error {
+		return r.handle(ctx, sub, msg)
+	}); err != nil {
+		delete(r.subs, topic)
+		return err
+	}
+	return nil
+}
+
+// dispatch 将重试 topic 的消息还原后交给原 topic 的 Handler
+func (r *Router) dispatch(ctx context.Context, msg *mq.Msg) error {
+	origin := msg.Header(mq.HeaderOriginTopic)
+	r.mu.Lock()
+	sub := r.subs[origin]
+	r.mu.Unlock()
+	if sub == nil {
+		return mq.Reject(fmt.Errorf("retry: topic %q not subscribed", origin))
+	}
+	prev, _ := strconv.Atoi(msg.Header(mq.HeaderAttempts))
+	m := msg.Clone()
+	m.Topic = origin
+	m.Attempts = prev + msg.Attempts
+	delete(m.Headers, mq.HeaderOriginTopic)
+	delete(m.Headers, mq.HeaderAttempts)
+	if len(m.Headers) == 0 {
+		m.Headers = nil
+	}
+	if !mq.MatchTag(sub.filter, m.Tag) {
+		return nil
+	}
+	return r.handle(ctx, sub, m)
+}
+
+// handle 处理失败的消息转入重试或死信 topic 后确认, 转发失败时返回错误由后端重新投递
+func (r *Router) handle(ctx context.Context, sub *subscription, msg *mq.Msg) error {
+	err := sub.handler(ctx, msg)
+	if err == nil {
+		return nil
+	}
+	delay, ok := r.opts.policy.Next(msg.Attempts)
+	if errors.Is(err, mq.ErrReject) || !ok {
+		return r.deadLetter(ctx, msg, err)
+	}
+	tier := r.opts.tier(delay)
+	rm := msg.Clone()
+	rm.Topic = mq.RetryTopic(r.group, tier)
+	rm.Attempts = 0
+	rm.SetHeader(mq.HeaderOriginTopic, msg.Topic)
+	rm.SetHeader(mq.HeaderAttempts, strconv.Itoa(msg.Attempts))
+	_, err = r.producer.SendDelay(ctx, rm, tier)
+	return err
+}
+
+func (r *Router) deadLetter(ctx context.Context, msg *mq.Msg, err error) error {
+	dl := msg.Clone()
+	dl.Topic = mq.DeadLetterTopic(r.group)
+	dl.Delay = 0
+	dl.Attempts = 0
+	dl.SetHeader(mq.HeaderOriginTopic, msg.Topic)
+	dl.SetHeader(mq.HeaderError, err.Error())
+	_, err = r.producer.Send(ctx, dl)
+	return err
+}
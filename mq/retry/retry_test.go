@@ -0,0 +1,99 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/davveo/go-toolkit/mq"
+	"github.com/davveo/go-toolkit/mq/local"
+)
+
+func TestTier(t *testing.T) {
+	o := newOptions([]Option{Tiers(time.Minute, 0, time.Second)})
+	for d, want := range map[time.Duration]time.Duration{
+		0:                time.Second,
+		time.Second:      time.Second,
+		2 * time.Second:  time.Minute,
+		10 * time.Minute: time.Minute,
+	} {
+		if got := o.tier(d); got != want {
+			t.Fatalf("tier(%v) = %v, want %v", d, got, want)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+	b := local.NewBroker()
+	defer b.Close()
+	r := NewRouter(b, b.NewConsumer(local.Group("g")), "g",
+		Policy(mq.FixedRetry(time.Millisecond, 3)), Tiers(10*time.Millisecond, 20*time.Millisecond))
+
+	received := make(chan *mq.Msg, 8)
+	if err := r.Subscribe("orders", "a", func(ctx context.Context, msg *mq.Msg) error {
+		received <- msg
+		switch string(msg.Body) {
+		case "flaky":
+			if msg.Attempts < 3 {
+				return errors.New("busy")
+			}
+		case "broken":
+			return errors.New("always")
+		case "bad":
+			return mq.Reject(errors.New("malformed"))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Subscribe("orders", "", nil); err == nil {
+		t.Fatal("expected error on duplicate subscription")
+	}
+
+	msg := mq.NewMsg("orders", "a", []byte("flaky"))
+	msg.SetHeader("trace", "abc")
+	id, _ := b.Send(ctx, msg)
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		m := receive(t, received)
+		if m.ID != id || m.Topic != "orders" || m.Attempts != i || m.Header("trace") != "abc" || len(m.Headers) != 1 {
+			t.Fatalf("attempt %d = %+v", i, m)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("retried after %v", elapsed)
+	}
+
+	for _, body := range []string{"broken", "bad"} {
+		_, _ = b.Send(ctx, mq.NewMsg("orders", "a", []byte(body)))
+	}
+	var dead []*mq.Msg
+	for deadline := time.Now().Add(2 * time.Second); len(dead) < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letters = %d", len(dead))
+		}
+		dead, _ = b.List(ctx, "g", 0)
+	}
+	for _, d := range dead {
+		if d.Header(mq.HeaderOriginTopic) != "orders" || d.Header(mq.HeaderError) == "" || d.Header(mq.HeaderAttempts) != "" {
+			t.Fatalf("dead letter = %+v", d)
+		}
+	}
+	// broken 投递 3 次, bad 只投递 1 次
+	if n := len(received); n != 4 {
+		t.Fatalf("deliveries = %d", n)
+	}
+}
+
+func receive(t *testing.T, ch <-chan *mq.Msg) *mq.Msg {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+		return nil
+	}
+}
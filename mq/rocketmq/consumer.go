@@ -0,0 +1,159 @@
+package rocketmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// Subscribe 以 group-topic 为消费组创建 push 消费者, tag 过滤表达式(如 "a || b")由 broker 执行.
+// rocketmq 要求同一消费组的所有实例订阅关系一致, 且消费者启动后不能再增加订阅,
+// 因此每个 topic 使用独立的消费组, 同一个 topic 在进程内只能订阅一次.
+// 处理失败的消息由 broker 按延迟级别重新投递, 顺序消息则在本地暂停该队列后重试.
+func (r *RocketMQ) Subscribe(topic, tag string, handler mq.Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return mq.ErrClosed
+	}
+	group := consumerGroup(r.opts.group, topic)
+	c, err := rocketmq.NewPushConsumer(r.opts.consumerOptions(group)...)
+	if err != nil {
+		return err
+	}
+	if err = c.Subscribe(topic, selector(tag), r.consume(group, tag, handler)); err != nil {
+		return err
+	}
+	if err = c.Start(); err != nil {
+		_ = c.Shutdown()
+		return err
+	}
+	r.consumers = append(r.consumers, c)
+	return nil
+}
+
+// consume 默认每次回调只有一条消息, 批量时遇到需要重试的消息整批重试
+func (r *RocketMQ) consume(group, filter string, handler mq.Handler) func(context.Context, ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+	return func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		for _, me := range msgs {
+			delay, done := r.handle(ctx, group, filter, fromMessageExt(me), handler)
+			if done {
+				continue
+			}
+			if r.opts.ordered {
+				if oc, ok := primitive.GetOrderlyCtx(ctx); ok && delay > 0 {
+					oc.SuspendCurrentQueueTimeMillis = int(delay.Milliseconds())
+				}
+				return consumer.SuspendCurrentQueueAMoment, nil
+			}
+			if cc, ok := primitive.GetConcurrentlyCtx(ctx); ok && delay > 0 {
+				cc.DelayLevelWhenNextConsume = r.opts.delayLevel(delay)
+			}
+			return consumer.ConsumeRetryLater, nil
+		}
+		return consumer.ConsumeSuccess, nil
+	}
+}
+
+// handle 返回 false 表示消息需要在 delay 后重新投递, delay 为 0 时使用 broker 的默认间隔
+func (r *RocketMQ) handle(ctx context.Context, group, filter string, msg *mq.Msg, handler mq.Handler) (time.Duration, bool) {
+	if !mq.MatchTag(filter, msg.Tag) {
+		return 0, true
+	}
+	err := handler(ctx, msg)
+	if err == nil {
+		return 0, true
+	}
+	delay, ok := r.opts.next(msg.Attempts)
+	if errors.Is(err, mq.ErrReject) || !ok {
+		if err = r.deadLetter(ctx, msg, err); err == nil {
+			return 0, true
+		}
+		warn("rocketmq: send to dead letter topic failed", err,
+			logger.KV("group", group), logger.KV("topic", msg.Topic), logger.KV("id", msg.ID))
+	}
+	return delay, false
+}
+
+func (r *RocketMQ) deadLetter(ctx context.Context, msg *mq.Msg, err error) error {
+	dl := msg.Clone()
+	dl.Topic = mq.DeadLetterTopic(r.opts.group)
+	dl.Delay = 0
+	dl.Attempts = 0
+	dl.SetHeader(mq.HeaderOriginTopic, msg.Topic)
+	dl.SetHeader(mq.HeaderError, err.Error())
+	_, err = r.Send(ctx, dl)
+	return err
+}
+
+// PullConsumer 由调用方控制拉取节奏的消费者
+type PullConsumer struct {
+	r        *RocketMQ
+	group    string
+	filter   string
+	consumer rocketmq.PullConsumer
+}
+
+// NewPullConsumer 创建 topic 的 pull 消费者, 消费组与 Subscribe 相同, 同一个 topic 不能同时使用两种消费方式
+func (r *RocketMQ) NewPullConsumer(topic, tag string) (*PullConsumer, error) {
+	group := consumerGroup(r.opts.group, topic)
+	// 每次拉取一条, 处理失败时只重试这一条
+	opts := append(r.opts.consumerOptions(group), consumer.WithPullBatchSize(1))
+	c, err := rocketmq.NewPullConsumer(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.Subscribe(topic, selector(tag)); err != nil {
+		return nil, err
+	}
+	if err = c.Start(); err != nil {
+		_ = c.Shutdown()
+		return nil, err
+	}
+	return &PullConsumer{r: r, group: group, filter: tag, consumer: c}, nil
+}
+
+// Poll 等待最多 timeout 拉取一批消息并交给 handler 处理, 返回处理的消息数, 没有新消息时返回 0
+func (p *PullConsumer) Poll(ctx context.Context, timeout time.Duration, handler mq.Handler) (int, error) {
+	cr, err := p.consumer.Poll(ctx, timeout)
+	if consumer.IsNoNewMsgError(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	result := consumer.ConsumeSuccess
+	msgs := cr.GetMsgList()
+	for _, me := range msgs {
+		// pull 消费者的重试间隔由 broker 决定
+		if _, done := p.r.handle(ctx, p.group, p.filter, fromMessageExt(me), handler); !done {
+			result = consumer.ConsumeRetryLater
+			break
+		}
+	}
+	p.consumer.ACK(ctx, cr, result)
+	return len(msgs), nil
+}
+
+func (p *PullConsumer) Close() error {
+	return p.consumer.Shutdown()
+}
+
+func consumerGroup(group, topic string) string {
+	return fmt.Sprintf("%s-%s", group, topic)
+}
+
+func selector(tag string) consumer.MessageSelector {
+	if tag == "" {
+		tag = "*"
+	}
+	return consumer.MessageSelector{Type: consumer.TAG, Expression: tag}
+}
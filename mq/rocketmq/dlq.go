@@ -0,0 +1,222 @@
+package rocketmq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/admin"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	rmqerrors "github.com/apache/rocketmq-client-go/v2/errors"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// rocketmq 的消息无法单独删除, 死信 topic 的队列头部记录在消费组 DLQ-group-admin 的消费进度中:
+// List 从头部开始按 offset 拉取, 不提交消费进度; Replay/Purge 读取到开始时各队列的末尾后确认,
+// 只处理部分消息时, 其余消息重新发送到死信 topic 末尾, 本次不会再读取到.
+
+const (
+	// 在该时长内没有拉取到新消息时认为已读到末尾(消费组的队列可能被其他实例分配走)
+	scanIdle = 2 * time.Second
+	// List 每次拉取的消息数
+	listBatch = 32
+)
+
+// admin 的客户端按进程共用且关闭时直接销毁, 同一时间只使用一个
+var adminMu sync.Mutex
+
+var _ mq.DeadLetterQueue = (*RocketMQ)(nil)
+
+// queueRange 队列中 [head, end) 之间的死信
+type queueRange struct {
+	queue     *primitive.MessageQueue
+	head, end int64
+}
+
+type queueKey struct {
+	broker string
+	id     int
+}
+
+func keyOf(q *primitive.MessageQueue) queueKey {
+	return queueKey{broker: q.BrokerName, id: q.QueueId}
+}
+
+func (r *RocketMQ) List(ctx context.Context, group string, limit int) ([]*mq.Msg, error) {
+	var exts []*primitive.MessageExt
+	err := r.scan(ctx, group, func(c rocketmq.PullConsumer, ranges map[queueKey]*queueRange) error {
+		for _, qr := range ranges {
+			// 每个队列最多取 limit 条, 合并后按存储时间排序
+			n := 0
+			for off := qr.head; off < qr.end && (limit <= 0 || n < limit); {
+				size := int64(listBatch)
+				if rest := qr.end - off; rest < size {
+					size = rest
+				}
+				res, err := c.PullFrom(ctx, qr.queue, off, int(size))
+				if err != nil {
+					return err
+				}
+				if res.Status != primitive.PullFound || res.NextBeginOffset <= off {
+					break
+				}
+				for _, me := range res.GetMessageExts() {
+					if me.QueueOffset >= qr.end || (limit > 0 && n >= limit) {
+						break
+					}
+					exts = append(exts, me)
+					n++
+				}
+				off = res.NextBeginOffset
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(exts, func(i, j int) bool {
+		return exts[i].StoreTimestamp < exts[j].StoreTimestamp
+	})
+	if limit > 0 && len(exts) > limit {
+		exts = exts[:limit]
+	}
+	msgs := make([]*mq.Msg, 0, len(exts))
+	for _, me := range exts {
+		msgs = append(msgs, deadLetterMsg(me))
+	}
+	return msgs, nil
+}
+
+func (r *RocketMQ) Replay(ctx context.Context, group string, ids ...string) (int, error) {
+	return r.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		_, err := r.Send(ctx, mq.Revive(msg))
+		return err
+	})
+}
+
+func (r *RocketMQ) Purge(ctx context.Context, group string, ids ...string) (int, error) {
+	return r.drain(ctx, group, ids, func(msg *mq.Msg) error {
+		return nil
+	})
+}
+
+// drain 读取各队列到开始时末尾的死信, 匹配 ids 的交给 fn 处理, 其余的重新发送到死信 topic, 然后移动队列头部.
+// 出错时该消息及之后的消息不确认, 留在死信 topic 中.
+func (r *RocketMQ) drain(ctx context.Context, group string, ids []string, fn func(msg *mq.Msg) error) (int, error) {
+	set := mq.NewIDSet(ids)
+	n := 0
+	err := r.scan(ctx, group, func(c rocketmq.PullConsumer, ranges map[queueKey]*queueRange) error {
+		pending := 0
+		for _, qr := range ranges {
+			if qr.head < qr.end {
+				pending++
+			}
+		}
+		for pending > 0 {
+			cr, err := c.Poll(ctx, scanIdle)
+			if consumer.IsNoNewMsgError(err) {
+				return ctx.Err()
+			}
+			if err != nil {
+				return err
+			}
+			qr := ranges[keyOf(cr.GetMQ())]
+			if qr == nil {
+				continue
+			}
+			// 每批只有一条消息
+			ack := true
+			for _, me := range cr.GetMsgList() {
+				// 末尾之后是本次重新发送的或新进入的死信, 不确认, 留给下一次处理
+				if me.QueueOffset >= qr.end {
+					ack = false
+					break
+				}
+				msg := deadLetterMsg(me)
+				if !set.Match(msg.ID) {
+					_, err = r.Send(ctx, msg)
+				} else if err = fn(msg); err == nil {
+					n++
+				}
+				if err != nil {
+					return err
+				}
+				if me.QueueOffset+1 >= qr.end {
+					pending--
+				}
+			}
+			if ack {
+				c.ACK(ctx, cr, consumer.ConsumeSuccess)
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// scan 启动管理消费组的 pull 消费者, 记录死信 topic 各队列的头部和当前末尾后调用 fn,
+// 死信 topic 不存在时不调用 fn. 消费者关闭时提交 fn 中确认的消费进度.
+func (r *RocketMQ) scan(ctx context.Context, group string, fn func(c rocketmq.PullConsumer, ranges map[queueKey]*queueRange) error) error {
+	topic := mq.DeadLetterTopic(group)
+	queues, err := r.queues(ctx, topic)
+	if errors.Is(err, rmqerrors.ErrTopicNotExist) || (err == nil && len(queues) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	opts := append(r.opts.consumerOptions(topic+"-admin"),
+		consumer.WithConsumeFromWhere(consumer.ConsumeFromFirstOffset), consumer.WithPullBatchSize(1))
+	c, err := rocketmq.NewPullConsumer(opts...)
+	if err != nil {
+		return err
+	}
+	if err = c.Subscribe(topic, selector("")); err != nil {
+		return err
+	}
+	if err = c.Start(); err != nil {
+		_ = c.Shutdown()
+		return err
+	}
+	defer c.Shutdown()
+
+	ranges := make(map[queueKey]*queueRange, len(queues))
+	for _, q := range queues {
+		// 从超出末尾的位置拉取时 broker 立即返回 PULL_OFFSET_MOVED 和队列的最小、最大 offset, 不会挂起等待新消息
+		res, err := c.PullFrom(ctx, q, math.MaxInt64, 1)
+		if err != nil {
+			return err
+		}
+		// 未提交过消费进度时为 -1
+		head, _ := c.CurrentOffset(q)
+		if head < res.MinOffset {
+			head = res.MinOffset
+		}
+		ranges[keyOf(q)] = &queueRange{queue: q, head: head, end: res.MaxOffset}
+	}
+	return fn(c, ranges)
+}
+
+func (r *RocketMQ) queues(ctx context.Context, topic string) ([]*primitive.MessageQueue, error) {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+	a, err := admin.NewAdmin(r.opts.adminOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	return a.FetchPublishMessageQueues(ctx, topic)
+}
+
+func deadLetterMsg(me *primitive.MessageExt) *mq.Msg {
+	msg := fromMessageExt(me)
+	msg.Attempts = 0
+	return msg
+}
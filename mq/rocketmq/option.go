@@ -0,0 +1,181 @@
+package rocketmq
+
+import (
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/admin"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/apache/rocketmq-client-go/v2/producer"
+	"github.com/google/uuid"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+const (
+	defaultGroup       = "default"
+	defaultRetry       = 2
+	defaultMaxAttempts = 16
+)
+
+// broker 默认的 messageDelayLevel, 级别从 1 开始
+var defaultDelayLevels = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute, 5 * time.Minute,
+	6 * time.Minute, 7 * time.Minute, 8 * time.Minute, 9 * time.Minute, 10 * time.Minute,
+	20 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour,
+}
+
+type (
+	Options struct {
+		nameServers []string
+		namespace   string
+		credentials primitive.Credentials
+		// 生产者组, 订阅 topic 时的消费组为 group-topic, 死信 topic 为 mq.DeadLetterTopic(group)
+		group string
+		// 发送失败的重试次数
+		retry int
+		// 顺序消息: 生产者按 Msg.Key 选择队列, 消费者按队列顺序消费
+		ordered bool
+		// 最大投递次数, 超过后进入死信 topic
+		maxAttempts int
+		// 消费失败的重试策略, 设置后代替 maxAttempts, 间隔映射为最接近的延迟级别(顺序消息为暂停队列的时长);
+		// 未设置时由 broker 按重试次数递增延迟级别
+		policy mq.RetryPolicy
+		// 与 broker 的 messageDelayLevel 配置一致
+		delayLevels []time.Duration
+	}
+	Option func(o *Options)
+)
+
+func NameServers(addrs ...string) Option {
+	return func(o *Options) {
+		o.nameServers = addrs
+	}
+}
+
+func Namespace(namespace string) Option {
+	return func(o *Options) {
+		o.namespace = namespace
+	}
+}
+
+// Credentials 开启 ACL 时的 AccessKey/SecretKey
+func Credentials(accessKey, secretKey string) Option {
+	return func(o *Options) {
+		o.credentials = primitive.Credentials{AccessKey: accessKey, SecretKey: secretKey}
+	}
+}
+
+func Group(group string) Option {
+	return func(o *Options) {
+		o.group = group
+	}
+}
+
+func Retry(n int) Option {
+	return func(o *Options) {
+		o.retry = n
+	}
+}
+
+// Ordered 开启顺序消息, Key 相同的消息进入同一个队列并按发送顺序消费,
+// 处理失败时阻塞该队列直到重试成功或进入死信 topic
+func Ordered() Option {
+	return func(o *Options) {
+		o.ordered = true
+	}
+}
+
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.maxAttempts = n
+	}
+}
+
+// RetryPolicy 消费失败的重试策略, 策略的最大投递次数不应超过 MaxAttempts(broker 的重试上限)
+func RetryPolicy(policy mq.RetryPolicy) Option {
+	return func(o *Options) {
+		o.policy = policy
+	}
+}
+
+// DelayLevels broker 修改了 messageDelayLevel 时设置为相同的值
+func DelayLevels(levels ...time.Duration) Option {
+	return func(o *Options) {
+		o.delayLevels = levels
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{
+		nameServers: []string{"127.0.0.1:9876"},
+		group:       defaultGroup,
+		retry:       defaultRetry,
+		maxAttempts: defaultMaxAttempts,
+		delayLevels: defaultDelayLevels,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// next 第 attempts 次投递失败后的重试间隔, 返回 0 表示使用 broker 的默认间隔
+func (o *Options) next(attempts int) (time.Duration, bool) {
+	if o.policy != nil {
+		return o.policy.Next(attempts)
+	}
+	return 0, attempts < o.maxAttempts
+}
+
+func (o *Options) producerOptions() []producer.Option {
+	opts := []producer.Option{
+		producer.WithNsResolver(primitive.NewPassthroughResolver(o.nameServers)),
+		producer.WithGroupName(o.group),
+		producer.WithRetry(o.retry),
+		// 默认的实例名使所有 producer 和 admin 共用一个客户端, admin 关闭时会关闭该客户端
+		producer.WithInstanceName("mq-" + uuid.New().String()),
+	}
+	if o.namespace != "" {
+		opts = append(opts, producer.WithNamespace(o.namespace))
+	}
+	if o.credentials.AccessKey != "" {
+		opts = append(opts, producer.WithCredentials(o.credentials))
+	}
+	if o.ordered {
+		opts = append(opts, producer.WithQueueSelector(producer.NewHashQueueSelector()))
+	}
+	return opts
+}
+
+func (o *Options) consumerOptions(group string) []consumer.Option {
+	opts := []consumer.Option{
+		consumer.WithNsResolver(primitive.NewPassthroughResolver(o.nameServers)),
+		consumer.WithGroupName(group),
+		consumer.WithConsumerModel(consumer.Clustering),
+		consumer.WithConsumerOrder(o.ordered),
+		// 超过 maxAttempts 时由 handle 转入死信 topic, broker 的重试上限只作兜底
+		consumer.WithMaxReconsumeTimes(int32(o.maxAttempts)),
+	}
+	if o.namespace != "" {
+		opts = append(opts, consumer.WithNamespace(o.namespace))
+	}
+	if o.credentials.AccessKey != "" {
+		opts = append(opts, consumer.WithCredentials(o.credentials))
+	}
+	return opts
+}
+
+func (o *Options) adminOptions() []admin.AdminOption {
+	opts := []admin.AdminOption{
+		admin.WithResolver(primitive.NewPassthroughResolver(o.nameServers)),
+	}
+	if o.namespace != "" {
+		opts = append(opts, admin.WithNamespace(o.namespace))
+	}
+	if o.credentials.AccessKey != "" {
+		opts = append(opts, admin.WithCredentials(o.credentials))
+	}
+	return opts
+}
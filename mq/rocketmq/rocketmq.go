@@ -1 +1,209 @@
 package rocketmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+// 框架使用的 property, Msg.ID 与 rocketmq 生成的 msgId 不同, 单独保存
+const propertyID = "MQ_ID"
+
+// rocketmq 的系统 property, 不映射到 Msg.Headers
+var systemProperties = map[string]bool{
+	primitive.PropertyKeys: true, primitive.PropertyTags: true, primitive.PropertyWaitStoreMsgOk: true,
+	primitive.PropertyDelayTimeLevel: true, primitive.PropertyRetryTopic: true, primitive.PropertyRealTopic: true,
+	primitive.PropertyRealQueueId: true, primitive.PropertyTransactionPrepared: true, primitive.PropertyProducerGroup: true,
+	primitive.PropertyMinOffset: true, primitive.PropertyMaxOffset: true, primitive.PropertyBuyerId: true,
+	primitive.PropertyOriginMessageId: true, primitive.PropertyTransferFlag: true, primitive.PropertyCorrectionFlag: true,
+	primitive.PropertyMQ2Flag: true, primitive.PropertyReconsumeTime: true, primitive.PropertyMsgRegion: true,
+	primitive.PropertyTraceSwitch: true, primitive.PropertyUniqueClientMessageIdKeyIndex: true,
+	primitive.PropertyMaxReconsumeTimes: true, primitive.PropertyConsumeStartTime: true,
+	primitive.PropertyTranscationPreparedQueueOffset: true, primitive.PropertyTranscationCheckTimes: true,
+	primitive.PropertyCheckImmunityTimeInSeconds: true, primitive.PropertyShardingKey: true,
+	primitive.PropertyTransactionID: true, primitive.PropertyCorrelationID: true,
+	primitive.PropertyMessageReplyToClient: true, primitive.PropertyMessageTTL: true,
+	primitive.PropertyReplyMessageArriveTime: true, primitive.PropertyMsgType: true, primitive.PropertyCluster: true,
+	// broker 写入, 客户端没有对应的常量
+	"__SHARDINGKEY": true, "INSTANCE_ID": true,
+	propertyID: true,
+}
+
+// RocketMQ 基于 rocketmq-client-go 的 mq.MQ 实现.
+// Msg.Tag 映射为 tag, Msg.Key 映射为 keys 和顺序消息的 sharding key,
+// Msg.Delay 映射为最接近的延迟级别.
+type RocketMQ struct {
+	opts     *Options
+	producer rocketmq.Producer
+
+	mu        sync.Mutex
+	closed    bool
+	consumers []rocketmq.PushConsumer
+}
+
+var _ mq.MQ = (*RocketMQ)(nil)
+
+func NewRocketMQ(opts ...Option) (*RocketMQ, error) {
+	o := newOptions(opts)
+	p, err := rocketmq.NewProducer(o.producerOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Start(); err != nil {
+		return nil, err
+	}
+	return &RocketMQ{opts: o, producer: p}, nil
+}
+
+func (r *RocketMQ) Send(ctx context.Context, msg *mq.Msg) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if r.isClosed() {
+		return "", mq.ErrClosed
+	}
+	msg.Prepare()
+	res, err := r.producer.SendSync(ctx, r.opts.toMessage(msg))
+	if err != nil {
+		return "", err
+	}
+	if res.Status != primitive.SendOK {
+		return "", fmt.Errorf("rocketmq: send status %d", res.Status)
+	}
+	return msg.ID, nil
+}
+
+func (r *RocketMQ) SendAsync(ctx context.Context, msg *mq.Msg, callback func(id string, err error)) {
+	if r.isClosed() {
+		if callback != nil {
+			callback("", mq.ErrClosed)
+		}
+		return
+	}
+	msg.Prepare()
+	id := msg.ID
+	err := r.producer.SendAsync(ctx, func(ctx context.Context, res *primitive.SendResult, err error) {
+		if err == nil && res.Status != primitive.SendOK {
+			err = fmt.Errorf("rocketmq: send status %d", res.Status)
+		}
+		if callback == nil {
+			return
+		}
+		if err != nil {
+			callback("", err)
+			return
+		}
+		callback(id, nil)
+	}, r.opts.toMessage(msg))
+	if err != nil && callback != nil {
+		callback("", err)
+	}
+}
+
+// SendDelay delay 取最接近的延迟级别, 实际延迟可能与 delay 不同
+func (r *RocketMQ) SendDelay(ctx context.Context, msg *mq.Msg, delay time.Duration) (string, error) {
+	msg.Delay = delay
+	return r.Send(ctx, msg)
+}
+
+// Close 关闭消费者和生产者, 消费者关闭前提交已消费的 offset
+func (r *RocketMQ) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var errs []error
+	for _, c := range r.consumers {
+		errs = append(errs, c.Shutdown())
+	}
+	errs = append(errs, r.producer.Shutdown())
+	return errors.Join(errs...)
+}
+
+func (r *RocketMQ) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func (o *Options) toMessage(msg *mq.Msg) *primitive.Message {
+	m := primitive.NewMessage(msg.Topic, msg.Body)
+	if msg.Tag != "" {
+		m.WithTag(msg.Tag)
+	}
+	if msg.Key != "" {
+		m.WithKeys([]string{msg.Key})
+		m.WithShardingKey(msg.Key)
+	}
+	for k, v := range msg.Headers {
+		m.WithProperty(k, v)
+	}
+	m.WithProperty(propertyID, msg.ID)
+	if msg.Delay > 0 {
+		m.WithDelayTimeLevel(o.delayLevel(msg.Delay))
+	}
+	return m
+}
+
+func fromMessageExt(me *primitive.MessageExt) *mq.Msg {
+	msg := &mq.Msg{
+		ID:        me.GetProperty(propertyID),
+		Topic:     me.Topic,
+		Tag:       me.GetTags(),
+		Body:      me.Body,
+		Timestamp: time.UnixMilli(me.BornTimestamp),
+		Attempts:  int(me.ReconsumeTimes) + 1,
+	}
+	if msg.ID == "" {
+		msg.ID = me.MsgId
+	}
+	// keys 以空格分隔, 第一个为 Msg.Key
+	if keys := strings.Fields(me.GetKeys()); len(keys) > 0 {
+		msg.Key = keys[0]
+	}
+	for k, v := range me.GetProperties() {
+		if !systemProperties[k] {
+			msg.SetHeader(k, v)
+		}
+	}
+	// 重试消息的 topic 为 %RETRY%group, 原 topic 保存在 RETRY_TOPIC 中
+	if topic := me.GetProperty(primitive.PropertyRetryTopic); topic != "" {
+		msg.Topic = topic
+	}
+	return msg
+}
+
+// delayLevel 返回与 d 最接近的延迟级别, 距离相同时取较小的级别
+func (o *Options) delayLevel(d time.Duration) int {
+	level := 1
+	for i, l := range o.delayLevels {
+		if abs(l-d) < abs(o.delayLevels[level-1]-d) {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func warn(msg string, err error, kvs ...logger.Entry) {
+	if logger.IsInitialized() {
+		logger.WarnErr(msg, err, kvs...)
+	}
+}
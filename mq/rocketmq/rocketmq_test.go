@@ -0,0 +1,209 @@
+package rocketmq
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/google/uuid"
+
+	"github.com/davveo/go-toolkit/mq"
+)
+
+func TestDelayLevel(t *testing.T) {
+	o := newOptions(nil)
+	for d, level := range map[time.Duration]int{
+		time.Millisecond:               1,
+		3 * time.Second:                1,
+		4 * time.Second:                2,
+		time.Minute:                    5,
+		90 * time.Second:               5,
+		15 * time.Minute:               14,
+		time.Hour:                      17,
+		24 * time.Hour:                 18,
+		2*time.Minute + 29*time.Second: 6,
+		2*time.Minute + 31*time.Second: 7,
+	} {
+		if got := o.delayLevel(d); got != level {
+			t.Errorf("delayLevel(%v) = %d, want %d", d, got, level)
+		}
+	}
+	o = newOptions([]Option{DelayLevels(time.Second, time.Minute)})
+	if got := o.delayLevel(time.Hour); got != 2 {
+		t.Fatalf("custom delayLevel = %d", got)
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	o := newOptions(nil)
+	msg := mq.NewMsg("orders", "created", []byte("hello"))
+	msg.Key = "order-1"
+	msg.Delay = 10 * time.Second
+	msg.SetHeader("trace", "abc")
+	msg.Prepare()
+
+	m := o.toMessage(msg)
+	if m.GetProperty("DELAY") != "3" || m.GetShardingKey() != "order-1" {
+		t.Fatalf("properties = %v", m.GetProperties())
+	}
+
+	me := &primitive.MessageExt{MsgId: "broker-id", BornTimestamp: 1700000000000, ReconsumeTimes: 2}
+	me.Topic = "%RETRY%default-orders"
+	me.Body = m.Body
+	for k, v := range m.GetProperties() {
+		me.WithProperty(k, v)
+	}
+	me.WithProperty("RETRY_TOPIC", "orders")
+	got := fromMessageExt(me)
+	if got.ID != msg.ID || got.Topic != "orders" || got.Tag != "created" || got.Key != "order-1" ||
+		string(got.Body) != "hello" || got.Attempts != 3 || got.Header("trace") != "abc" || len(got.Headers) != 1 ||
+		got.Timestamp.UnixMilli() != 1700000000000 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestState(t *testing.T) {
+	if state(nil) != primitive.CommitMessageState ||
+		state(ErrUnknown) != primitive.UnknowState ||
+		state(errors.New("failed")) != primitive.RollbackMessageState {
+		t.Fatal("unexpected transaction state")
+	}
+	if s := selector(""); s.Expression != "*" {
+		t.Fatalf("selector = %+v", s)
+	}
+}
+
+// newTestRocketMQ 连接 ROCKETMQ_NAMESRV 指定的 name server, 未设置时跳过;
+// broker 需要开启 autoCreateTopicEnable
+func newTestRocketMQ(t *testing.T, opts ...Option) *RocketMQ {
+	addrs := os.Getenv("ROCKETMQ_NAMESRV")
+	if addrs == "" {
+		t.Skip("ROCKETMQ_NAMESRV not set")
+	}
+	opts = append([]Option{NameServers(strings.Split(addrs, ",")...)}, opts...)
+	r, err := NewRocketMQ(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+func TestSendSubscribe(t *testing.T) {
+	ctx := context.Background()
+	group := "g-" + uuid.New().String()
+	r := newTestRocketMQ(t, Group(group), MaxAttempts(2))
+	topic := "mq-test-" + uuid.New().String()
+	ch := make(chan *mq.Msg, 8)
+	if err := r.Subscribe(topic, "a || b", func(ctx context.Context, m *mq.Msg) error {
+		ch <- m
+		if string(m.Body) == "bad" {
+			return mq.Reject(errors.New("malformed"))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	dead := make(chan *mq.Msg, 1)
+	if err := r.Subscribe(mq.DeadLetterTopic(group), "", func(ctx context.Context, m *mq.Msg) error {
+		dead <- m
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []*mq.Msg{
+		mq.NewMsg(topic, "c", []byte("skipped")),
+		mq.NewMsg(topic, "a", []byte("ok")),
+		mq.NewMsg(topic, "b", []byte("bad")),
+	} {
+		if _, err := r.Send(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-ch:
+			if m.Tag == "c" {
+				t.Fatalf("received filtered message %+v", m)
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	select {
+	case d := <-dead:
+		if string(d.Body) != "bad" || d.Header(mq.HeaderOriginTopic) != topic {
+			t.Fatalf("dead letter %+v", d)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("dead letter not received")
+	}
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	ctx := context.Background()
+	group := "g-" + uuid.New().String()
+	r := newTestRocketMQ(t, Group(group))
+	topic := "mq-test-" + uuid.New().String()
+	healthy := make(chan bool, 1)
+	received := make(chan *mq.Msg, 1)
+	if err := r.Subscribe(topic, "", func(ctx context.Context, m *mq.Msg) error {
+		select {
+		case <-healthy:
+			received <- m
+			return nil
+		default:
+			return mq.Reject(errors.New("down"))
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := r.Send(ctx, mq.NewMsg(topic, "", []byte{byte('a' + i)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	list := func(want int) {
+		t.Helper()
+		var dead []*mq.Msg
+		for deadline := time.Now().Add(30 * time.Second); len(dead) != want; time.Sleep(time.Second) {
+			if time.Now().After(deadline) {
+				t.Fatalf("dead letters = %d, want %d", len(dead), want)
+			}
+			dead, _ = r.List(ctx, group, 0)
+		}
+		for _, d := range dead {
+			if d.Header(mq.HeaderOriginTopic) != topic {
+				t.Fatalf("dead letter %+v", d)
+			}
+		}
+	}
+	list(3)
+	// 其余死信重新发送到末尾, 不应被再次读取
+	if n, err := r.Purge(ctx, group, ids[0]); err != nil || n != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	list(2)
+	healthy <- true
+	if n, err := r.Replay(ctx, group, ids[1]); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	select {
+	case m := <-received:
+		if m.ID != ids[1] || m.Header(mq.HeaderOriginTopic) != "" {
+			t.Fatalf("replayed = %+v", m)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("replayed message not received")
+	}
+	list(1)
+}
@@ -0,0 +1,120 @@
+package rocketmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+
+	"github.com/davveo/go-toolkit/logger"
+	"github.com/davveo/go-toolkit/mq"
+)
+
+var (
+	// ErrUnknown 本地事务或回查返回该错误时, 事务状态未定, broker 稍后回查
+	ErrUnknown = errors.New("rocketmq: transaction state unknown")
+	// ErrRollback 本地事务失败, 半消息已回滚
+	ErrRollback = errors.New("rocketmq: transaction rolled back")
+	// ErrDelayTransaction 事务消息不支持延迟投递
+	ErrDelayTransaction = errors.New("rocketmq: transactional message cannot be delayed")
+)
+
+// Checker 回查本地事务的结果: 返回 nil 提交消息, 返回 ErrUnknown 等待下次回查, 其他错误回滚消息.
+// 发送半消息的进程在本地事务完成前退出时, broker 向同一生产者组的任意实例回查.
+type Checker func(ctx context.Context, msg *mq.Msg) error
+
+// TransactionProducer 发送事务消息: 先发送消费者不可见的半消息, 执行本地事务后提交或回滚
+type TransactionProducer struct {
+	opts     *Options
+	producer rocketmq.TransactionProducer
+	listener *listener
+}
+
+// NewTransactionProducer check 用于回查, 生产者组应与普通生产者不同, 同组的所有实例都要能回查
+func NewTransactionProducer(check Checker, opts ...Option) (*TransactionProducer, error) {
+	o := newOptions(opts)
+	l := &listener{check: check}
+	p, err := rocketmq.NewTransactionProducer(l, o.producerOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Start(); err != nil {
+		return nil, err
+	}
+	return &TransactionProducer{opts: o, producer: p, listener: l}, nil
+}
+
+// SendTx 发送半消息后执行 local, local 返回 nil 时提交消息, 返回 ErrUnknown 时等待回查, 其他错误回滚并返回该错误
+func (p *TransactionProducer) SendTx(ctx context.Context, msg *mq.Msg, local func(ctx context.Context) error) (string, error) {
+	if msg.Delay > 0 {
+		return "", ErrDelayTransaction
+	}
+	msg.Prepare()
+	tx := &transaction{ctx: ctx, local: local}
+	p.listener.txs.Store(msg.ID, tx)
+	defer p.listener.txs.Delete(msg.ID)
+
+	res, err := p.producer.SendMessageInTransaction(ctx, p.opts.toMessage(msg))
+	if err != nil {
+		return "", err
+	}
+	switch res.State {
+	case primitive.CommitMessageState:
+		return msg.ID, nil
+	case primitive.RollbackMessageState:
+		if tx.err != nil {
+			return "", tx.err
+		}
+		return "", ErrRollback
+	default:
+		return msg.ID, ErrUnknown
+	}
+}
+
+func (p *TransactionProducer) Close() error {
+	return p.producer.Shutdown()
+}
+
+type transaction struct {
+	ctx   context.Context
+	local func(ctx context.Context) error
+	err   error
+}
+
+type listener struct {
+	check Checker
+	// Msg.ID -> 正在执行的本地事务
+	txs sync.Map
+}
+
+func (l *listener) ExecuteLocalTransaction(m *primitive.Message) primitive.LocalTransactionState {
+	v, ok := l.txs.Load(m.GetProperty(propertyID))
+	if !ok {
+		return primitive.UnknowState
+	}
+	tx := v.(*transaction)
+	tx.err = tx.local(tx.ctx)
+	return state(tx.err)
+}
+
+func (l *listener) CheckLocalTransaction(me *primitive.MessageExt) primitive.LocalTransactionState {
+	msg := fromMessageExt(me)
+	err := l.check(context.Background(), msg)
+	if err != nil && !errors.Is(err, ErrUnknown) {
+		warn("rocketmq: transaction rolled back by check", err, logger.KV("topic", msg.Topic), logger.KV("id", msg.ID))
+	}
+	return state(err)
+}
+
+func state(err error) primitive.LocalTransactionState {
+	switch {
+	case err == nil:
+		return primitive.CommitMessageState
+	case errors.Is(err, ErrUnknown):
+		return primitive.UnknowState
+	default:
+		return primitive.RollbackMessageState
+	}
+}
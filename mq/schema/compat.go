@@ -0,0 +1,245 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hamba/avro"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Compatible 检查以 reader 为 schema 的消费者能否读取以 writer 写入的数据, 不兼容时返回的错误包装了 ErrIncompatible
+func Compatible(typ Type, reader, writer string) error {
+	var err error
+	switch typ {
+	case Avro:
+		var r, w avro.Schema
+		if r, err = parseAvro(reader); err != nil {
+			return err
+		}
+		if w, err = parseAvro(writer); err != nil {
+			return err
+		}
+		err = avro.NewSchemaCompatibility().Compatible(r, w)
+	case JSON:
+		var r, w *jsonSchema
+		if r, err = parseJSON(reader); err != nil {
+			return err
+		}
+		if w, err = parseJSON(writer); err != nil {
+			return err
+		}
+		err = jsonCompatible(r, w, "$")
+	case Protobuf:
+		var r, w *descriptorpb.DescriptorProto
+		if r, err = parseProto(reader); err != nil {
+			return err
+		}
+		if w, err = parseProto(writer); err != nil {
+			return err
+		}
+		err = protoCompatible(r, w, r.GetName())
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalid, typ)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIncompatible, err)
+	}
+	return nil
+}
+
+// normalize 校验定义并去掉多余的空白, 用于判断定义是否相同
+func normalize(typ Type, definition string) (string, error) {
+	var err error
+	switch typ {
+	case Avro:
+		_, err = parseAvro(definition)
+	case JSON:
+		_, err = parseJSON(definition)
+	case Protobuf:
+		_, err = parseProto(definition)
+	default:
+		err = fmt.Errorf("%w: unknown type %q", ErrInvalid, typ)
+	}
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = json.Compact(&buf, []byte(definition)); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return buf.String(), nil
+}
+
+// parseAvro 每次使用新的 SchemaCache, 避免同名 record 的不同版本相互覆盖
+func parseAvro(definition string) (avro.Schema, error) {
+	s, err := avro.ParseWithCache(definition, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return s, nil
+}
+
+type jsonSchema struct {
+	// 字符串或字符串数组
+	Type                 interface{}            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+}
+
+func parseJSON(definition string) (*jsonSchema, error) {
+	var s jsonSchema
+	if err := json.Unmarshal([]byte(definition), &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return &s, nil
+}
+
+func (s *jsonSchema) types() map[string]bool {
+	types := make(map[string]bool)
+	switch t := s.Type.(type) {
+	case string:
+		types[t] = true
+	case []interface{}:
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				types[name] = true
+			}
+		}
+	}
+	return types
+}
+
+// accepts reader 的类型是否包含 writer 的全部类型, 未声明类型时接受任意类型
+func (s *jsonSchema) accepts(writer *jsonSchema) bool {
+	r, w := s.types(), writer.types()
+	if len(r) == 0 {
+		return true
+	}
+	if len(w) == 0 {
+		return false
+	}
+	for t := range w {
+		if !r[t] && !(t == "integer" && r["number"]) {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonCompatible(reader, writer *jsonSchema, path string) error {
+	if !reader.accepts(writer) {
+		return fmt.Errorf("%s: type %v cannot read %v", path, reader.Type, writer.Type)
+	}
+	required := make(map[string]bool, len(writer.Required))
+	for _, name := range writer.Required {
+		required[name] = true
+	}
+	for _, name := range reader.Required {
+		if !required[name] {
+			return fmt.Errorf("%s.%s: required by reader but optional for writer", path, name)
+		}
+	}
+	if string(reader.AdditionalProperties) == "false" {
+		for name := range writer.Properties {
+			if _, ok := reader.Properties[name]; !ok {
+				return fmt.Errorf("%s.%s: not allowed by reader", path, name)
+			}
+		}
+	}
+	for name, r := range reader.Properties {
+		if w, ok := writer.Properties[name]; ok && r != nil && w != nil {
+			if err := jsonCompatible(r, w, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	if reader.Items != nil && writer.Items != nil {
+		return jsonCompatible(reader.Items, writer.Items, path+"[]")
+	}
+	return nil
+}
+
+// ProtoDefinition 生成 message 的 Protobuf schema 定义, 引用的其他 message 只记录类型名
+func ProtoDefinition(m proto.Message) (string, error) {
+	data, err := protojson.Marshal(protodesc.ToDescriptorProto(m.ProtoReflect().Descriptor()))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = json.Compact(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func parseProto(definition string) (*descriptorpb.DescriptorProto, error) {
+	var d descriptorpb.DescriptorProto
+	if err := protojson.Unmarshal([]byte(definition), &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return &d, nil
+}
+
+// protoCompatible 按字段编号比较, 同一编号的字段编码方式必须相同, reader 的 required 字段 writer 必须有
+func protoCompatible(reader, writer *descriptorpb.DescriptorProto, path string) error {
+	fields := make(map[int32]*descriptorpb.FieldDescriptorProto, len(writer.GetField()))
+	for _, f := range writer.GetField() {
+		fields[f.GetNumber()] = f
+	}
+	for _, r := range reader.GetField() {
+		w, ok := fields[r.GetNumber()]
+		if !ok {
+			if r.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+				return fmt.Errorf("%s.%s: required field %d missing in writer", path, r.GetName(), r.GetNumber())
+			}
+			continue
+		}
+		if wireKind(r.GetType()) != wireKind(w.GetType()) {
+			return fmt.Errorf("%s.%s: field %d changed type from %v to %v", path, r.GetName(), r.GetNumber(), w.GetType(), r.GetType())
+		}
+		if (r.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) != (w.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED) {
+			return fmt.Errorf("%s.%s: field %d changed cardinality", path, r.GetName(), r.GetNumber())
+		}
+		if r.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE && r.GetTypeName() != w.GetTypeName() {
+			return fmt.Errorf("%s.%s: field %d changed message type from %s to %s", path, r.GetName(), r.GetNumber(), w.GetTypeName(), r.GetTypeName())
+		}
+	}
+	nested := make(map[string]*descriptorpb.DescriptorProto, len(writer.GetNestedType()))
+	for _, n := range writer.GetNestedType() {
+		nested[n.GetName()] = n
+	}
+	for _, r := range reader.GetNestedType() {
+		if w, ok := nested[r.GetName()]; ok {
+			if err := protoCompatible(r, w, path+"."+r.GetName()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wireKind 编码兼容的字段类型返回相同的值
+func wireKind(t descriptorpb.FieldDescriptorProto_Type) string {
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_BOOL, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return "varint"
+	case descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+		return "zigzag"
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED32, descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return "fixed32"
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED64, descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return "fixed64"
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return "bytes"
+	}
+	return t.String()
+}
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// NewFileRegistry 以 JSON 文件保存的 Registry, 文件不存在时创建, 每次修改后整体写入.
+// 文件只在创建时读取, 不能由多个进程同时修改.
+func NewFileRegistry(path string, opts ...Option) (Registry, error) {
+	var s *state
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		s = &state{}
+		if err = json.Unmarshal(data, s); err != nil {
+			return nil, err
+		}
+	}
+	r := newMemoryRegistry(newOptions(opts), s)
+	r.save = func(s *state) error {
+		return writeFile(path, s)
+	}
+	return r, nil
+}
+
+// writeFile 先写入临时文件再重命名, 避免写入中断时损坏原文件
+func writeFile(path string, s *state) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,204 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// state registry 的全部数据, 文件 registry 以 JSON 形式保存
+type state struct {
+	// 按 ID 顺序, ID 从 1 开始
+	Schemas []*Schema `json:"schemas"`
+	// subject -> 各版本的 ID
+	Subjects      map[string][]int         `json:"subjects"`
+	Compatibility map[string]Compatibility `json:"compatibility"`
+}
+
+type memoryRegistry struct {
+	opts *Options
+
+	mu    sync.RWMutex
+	state *state
+	// 修改后调用, 返回错误时撤销修改
+	save func(s *state) error
+}
+
+var _ Registry = (*memoryRegistry)(nil)
+
+// NewMemoryRegistry 保存在内存中的 Registry, 用于测试和单进程
+func NewMemoryRegistry(opts ...Option) Registry {
+	return newMemoryRegistry(newOptions(opts), nil)
+}
+
+func newMemoryRegistry(o *Options, s *state) *memoryRegistry {
+	if s == nil {
+		s = &state{}
+	}
+	if s.Subjects == nil {
+		s.Subjects = make(map[string][]int)
+	}
+	if s.Compatibility == nil {
+		s.Compatibility = make(map[string]Compatibility)
+	}
+	return &memoryRegistry{opts: o, state: s}
+}
+
+func (r *memoryRegistry) Register(ctx context.Context, subject string, typ Type, definition string) (*Schema, error) {
+	definition, err := normalize(typ, definition)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s := r.find(subject, typ, definition); s != nil {
+		return s.clone(), nil
+	}
+	if err = r.check(subject, typ, definition); err != nil {
+		return nil, err
+	}
+	s := &Schema{
+		ID:         len(r.state.Schemas) + 1,
+		Subject:    subject,
+		Version:    len(r.state.Subjects[subject]) + 1,
+		Type:       typ,
+		Definition: definition,
+	}
+	r.state.Schemas = append(r.state.Schemas, s)
+	r.state.Subjects[subject] = append(r.state.Subjects[subject], s.ID)
+	if err = r.persist(); err != nil {
+		r.state.Schemas = r.state.Schemas[:len(r.state.Schemas)-1]
+		ids := r.state.Subjects[subject]
+		if len(ids) == 1 {
+			delete(r.state.Subjects, subject)
+		} else {
+			r.state.Subjects[subject] = ids[:len(ids)-1]
+		}
+		return nil, err
+	}
+	return s.clone(), nil
+}
+
+func (r *memoryRegistry) CheckCompatibility(ctx context.Context, subject string, typ Type, definition string) error {
+	definition, err := normalize(typ, definition)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.find(subject, typ, definition) != nil {
+		return nil
+	}
+	return r.check(subject, typ, definition)
+}
+
+func (r *memoryRegistry) GetByID(ctx context.Context, id int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id < 1 || id > len(r.state.Schemas) {
+		return nil, ErrNotFound
+	}
+	return r.state.Schemas[id-1].clone(), nil
+}
+
+func (r *memoryRegistry) GetLatest(ctx context.Context, subject string) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := r.state.Subjects[subject]
+	if len(ids) == 0 {
+		return nil, ErrNotFound
+	}
+	return r.state.Schemas[ids[len(ids)-1]-1].clone(), nil
+}
+
+func (r *memoryRegistry) GetVersion(ctx context.Context, subject string, version int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := r.state.Subjects[subject]
+	if version < 1 || version > len(ids) {
+		return nil, ErrNotFound
+	}
+	return r.state.Schemas[ids[version-1]-1].clone(), nil
+}
+
+func (r *memoryRegistry) Versions(ctx context.Context, subject string) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := r.state.Subjects[subject]
+	if len(ids) == 0 {
+		return nil, ErrNotFound
+	}
+	versions := make([]int, len(ids))
+	for i := range ids {
+		versions[i] = i + 1
+	}
+	return versions, nil
+}
+
+func (r *memoryRegistry) SetCompatibility(ctx context.Context, subject string, c Compatibility) error {
+	if !c.valid() {
+		return fmt.Errorf("schema: unknown compatibility %q", c)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.state.Compatibility[subject]
+	r.state.Compatibility[subject] = c
+	if err := r.persist(); err != nil {
+		if ok {
+			r.state.Compatibility[subject] = old
+		} else {
+			delete(r.state.Compatibility, subject)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *memoryRegistry) GetCompatibility(ctx context.Context, subject string) (Compatibility, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.compatibility(subject), nil
+}
+
+func (r *memoryRegistry) compatibility(subject string) Compatibility {
+	if c, ok := r.state.Compatibility[subject]; ok {
+		return c
+	}
+	return r.opts.compatibility
+}
+
+// find 查找 subject 中定义相同的版本; 调用方持有 r.mu
+func (r *memoryRegistry) find(subject string, typ Type, definition string) *Schema {
+	for _, id := range r.state.Subjects[subject] {
+		if s := r.state.Schemas[id-1]; s.Type == typ && s.Definition == definition {
+			return s
+		}
+	}
+	return nil
+}
+
+// check 调用方持有 r.mu
+func (r *memoryRegistry) check(subject string, typ Type, definition string) error {
+	ids := r.state.Subjects[subject]
+	previous := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s := r.state.Schemas[id-1]
+		if s.Type != typ {
+			return fmt.Errorf("%w: subject %s has type %s", ErrIncompatible, subject, s.Type)
+		}
+		previous = append(previous, s.Definition)
+	}
+	return r.compatibility(subject).check(typ, definition, previous)
+}
+
+func (r *memoryRegistry) persist() error {
+	if r.save == nil {
+		return nil
+	}
+	return r.save(r.state)
+}
+
+func (s *Schema) clone() *Schema {
+	c := *s
+	return &c
+}
@@ -0,0 +1,23 @@
+package schema
+
+type (
+	Options struct {
+		// 未单独设置兼容性要求的 subject 使用的默认值
+		compatibility Compatibility
+	}
+	Option func(o *Options)
+)
+
+func DefaultCompatibility(c Compatibility) Option {
+	return func(o *Options) {
+		o.compatibility = c
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	o := &Options{compatibility: Backward}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
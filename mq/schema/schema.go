@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound = errors.New("schema: not found")
+	// ErrIncompatible 新的 schema 不满足 subject 的兼容性要求
+	ErrIncompatible = errors.New("schema: incompatible")
+	ErrInvalid      = errors.New("schema: invalid definition")
+)
+
+// Type schema 的格式
+type Type string
+
+const (
+	// Avro 定义为 Avro schema JSON
+	Avro Type = "AVRO"
+	// JSON 定义为 JSON Schema, 兼容性检查只考虑 type、properties、required、additionalProperties 和 items
+	JSON Type = "JSON"
+	// Protobuf 定义为 message 的 DescriptorProto 的 JSON 形式, 可由 ProtoDefinition 生成
+	Protobuf Type = "PROTOBUF"
+)
+
+// Compatibility subject 注册新版本时的兼容性要求
+type Compatibility string
+
+const (
+	None Compatibility = "NONE"
+	// Backward 新版本能读取上一个版本写入的数据, 消费者先升级
+	Backward           Compatibility = "BACKWARD"
+	BackwardTransitive Compatibility = "BACKWARD_TRANSITIVE"
+	// Forward 上一个版本能读取新版本写入的数据, 生产者先升级
+	Forward           Compatibility = "FORWARD"
+	ForwardTransitive Compatibility = "FORWARD_TRANSITIVE"
+	// Full 同时满足 Backward 和 Forward
+	Full           Compatibility = "FULL"
+	FullTransitive Compatibility = "FULL_TRANSITIVE"
+)
+
+type Schema struct {
+	// 全局唯一, 随消息写入 mq.HeaderSchemaID
+	ID int `json:"id"`
+	// 通常为 topic 名或 topic + "-value"
+	Subject string `json:"subject"`
+	// subject 内从 1 开始递增
+	Version    int    `json:"version"`
+	Type       Type   `json:"type"`
+	Definition string `json:"definition"`
+}
+
+// Registry 管理 schema 的版本, 注册新版本时按 subject 的兼容性要求检查
+type Registry interface {
+	// Register 注册 subject 的新版本, 定义与已有版本相同时返回已有版本, 不满足兼容性要求时返回 ErrIncompatible
+	Register(ctx context.Context, subject string, typ Type, definition string) (*Schema, error)
+	// CheckCompatibility 检查 definition 能否注册为 subject 的新版本
+	CheckCompatibility(ctx context.Context, subject string, typ Type, definition string) error
+	GetByID(ctx context.Context, id int) (*Schema, error)
+	GetLatest(ctx context.Context, subject string) (*Schema, error)
+	GetVersion(ctx context.Context, subject string, version int) (*Schema, error)
+	// Versions 返回 subject 的全部版本号, subject 不存在时返回 ErrNotFound
+	Versions(ctx context.Context, subject string) ([]int, error)
+	// SetCompatibility 设置 subject 的兼容性要求, 未设置时使用 Registry 的默认值
+	SetCompatibility(ctx context.Context, subject string, c Compatibility) error
+	GetCompatibility(ctx context.Context, subject string) (Compatibility, error)
+}
+
+// check 按兼容性要求检查 definition 与 previous(按版本从旧到新)
+func (c Compatibility) check(typ Type, definition string, previous []string) error {
+	var backward, forward, transitive bool
+	switch c {
+	case None:
+		return nil
+	case Backward:
+		backward = true
+	case BackwardTransitive:
+		backward, transitive = true, true
+	case Forward:
+		forward = true
+	case ForwardTransitive:
+		forward, transitive = true, true
+	case Full:
+		backward, forward = true, true
+	case FullTransitive:
+		backward, forward, transitive = true, true, true
+	default:
+		return fmt.Errorf("schema: unknown compatibility %q", c)
+	}
+	if !transitive && len(previous) > 1 {
+		previous = previous[len(previous)-1:]
+	}
+	for _, old := range previous {
+		if backward {
+			if err := Compatible(typ, definition, old); err != nil {
+				return err
+			}
+		}
+		if forward {
+			if err := Compatible(typ, old, definition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c Compatibility) valid() bool {
+	switch c {
+	case None, Backward, BackwardTransitive, Forward, ForwardTransitive, Full, FullTransitive:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	orderV1 = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"}]}`
+	// 新增字段有默认值, 可以读取 v1 的数据
+	orderV2 = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"},
+		{"name": "amount", "type": "long", "default": 0}]}`
+	// 新增字段没有默认值
+	orderV3 = `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"},
+		{"name": "amount", "type": "long", "default": 0}, {"name": "currency", "type": "string"}]}`
+)
+
+func TestCompatible(t *testing.T) {
+	cases := []struct {
+		typ            Type
+		reader, writer string
+		ok             bool
+	}{
+		{Avro, orderV2, orderV1, true},
+		{Avro, orderV3, orderV2, false},
+		{Avro, orderV1, orderV3, true},
+		{JSON, `{"type": "object", "properties": {"id": {"type": "string"}}, "required": ["id"]}`,
+			`{"type": "object", "properties": {"id": {"type": "string"}, "n": {"type": "integer"}}, "required": ["id"]}`, true},
+		{JSON, `{"type": "object", "properties": {"n": {"type": "number"}}}`,
+			`{"type": "object", "properties": {"n": {"type": "integer"}}}`, true},
+		{JSON, `{"type": "object", "properties": {"n": {"type": "integer"}}}`,
+			`{"type": "object", "properties": {"n": {"type": "string"}}}`, false},
+		{JSON, `{"type": "object", "required": ["id"]}`, `{"type": "object"}`, false},
+		{JSON, `{"type": "object", "properties": {"id": {}}, "additionalProperties": false}`,
+			`{"type": "object", "properties": {"id": {}, "extra": {}}}`, false},
+	}
+	for i, c := range cases {
+		err := Compatible(c.typ, c.reader, c.writer)
+		if (err == nil) != c.ok || (err != nil && !errors.Is(err, ErrIncompatible)) {
+			t.Errorf("case %d: Compatible = %v, want ok %v", i, err, c.ok)
+		}
+	}
+}
+
+func TestProtoCompatible(t *testing.T) {
+	def, err := ProtoDefinition(&wrapperspb.StringValue{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := parseProto(def)
+	if d.GetName() != "StringValue" || len(d.GetField()) != 1 {
+		t.Fatalf("definition = %s", def)
+	}
+	// 增加字段兼容, 修改已有字段的类型不兼容
+	added := proto.Clone(d).(*descriptorpb.DescriptorProto)
+	added.Field = append(added.Field, &descriptorpb.FieldDescriptorProto{
+		Name: proto.String("lang"), Number: proto.Int32(2),
+		Type:  descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	})
+	changed := proto.Clone(d).(*descriptorpb.DescriptorProto)
+	changed.Field[0].Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+	for _, c := range []struct {
+		d  *descriptorpb.DescriptorProto
+		ok bool
+	}{{added, true}, {changed, false}} {
+		if err := Compatible(Protobuf, marshal(t, c.d), def); (err == nil) != c.ok {
+			t.Errorf("Compatible(%v) = %v", c.d, err)
+		}
+	}
+}
+
+func marshal(t *testing.T, d *descriptorpb.DescriptorProto) string {
+	data, err := protojson.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func registries(t *testing.T) map[string]func() Registry {
+	path := filepath.Join(t.TempDir(), "schemas.json")
+	memory := NewMemoryRegistry()
+	return map[string]func() Registry{
+		"memory": func() Registry { return memory },
+		"file": func() Registry {
+			r, err := NewFileRegistry(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return r
+		},
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	for name, newRegistry := range registries(t) {
+		t.Run(name, func(t *testing.T) {
+			r := newRegistry()
+			v1, err := r.Register(ctx, "orders", Avro, orderV1)
+			if err != nil || v1.ID != 1 || v1.Version != 1 {
+				t.Fatalf("Register v1 = %+v, %v", v1, err)
+			}
+			// 只有空白不同的定义视为同一版本
+			if s, err := r.Register(ctx, "orders", Avro, " "+orderV1+"\n"); err != nil || s.ID != v1.ID {
+				t.Fatalf("Register v1 again = %+v, %v", s, err)
+			}
+			v2, err := r.Register(ctx, "orders", Avro, orderV2)
+			if err != nil || v2.ID != 2 || v2.Version != 2 {
+				t.Fatalf("Register v2 = %+v, %v", v2, err)
+			}
+			if err = r.CheckCompatibility(ctx, "orders", Avro, orderV3); !errors.Is(err, ErrIncompatible) {
+				t.Fatalf("CheckCompatibility v3 = %v", err)
+			}
+			if _, err = r.Register(ctx, "orders", Avro, orderV3); !errors.Is(err, ErrIncompatible) {
+				t.Fatalf("Register v3 = %v", err)
+			}
+			if _, err = r.Register(ctx, "orders", JSON, `{"type": "object"}`); !errors.Is(err, ErrIncompatible) {
+				t.Fatalf("Register with another type = %v", err)
+			}
+			if _, err = r.Register(ctx, "orders", Avro, `{"type": "unknown"}`); !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Register invalid = %v", err)
+			}
+
+			if err = r.SetCompatibility(ctx, "orders", None); err != nil {
+				t.Fatal(err)
+			}
+			if c, _ := r.GetCompatibility(ctx, "orders"); c != None {
+				t.Fatalf("compatibility = %s", c)
+			}
+			v3, err := r.Register(ctx, "orders", Avro, orderV3)
+			if err != nil || v3.Version != 3 {
+				t.Fatalf("Register v3 without check = %+v, %v", v3, err)
+			}
+
+			// 文件 registry 重新打开后数据不变
+			r = newRegistry()
+			if s, err := r.GetLatest(ctx, "orders"); err != nil || s.ID != v3.ID {
+				t.Fatalf("GetLatest = %+v, %v", s, err)
+			}
+			if s, err := r.GetVersion(ctx, "orders", 2); err != nil || s.ID != v2.ID {
+				t.Fatalf("GetVersion = %+v, %v", s, err)
+			}
+			if s, err := r.GetByID(ctx, v1.ID); err != nil || s.Subject != "orders" || s.Type != Avro {
+				t.Fatalf("GetByID = %+v, %v", s, err)
+			}
+			if versions, err := r.Versions(ctx, "orders"); err != nil || len(versions) != 3 {
+				t.Fatalf("Versions = %v, %v", versions, err)
+			}
+			if _, err = r.GetLatest(ctx, "payments"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("GetLatest unknown = %v", err)
+			}
+		})
+	}
+}
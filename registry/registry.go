@@ -1 +1,89 @@
 package registry
+
+import (
+	"context"
+	"errors"
+
+	"github.com/davveo/go-toolkit/env"
+	"github.com/davveo/go-toolkit/meta"
+)
+
+// ErrWatcherStopped Watcher 已停止
+var ErrWatcherStopped = errors.New("registry: watcher stopped")
+
+// NewServiceInstance 写入 Metadata 的 key
+const (
+	MetadataPlatform = "platform"
+	MetadataEnv      = "env"
+)
+
+// ServiceInstance 服务实例
+type ServiceInstance struct {
+	// ID 实例的唯一标识, 重复注册同一 ID 时更新该实例
+	ID string `json:"id"`
+	// Name 服务名
+	Name string `json:"name"`
+	// Version 版本号
+	Version string `json:"version"`
+	// Metadata 自定义元信息, 如机房、权重
+	Metadata map[string]string `json:"metadata"`
+	// Endpoints 访问地址, 以协议区分, 如 http://10.0.0.1:8000, grpc://10.0.0.1:9000
+	Endpoints []string `json:"endpoints"`
+}
+
+// NewServiceInstance 由应用元信息创建实例: ID、Name、Version 取自 meta, 业务线和运行环境写入 Metadata
+func NewServiceInstance(m meta.Meta, endpoints ...string) *ServiceInstance {
+	return &ServiceInstance{
+		ID:      m.ID(),
+		Name:    m.Service(),
+		Version: m.Version(),
+		Metadata: map[string]string{
+			MetadataPlatform: m.Platform(),
+			MetadataEnv:      env.EnvProdMap[m.Env()],
+		},
+		Endpoints: endpoints,
+	}
+}
+
+func (s *ServiceInstance) Clone() *ServiceInstance {
+	c := *s
+	if s.Metadata != nil {
+		c.Metadata = make(map[string]string, len(s.Metadata))
+		for k, v := range s.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	c.Endpoints = append([]string(nil), s.Endpoints...)
+	return &c
+}
+
+// Registrar 服务注册
+type Registrar interface {
+	// Register 注册实例, 同一 ID 已注册时更新
+	Register(ctx context.Context, service *ServiceInstance) error
+	// Deregister 注销实例, 实例未注册时返回 nil
+	Deregister(ctx context.Context, service *ServiceInstance) error
+}
+
+// Discovery 服务发现
+type Discovery interface {
+	// GetService 返回服务当前的全部实例, 服务不存在时返回空列表
+	GetService(ctx context.Context, serviceName string) ([]*ServiceInstance, error)
+	// Watch 监听服务实例的变化, ctx 结束后 Watcher 停止
+	Watch(ctx context.Context, serviceName string) (Watcher, error)
+}
+
+// Watcher 服务实例变化的通知
+type Watcher interface {
+	// Next 第一次调用返回当前的全部实例, 之后阻塞到实例发生变化时返回变化后的全部实例;
+	// Watcher 停止后返回 ErrWatcherStopped 或 ctx 的错误
+	Next() ([]*ServiceInstance, error)
+	// Stop 停止监听, 阻塞中的 Next 立即返回
+	Stop() error
+}
+
+// Registry 同时提供注册和发现的实现
+type Registry interface {
+	Registrar
+	Discovery
+}
@@ -0,0 +1,334 @@
+// Package registrytest 是 registry.Registry 实现的一致性测试, 每个后端都应在测试中调用 Run:
+//
+//	func TestConformance(t *testing.T) {
+//		registrytest.Run(t, func(t *testing.T) registry.Registry {
+//			return NewRegistry(...)
+//		})
+//	}
+package registrytest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/davveo/go-toolkit/registry"
+)
+
+const (
+	defaultTimeout  = 10 * time.Second
+	defaultInterval = 50 * time.Millisecond
+)
+
+type (
+	Options struct {
+		// 等待注册结果可见的最长时间, 最终一致的后端(如 consul、eureka)需要设置得更长
+		timeout time.Duration
+		// 轮询 GetService 的间隔
+		interval time.Duration
+	}
+	Option func(o *Options)
+)
+
+func Timeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.timeout = d
+	}
+}
+
+func Interval(d time.Duration) Option {
+	return func(o *Options) {
+		o.interval = d
+	}
+}
+
+type suite struct {
+	opts        *Options
+	newRegistry func(t *testing.T) registry.Registry
+}
+
+// Run 运行一致性测试, newRegistry 为每个子测试创建 Registry, 需要清理的资源通过 t.Cleanup 注册.
+// 每个子测试使用随机的服务名, 可以在共享的后端上运行.
+func Run(t *testing.T, newRegistry func(t *testing.T) registry.Registry, opts ...Option) {
+	o := &Options{timeout: defaultTimeout, interval: defaultInterval}
+	for _, opt := range opts {
+		opt(o)
+	}
+	s := &suite{opts: o, newRegistry: newRegistry}
+	t.Run("RegisterDeregister", s.testRegisterDeregister)
+	t.Run("Update", s.testUpdate)
+	t.Run("MultipleInstances", s.testMultipleInstances)
+	t.Run("UnknownService", s.testUnknownService)
+	t.Run("Watch", s.testWatch)
+	t.Run("WatchStop", s.testWatchStop)
+	t.Run("WatchCancel", s.testWatchCancel)
+}
+
+func (s *suite) testRegisterDeregister(t *testing.T) {
+	ctx := context.Background()
+	r := s.newRegistry(t)
+	name := serviceName()
+	a := instance(name, "a")
+	if err := r.Register(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, r, name, a)
+	if err := r.Deregister(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, r, name)
+	// 重复注销
+	if err := r.Deregister(ctx, a); err != nil {
+		t.Fatalf("Deregister unregistered instance: %v", err)
+	}
+}
+
+func (s *suite) testUpdate(t *testing.T) {
+	ctx := context.Background()
+	r := s.newRegistry(t)
+	name := serviceName()
+	a := instance(name, "a")
+	if err := r.Register(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, r, name, a)
+	updated := a.Clone()
+	updated.Version = "2.0.0"
+	updated.Metadata["zone"] = "b"
+	updated.Endpoints = []string{"http://127.0.0.1:8001"}
+	if err := r.Register(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, r, name, updated)
+	cleanup(t, r, updated)
+}
+
+func (s *suite) testMultipleInstances(t *testing.T) {
+	ctx := context.Background()
+	r := s.newRegistry(t)
+	name, other := serviceName(), serviceName()
+	a, b, c := instance(name, "a"), instance(name, "b"), instance(other, "c")
+	for _, ins := range []*registry.ServiceInstance{a, b, c} {
+		if err := r.Register(ctx, ins); err != nil {
+			t.Fatal(err)
+		}
+		cleanup(t, r, ins)
+	}
+	s.waitFor(t, r, name, a, b)
+	s.waitFor(t, r, other, c)
+	if err := r.Deregister(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, r, name, b)
+}
+
+func (s *suite) testUnknownService(t *testing.T) {
+	r := s.newRegistry(t)
+	got, err := r.GetService(context.Background(), serviceName())
+	if err != nil || len(got) != 0 {
+		t.Fatalf("GetService unknown = %v, %v", got, err)
+	}
+}
+
+func (s *suite) testWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*s.opts.timeout)
+	defer cancel()
+	r := s.newRegistry(t)
+	name := serviceName()
+	w, err := r.Watch(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if got, err := w.Next(); err != nil || len(got) != 0 {
+		t.Fatalf("first Next = %v, %v", got, err)
+	}
+
+	a := instance(name, "a")
+	if err = r.Register(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	cleanup(t, r, a)
+	s.next(t, w, a)
+	updated := a.Clone()
+	updated.Metadata["zone"] = "b"
+	if err = r.Register(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	s.next(t, w, updated)
+	if err = r.Deregister(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	s.next(t, w)
+}
+
+func (s *suite) testWatchStop(t *testing.T) {
+	r := s.newRegistry(t)
+	w, err := r.Watch(context.Background(), serviceName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Next(); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := w.Next()
+		errs <- err
+	}()
+	if err = w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	s.stopped(t, errs)
+	if _, err = w.Next(); err == nil {
+		t.Fatal("Next after Stop returned no error")
+	}
+}
+
+func (s *suite) testWatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := s.newRegistry(t)
+	w, err := r.Watch(ctx, serviceName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if _, err = w.Next(); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := w.Next()
+		errs <- err
+	}()
+	cancel()
+	s.stopped(t, errs)
+}
+
+// waitFor 等待 GetService 返回 want
+func (s *suite) waitFor(t *testing.T, r registry.Discovery, name string, want ...*registry.ServiceInstance) {
+	t.Helper()
+	deadline := time.Now().Add(s.opts.timeout)
+	for {
+		got, err := r.GetService(context.Background(), name)
+		if err == nil && equal(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GetService(%s) = %s, %v, want %s", name, format(got), err, format(want))
+		}
+		time.Sleep(s.opts.interval)
+	}
+}
+
+// next 等待 Watcher 返回 want, 中间状态被忽略
+func (s *suite) next(t *testing.T, w registry.Watcher, want ...*registry.ServiceInstance) {
+	t.Helper()
+	type result struct {
+		instances []*registry.ServiceInstance
+		err       error
+	}
+	timeout := time.After(s.opts.timeout)
+	for {
+		ch := make(chan result, 1)
+		go func() {
+			instances, err := w.Next()
+			ch <- result{instances, err}
+		}()
+		select {
+		case res := <-ch:
+			if res.err != nil {
+				t.Fatalf("Next: %v", res.err)
+			}
+			if equal(res.instances, want) {
+				return
+			}
+		case <-timeout:
+			// 阻塞中的 Next 由 Stop 结束
+			t.Fatalf("Next did not return %s", format(want))
+		}
+	}
+}
+
+func (s *suite) stopped(t *testing.T, errs <-chan error) {
+	t.Helper()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("Next returned no error after the watcher stopped")
+		}
+	case <-time.After(s.opts.timeout):
+		t.Fatal("Next still blocked after the watcher stopped")
+	}
+}
+
+func cleanup(t *testing.T, r registry.Registrar, ins *registry.ServiceInstance) {
+	t.Cleanup(func() {
+		_ = r.Deregister(context.Background(), ins)
+	})
+}
+
+func serviceName() string {
+	return "registrytest-" + uuid.New().String()[:8]
+}
+
+func instance(name, id string) *registry.ServiceInstance {
+	return &registry.ServiceInstance{
+		ID:        name + "-" + id,
+		Name:      name,
+		Version:   "1.0.0",
+		Metadata:  map[string]string{"zone": "a"},
+		Endpoints: []string{"http://127.0.0.1:8000", "grpc://127.0.0.1:9000"},
+	}
+}
+
+// equal 不考虑实例的顺序, nil 与空的 Metadata/Endpoints 视为相同
+func equal(got, want []*registry.ServiceInstance) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	byID := make(map[string]*registry.ServiceInstance, len(got))
+	for _, ins := range got {
+		byID[ins.ID] = ins
+	}
+	for _, w := range want {
+		g, ok := byID[w.ID]
+		if !ok || g.Name != w.Name || g.Version != w.Version ||
+			!sameMap(g.Metadata, w.Metadata) || !sameSlice(g.Endpoints, w.Endpoints) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameMap(a, b map[string]string) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+// sameSlice Endpoints 的顺序不要求保留
+func sameSlice(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+func format(instances []*registry.ServiceInstance) string {
+	s := "["
+	for i, ins := range instances {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%+v", *ins)
+	}
+	return s + "]"
+}
@@ -0,0 +1,116 @@
+package registrytest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/davveo/go-toolkit/registry"
+)
+
+// memory 内存中的 Registry, 用于验证一致性测试本身
+type memory struct {
+	mu       sync.Mutex
+	services map[string]map[string]*registry.ServiceInstance
+	watchers map[string]map[*watcher]struct{}
+}
+
+func newMemory() *memory {
+	return &memory{
+		services: make(map[string]map[string]*registry.ServiceInstance),
+		watchers: make(map[string]map[*watcher]struct{}),
+	}
+}
+
+func (m *memory) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.services[service.Name] == nil {
+		m.services[service.Name] = make(map[string]*registry.ServiceInstance)
+	}
+	m.services[service.Name][service.ID] = service.Clone()
+	m.notify(service.Name)
+	return nil
+}
+
+func (m *memory) Deregister(ctx context.Context, service *registry.ServiceInstance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.services[service.Name][service.ID]; ok {
+		delete(m.services[service.Name], service.ID)
+		m.notify(service.Name)
+	}
+	return nil
+}
+
+func (m *memory) GetService(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(serviceName), nil
+}
+
+func (m *memory) Watch(ctx context.Context, serviceName string) (registry.Watcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{m: m, name: serviceName, ctx: ctx, cancel: cancel, changed: make(chan struct{}, 1)}
+	w.changed <- struct{}{}
+	m.mu.Lock()
+	if m.watchers[serviceName] == nil {
+		m.watchers[serviceName] = make(map[*watcher]struct{})
+	}
+	m.watchers[serviceName][w] = struct{}{}
+	m.mu.Unlock()
+	return w, nil
+}
+
+func (m *memory) list(name string) []*registry.ServiceInstance {
+	instances := make([]*registry.ServiceInstance, 0, len(m.services[name]))
+	for _, ins := range m.services[name] {
+		instances = append(instances, ins.Clone())
+	}
+	return instances
+}
+
+func (m *memory) notify(name string) {
+	for w := range m.watchers[name] {
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type watcher struct {
+	m       *memory
+	name    string
+	ctx     context.Context
+	cancel  context.CancelFunc
+	changed chan struct{}
+}
+
+func (w *watcher) Next() ([]*registry.ServiceInstance, error) {
+	if err := w.ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case <-w.ctx.Done():
+		return nil, w.ctx.Err()
+	case <-w.changed:
+		w.m.mu.Lock()
+		defer w.m.mu.Unlock()
+		return w.m.list(w.name), nil
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	w.m.mu.Lock()
+	delete(w.m.watchers[w.name], w)
+	w.m.mu.Unlock()
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	Run(t, func(t *testing.T) registry.Registry {
+		return newMemory()
+	})
+}